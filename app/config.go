@@ -1,32 +1,53 @@
 package app
 
 import (
+	"time"
+
 	"github.com/TechMinerApps/portier/modules/bot"
+	"github.com/TechMinerApps/portier/modules/websub"
 )
 
 // DefaultConfig is the default config of Portier
 var DefaultConfig Config = Config{
-	DB:       dbConfig{Type: "sqlite", Path: "portier.db", Username: "portier", Password: "portier", Host: "localhost", Port: 3306, DBName: "portier"},
-	Telegram: bot.Config{Token: ""},
-	Template: "",
-	Log:      logConfig{Mode: "", Path: ""},
-	BuntDB:   buntDBConfig{Path: "feed.db"},
+	DB:             dbConfig{Type: "sqlite", Path: "portier.db", Username: "portier", Password: "portier", Host: "localhost", Port: 3306, DBName: "portier"},
+	Telegram:       bot.Config{Token: "", Webhook: bot.WebhookConfig{Listen: ":8443"}},
+	Template:       "",
+	DigestTemplate: "",
+	Log:            logConfig{Mode: "", Path: ""},
+	BuntDB:         buntDBConfig{Path: "feed.db"},
+	Poller: pollerConfig{
+		WorkerCount:     8,
+		PerHostLimit:    2,
+		DefaultInterval: 5 * time.Minute,
+		MinInterval:     2 * time.Minute,
+		MaxInterval:     24 * time.Hour,
+		MaxErrorCount:   10,
+	},
+	Broadcast: broadcastConfig{WorkerCount: 4},
 	Telegraph: telegraphConfig{
 		Account:   1,
 		ShortName: "Portier",
 		Author:    "Portier",
 		AuthorURL: "https://github.com/TechMinerApps/portier",
 	},
+	WebSub: webSubConfig{
+		Listen: ":8080",
+		Lease:  websub.DefaultLease,
+	},
 }
 
 // Config is the configuration used in viper
 type Config struct {
-	DB        dbConfig
-	Telegram  bot.Config
-	Template  string
-	Log       logConfig
-	BuntDB    buntDBConfig
-	Telegraph telegraphConfig
+	DB             dbConfig
+	Telegram       bot.Config
+	Template       string
+	DigestTemplate string
+	Log            logConfig
+	BuntDB         buntDBConfig
+	Poller         pollerConfig
+	Broadcast      broadcastConfig
+	Telegraph      telegraphConfig
+	WebSub         webSubConfig
 }
 
 type logConfig struct {
@@ -46,9 +67,27 @@ type dbConfig struct {
 type buntDBConfig struct {
 	Path string
 }
+type pollerConfig struct {
+	WorkerCount     int
+	PerHostLimit    int
+	DefaultInterval time.Duration
+	MinInterval     time.Duration
+	MaxInterval     time.Duration
+	MaxErrorCount   uint
+}
+type broadcastConfig struct {
+	WorkerCount int
+}
 type telegraphConfig struct {
 	Account   int
 	ShortName string
 	Author    string
 	AuthorURL string
 }
+
+// webSubConfig is disabled if CallbackURL is empty
+type webSubConfig struct {
+	Listen      string
+	CallbackURL string
+	Lease       time.Duration
+}
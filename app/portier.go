@@ -10,6 +10,7 @@ import (
 	"github.com/TechMinerApps/portier/modules/bot"
 	"github.com/TechMinerApps/portier/modules/log"
 	"github.com/TechMinerApps/portier/modules/telegraph"
+	"github.com/TechMinerApps/portier/modules/websub"
 
 	"github.com/TechMinerApps/portier/modules/database"
 	"github.com/TechMinerApps/portier/modules/feed"
@@ -26,6 +27,7 @@ type Portier struct {
 	memDB       *buntdb.DB
 	poller      feed.Poller
 	broadcaster feed.BroadCaster
+	websub      websub.Subscriber
 	bot         bot.Bot
 	viper       *viper.Viper
 	logger      log.Logger
@@ -64,14 +66,24 @@ func (p *Portier) Start() {
 	go p.bot.Start()
 	p.logger.Infof("Telegram Bot Started")
 
-	// Start poller
-	p.poller.Start()
-	p.logger.Infof("Feed poller started")
-
 	// Start Broadcaster
+	// before poller so it can replay outbox left by last run
 	p.broadcaster.Start()
 	p.logger.Infof("Broadcaster started")
 
+	// Start WebSub callback server
+	// before poller so pushes of subscribed sources are received
+	if p.websub != nil {
+		if err := p.websub.Start(); err != nil {
+			p.logger.Fatalf("Error starting WebSub subscriber: %s", err.Error())
+		}
+		p.logger.Infof("WebSub subscriber started")
+	}
+
+	// Start poller
+	p.poller.Start()
+	p.logger.Infof("Feed poller started")
+
 	// Add waitgroup
 	p.wg.Add(1)
 
@@ -82,6 +94,24 @@ func (p *Portier) Start() {
 // can accept a list of signals, print them if provided
 func (p *Portier) Stop(sig ...os.Signal) {
 
+	// Stop receiving updates
+	p.bot.Stop()
+
+	// Stop receiving pushes before closing databases
+	if p.websub != nil {
+		if err := p.websub.Stop(); err != nil {
+			p.logger.Errorf("Error stopping WebSub subscriber: %s", err.Error())
+		}
+	}
+
+	// Wait for running polls, this closes the feed channel
+	if err := p.poller.Stop(); err != nil {
+		p.logger.Errorf("Error stopping poller: %s", err.Error())
+	}
+
+	// Wait for running deliveries so they are marked done before closing databases
+	p.broadcaster.Stop()
+
 	// Close buntdb
 	p.memDB.Close()
 
@@ -155,8 +185,16 @@ func (p *Portier) setupDB() {
 		p.logger.Fatalf("Error setting up database: %s", err.Error())
 	}
 
+	// Subscription carries settings of user_sources join table
+	if err := p.db.SetupJoinTable(&models.User{}, "Sources", &models.Subscription{}); err != nil {
+		p.logger.Fatalf("Error setting up database: %s", err.Error())
+	}
+	if err := p.db.SetupJoinTable(&models.Source{}, "Users", &models.Subscription{}); err != nil {
+		p.logger.Fatalf("Error setting up database: %s", err.Error())
+	}
+
 	// Create table if not exist
-	p.db.AutoMigrate(&models.User{}, &models.Source{})
+	p.db.AutoMigrate(&models.User{}, &models.Source{}, &models.Subscription{}, &models.TelegraphAccount{}, &models.Content{}, &models.PushSubscription{}, &models.Template{})
 }
 
 func (p *Portier) setupBuntDB() {
@@ -176,14 +214,39 @@ func (p *Portier) setupFeedComponent() {
 	var sourcePool []*models.Source
 
 	// Load sources into var sourcePool
-	p.db.Model(&models.Source{}).Find(&sourcePool)
+	// disabled sources wait for /retry
+	p.db.Model(&models.Source{}).Where("disabled = ?", false).Find(&sourcePool)
+
+	// Setup WebSub subscriber if it has a public callback
+	if p.config.WebSub.CallbackURL != "" {
+		p.websub, err = websub.NewSubscriber(&websub.Config{
+			DB:          p.db,
+			Listen:      p.config.WebSub.Listen,
+			CallbackURL: p.config.WebSub.CallbackURL,
+			Lease:       p.config.WebSub.Lease,
+			OnContent:   p.onPush,
+			Logger:      p.logger,
+		})
+		if err != nil {
+			p.logger.Fatalf("Error creating WebSub subscriber: %s", err.Error())
+		}
+	}
 
 	// Setup poller
 	pollerConfig := &feed.PollerConfig{
-		SourcePool:  sourcePool,
-		DB:          p.memDB,
-		FeedChannel: feedChan,
-		Logger:      p.logger,
+		SourcePool:      sourcePool,
+		DB:              p.db,
+		MemDB:           p.memDB,
+		FeedChannel:     feedChan,
+		WorkerCount:     p.config.Poller.WorkerCount,
+		PerHostLimit:    p.config.Poller.PerHostLimit,
+		DefaultInterval: p.config.Poller.DefaultInterval,
+		MinInterval:     p.config.Poller.MinInterval,
+		MaxInterval:     p.config.Poller.MaxInterval,
+		MaxErrorCount:   p.config.Poller.MaxErrorCount,
+		OnDisable:       p.onSourceDisabled,
+		WebSub:          p.websub,
+		Logger:          p.logger,
 	}
 	p.poller, err = feed.NewPoller(pollerConfig)
 	if err != nil {
@@ -197,14 +260,25 @@ func (p *Portier) setupFeedComponent() {
 	// Then setup broadcaster
 	// Broadcaster rely on bot to broadcast
 	broadcasterConfig := &feed.BroadCastConfig{
-		DB:          p.db,
-		MemDB:       p.memDB,
-		WorkerCount: 1,
-		FeedChannel: feedChan,
-		Bot:         p.bot.Bot(),
-		Logger:      p.logger,
-		Template:    p.config.Template,
-		Telegraph:   &telegraph.Config{AccountNumber: p.config.Telegraph.Account, ShortName: p.config.Telegraph.ShortName, AuthorName: p.config.Telegraph.Author, AuthorURL: p.config.Telegraph.AuthorURL, AccessToken: []string{}, Logger: p.logger},
+		DB:             p.db,
+		MemDB:          p.memDB,
+		WorkerCount:    p.config.Broadcast.WorkerCount,
+		FeedChannel:    feedChan,
+		Bot:            p.bot.Bot(),
+		Logger:         p.logger,
+		Template:       p.config.Template,
+		DigestTemplate: p.config.DigestTemplate,
+		Markup:         p.bot.Markup,
+		Telegraph: &telegraph.Config{
+			AccountNumber:    p.config.Telegraph.Account,
+			ShortName:        p.config.Telegraph.ShortName,
+			AuthorName:       p.config.Telegraph.Author,
+			AuthorURL:        p.config.Telegraph.AuthorURL,
+			AccessToken:      p.telegraphTokens(),
+			Logger:           p.logger,
+			DB:               p.db,
+			OnAccountCreated: p.onTelegraphAccountCreated,
+		},
 	}
 	p.broadcaster, err = feed.NewBroadcaster(broadcasterConfig)
 	if err != nil {
@@ -213,6 +287,42 @@ func (p *Portier) setupFeedComponent() {
 
 }
 
+// telegraphTokens loads tokens of Telegraph accounts created before
+func (p *Portier) telegraphTokens() []string {
+	var accounts []models.TelegraphAccount
+	if err := p.db.Order("id").Find(&accounts).Error; err != nil {
+		p.logger.Fatalf("Error loading Telegraph accounts: %s", err.Error())
+	}
+	tokens := []string{}
+	for _, a := range accounts {
+		tokens = append(tokens, a.AccessToken)
+	}
+	return tokens
+}
+
+// onTelegraphAccountCreated saves token of a new Telegraph account
+func (p *Portier) onTelegraphAccountCreated(token string) {
+	if err := p.db.Create(&models.TelegraphAccount{AccessToken: token}).Error; err != nil {
+		p.logger.Errorf("Error saving Telegraph account: %s", err.Error())
+	}
+}
+
+// onSourceDisabled tells subscribers that poller gave up a source
+func (p *Portier) onSourceDisabled(s *models.Source) {
+	message := fmt.Sprintf("Feed [%d] \"%s\" is disabled after %d failed updates\nuse /retry %d to enable it again",
+		s.ID, s.Title, s.ErrorCount, s.ID)
+	if err := p.bot.Notify(s, message); err != nil {
+		p.logger.Errorf("Error notifying subscribers of %s: %s", s.Title, err.Error())
+	}
+}
+
+// onPush hands content pushed by a hub to poller
+func (p *Portier) onPush(sourceID uint, body []byte) {
+	if err := p.poller.Push(sourceID, body); err != nil {
+		p.logger.Warnf("Error handling content pushed for source %d: %s", sourceID, err.Error())
+	}
+}
+
 func (p *Portier) setupViper() {
 	p.viper = viper.New()
 
@@ -0,0 +1,53 @@
+package app
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/TechMinerApps/portier/models"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func Test_Portier_telegraphTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "portier.db")
+
+	// start opens the database like a new run of portier
+	start := func() *Portier {
+		db, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			sqlDB, _ := db.DB()
+			sqlDB.Close()
+		})
+		if err := db.AutoMigrate(&models.TelegraphAccount{}); err != nil {
+			t.Fatal(err)
+		}
+		return &Portier{db: db, logger: zap.NewNop().Sugar()}
+	}
+
+	// First run has no account, created ones are saved
+	p := start()
+	if tokens := p.telegraphTokens(); len(tokens) != 0 {
+		t.Fatalf("telegraphTokens() = %v on first run, want none", tokens)
+	}
+	p.onTelegraphAccountCreated("a")
+	p.onTelegraphAccountCreated("b")
+
+	// Next run loads them in order of creation, they are passed to telegraph as AccessToken
+	p = start()
+	want := []string{"a", "b"}
+	if tokens := p.telegraphTokens(); !reflect.DeepEqual(tokens, want) {
+		t.Fatalf("telegraphTokens() = %v after restart, want %v", tokens, want)
+	}
+
+	// Saving a token again keeps one account
+	p.onTelegraphAccountCreated("a")
+	if tokens := p.telegraphTokens(); !reflect.DeepEqual(tokens, want) {
+		t.Errorf("telegraphTokens() = %v after saving a token again, want %v", tokens, want)
+	}
+}
@@ -5,13 +5,16 @@ import (
 	"os/signal"
 	"syscall"
 
+	// Time zones of users work without tzdata on the system
+	_ "time/tzdata"
+
 	"github.com/TechMinerApps/portier/app"
 )
 
 func main() {
 	app := app.NewPortier()
 	app.Start()
-	sigchan := make(chan os.Signal)
+	sigchan := make(chan os.Signal, 1)
 	signal.Notify(sigchan,
 		syscall.SIGINT,
 		syscall.SIGTERM,
@@ -1,12 +1,25 @@
 package models
 
 // Content is a single passage crawled from feed
+// it keeps the Telegraph page published for a feed item
 type Content struct {
-	ID           uint64 `gorm:"primaryKey"`
-	HashID       string `gorm:"primaryKey"`
+	ID uint64 `gorm:"primaryKey"`
+
+	// HashID is the FeedID of the item
+	HashID       string `gorm:"uniqueIndex;size:64"`
 	SourceURL    string
 	Title        string
-	FeedID       uint64
 	Description  string `gorm:"-"` //ignore to db
 	TelegraphURL string
+
+	// TelegraphPath is the path of page used to edit it
+	TelegraphPath string
+
+	// ContentHash is the hash of published content
+	// page is edited when content of the item changes
+	ContentHash string
+
+	// AccessToken is the token of account owning the page
+	// only the owner can edit a page
+	AccessToken string `gorm:"size:128"`
 }
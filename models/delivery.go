@@ -0,0 +1,15 @@
+package models
+
+// Delivery modes of subscriptions
+// items of digest modes are collected and sent in one message on schedule
+const (
+	DeliveryInstant = "instant"
+	DeliveryHourly  = "hourly"
+	DeliveryDaily   = "daily"
+	DeliveryWeekly  = "weekly"
+)
+
+// IsDigest reports whether mode collects items into digests
+func IsDigest(mode string) bool {
+	return mode == DeliveryHourly || mode == DeliveryDaily || mode == DeliveryWeekly
+}
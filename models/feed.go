@@ -1,11 +1,55 @@
 package models
 
-import "github.com/mmcdole/gofeed"
+import (
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// TelegraphStatus tells whether a feed item got a Telegraph page
+const (
+	TelegraphPublished = "published"
+	TelegraphDisabled  = "disabled"
+	TelegraphFailed    = "failed"
+)
 
 // Feed is a struct used in communication between Poller and other modules
 type Feed struct {
 	SourceID     uint
 	FeedID       string
 	TelegraphURL string
-	Item         *gofeed.Item
+
+	// TelegraphStatus is one of the Telegraph constants, empty if not published yet
+	TelegraphStatus string
+
+	Item *gofeed.Item
+
+	// Location is the time zone of the chat rendered for, UTC if nil
+	Location *time.Location `json:"-"`
+}
+
+// HasTelegraph reports whether TelegraphURL can be used
+// templates use it to fall back to the original link
+func (f *Feed) HasTelegraph() bool {
+	return f.TelegraphStatus == TelegraphPublished && f.TelegraphURL != ""
+}
+
+// Published returns when the item was published, or updated if unknown, in Location
+// templates format it like {{ .Published.Format "Jan 2 15:04" }}
+// zero time is returned if neither is known
+func (f *Feed) Published() time.Time {
+	if f.Item == nil {
+		return time.Time{}
+	}
+	t := f.Item.PublishedParsed
+	if t == nil {
+		t = f.Item.UpdatedParsed
+	}
+	if t == nil {
+		return time.Time{}
+	}
+	if f.Location == nil {
+		return t.UTC()
+	}
+	return t.In(f.Location)
 }
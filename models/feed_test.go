@@ -0,0 +1,46 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestFeed_Published(t *testing.T) {
+	published := time.Date(2021, 6, 2, 14, 30, 0, 0, time.UTC)
+	tokyo := time.FixedZone("JST", 9*60*60)
+	tests := []struct {
+		name string
+		feed Feed
+		want string
+	}{
+		{
+			name: "UTC by default",
+			feed: Feed{Item: &gofeed.Item{PublishedParsed: &published}},
+			want: "2021-06-02 14:30",
+		},
+		{
+			name: "In location",
+			feed: Feed{Item: &gofeed.Item{PublishedParsed: &published}, Location: tokyo},
+			want: "2021-06-02 23:30",
+		},
+		{
+			name: "Updated if not published",
+			feed: Feed{Item: &gofeed.Item{UpdatedParsed: &published}, Location: tokyo},
+			want: "2021-06-02 23:30",
+		},
+		{
+			name: "Unknown",
+			feed: Feed{Item: &gofeed.Item{}},
+			want: "0001-01-01 00:00",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.feed.Published().Format("2006-01-02 15:04"); got != tt.want {
+				t.Errorf("Feed.Published() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// PushSubscription is a WebSub subscription of a source to its hub
+type PushSubscription struct {
+	ID       uint `gorm:"primaryKey"`
+	SourceID uint `gorm:"uniqueIndex"`
+	Hub      string
+	Topic    string
+
+	// Secret signs content pushed by hub
+	Secret string
+
+	// RequestedAt is the time of last subscription request to hub
+	RequestedAt time.Time
+
+	// Nonce is put in the callback of a pending request
+	// hub must verify with it, it is cleared once verified
+	Nonce string
+
+	// ExpiresAt is the end of lease verified by hub, zero before verification
+	// source is polled again once the lease expires
+	ExpiresAt time.Time
+}
@@ -1,5 +1,16 @@
 package models
 
+import "time"
+
+// Kinds of sources
+const (
+	// SourceFeed is a RSS, Atom or JSON feed
+	SourceFeed = "feed"
+
+	// SourceScrape is a HTML page scraped with CSS selectors in Selector
+	SourceScrape = "scrape"
+)
+
 type Source struct {
 	ID             uint    `gorm:"primaryKey;AUTO_INCREMENT"`
 	Users          []*User `gorm:"many2many:user_sources"`
@@ -7,4 +18,31 @@ type Source struct {
 	Title          string
 	UpdateInterval uint
 	ErrorCount     uint
+
+	// Kind is one of the Source constants
+	Kind string `gorm:"size:16;default:feed"`
+
+	// Selector is the JSON scrape spec of scrape sources
+	Selector string
+
+	// Disabled sources are not polled until retried
+	Disabled bool
+
+	// DisableTelegraph sends items with original link only
+	DisableTelegraph bool
+
+	// FullText fetches links of items with short content
+	// and extracts the article body from the page
+	FullText bool
+
+	// FixedInterval keeps UpdateInterval set by user instead of learning it from the feed
+	FixedInterval bool
+
+	// LastPolledAt is when source was last fetched or pushed successfully
+	LastPolledAt time.Time
+
+	// ETag and LastModified are the validators returned by the last fetch
+	// they are sent back as If-None-Match and If-Modified-Since
+	ETag         string `gorm:"column:etag"`
+	LastModified string
 }
@@ -0,0 +1,27 @@
+package models
+
+// Subscription is the join model of users and sources
+// it holds settings of a user's subscription to a source
+// UserID is the target chat, which can be a channel or group
+type Subscription struct {
+	UserID   int64 `gorm:"primaryKey"`
+	SourceID uint  `gorm:"primaryKey"`
+
+	// ManagerID is the Telegram user who subscribed the chat
+	// it differs from the chat for channels and groups
+	ManagerID int64
+
+	// Filter holds include and exclude rules, see modules/filter
+	Filter string
+
+	// Paused stops sending items of the source to the chat
+	Paused bool
+
+	// Delivery overrides delivery mode of the user, empty follows it
+	Delivery string
+}
+
+// TableName keeps the table created by many2many tag
+func (Subscription) TableName() string {
+	return "user_sources"
+}
@@ -0,0 +1,8 @@
+package models
+
+// TelegraphAccount is a Telegraph account created by portier
+// tokens are kept so pages stay owned by the same accounts across restarts
+type TelegraphAccount struct {
+	ID          uint   `gorm:"primaryKey"`
+	AccessToken string `gorm:"uniqueIndex;size:128"`
+}
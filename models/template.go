@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Template is a message template uploaded with /template
+// it applies to a subscription if both UserID and SourceID are set,
+// to every item of a chat if SourceID is zero,
+// or to every chat of a source if UserID is zero, set by bot admins
+type Template struct {
+	ID       uint  `gorm:"primaryKey"`
+	UserID   int64 `gorm:"uniqueIndex:idx_template_scope"`
+	SourceID uint  `gorm:"uniqueIndex:idx_template_scope"`
+
+	// Text is a Go template executed with Feed
+	Text string
+
+	UpdatedAt time.Time
+}
+
+// Specificity ranks templates, the highest one of an item is used
+// a subscription is more specific than a source, which is more than a chat
+func (t *Template) Specificity() int {
+	switch {
+	case t.UserID != 0 && t.SourceID != 0:
+		return 3
+	case t.SourceID != 0:
+		return 2
+	default:
+		return 1
+	}
+}
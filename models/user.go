@@ -1,7 +1,88 @@
 package models
 
+import "time"
+
+// QuietMode decides what happens to items during quiet hours
+const (
+	// QuietSilent sends items without notification, it is the default
+	QuietSilent = "silent"
+
+	// QuietQueue holds items until quiet hours end
+	QuietQueue = "queue"
+)
+
 type User struct {
 	ID         int64 `gorm:"primaryKey"`
 	TelegramID int64
 	Sources    []*Source `gorm:"many2many:user_sources"`
+
+	// Inactive is set when the chat blocked or removed the bot
+	// subscriptions are paused until /start is sent again
+	Inactive bool
+
+	// Delivery is the default delivery mode of subscriptions, empty is instant
+	Delivery string
+
+	// DigestTime is when daily and weekly digests are sent, in minutes after midnight
+	DigestTime int
+
+	// DigestWeekday is the day weekly digests are sent, 0 is Sunday
+	DigestWeekday int
+
+	// TimeZone is an IANA name like Asia/Shanghai, empty is UTC
+	// digest times, quiet hours and item timestamps are in it
+	TimeZone string
+
+	// QuietStart and QuietEnd bound quiet hours in minutes after midnight
+	// the window can cross midnight, there are none if they are equal
+	QuietStart int
+	QuietEnd   int
+
+	// QuietMode is one of the Quiet constants, empty is QuietSilent
+	QuietMode string
+
+	// Audible sends items with notification outside quiet hours
+	Audible bool
+}
+
+// Location returns time zone of the user, UTC if unknown
+func (u *User) Location() *time.Location {
+	if u.TimeZone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(u.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// QuietUntil reports whether now is in quiet hours and when they end
+func (u *User) QuietUntil(now time.Time) (time.Time, bool) {
+	if u.QuietStart == u.QuietEnd {
+		return time.Time{}, false
+	}
+	local := now.In(u.Location())
+	minute := local.Hour()*60 + local.Minute()
+	quiet := minute >= u.QuietStart && minute < u.QuietEnd
+	if u.QuietStart > u.QuietEnd {
+		quiet = minute >= u.QuietStart || minute < u.QuietEnd
+	}
+	if !quiet {
+		return time.Time{}, false
+	}
+	end := time.Date(local.Year(), local.Month(), local.Day(), u.QuietEnd/60, u.QuietEnd%60, 0, 0, local.Location())
+	if !end.After(now) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return end, true
+}
+
+// Silent reports whether messages sent at now should not notify
+func (u *User) Silent(now time.Time) bool {
+	if !u.Audible {
+		return true
+	}
+	_, quiet := u.QuietUntil(now)
+	return quiet
 }
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUser_QuietUntil(t *testing.T) {
+	// 23:30 in Tokyo
+	now := time.Date(2021, 6, 2, 14, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		user      User
+		wantQuiet bool
+		wantUntil time.Time
+	}{
+		{
+			name:      "No quiet hours",
+			user:      User{},
+			wantQuiet: false,
+		},
+		{
+			name:      "Within window",
+			user:      User{QuietStart: 14 * 60, QuietEnd: 15 * 60},
+			wantQuiet: true,
+			wantUntil: time.Date(2021, 6, 2, 15, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "Outside window",
+			user:      User{QuietStart: 9 * 60, QuietEnd: 12 * 60},
+			wantQuiet: false,
+		},
+		{
+			name:      "Across midnight in time zone",
+			user:      User{TimeZone: "Asia/Tokyo", QuietStart: 23 * 60, QuietEnd: 7 * 60},
+			wantQuiet: true,
+			wantUntil: time.Date(2021, 6, 2, 22, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "Unknown time zone is UTC",
+			user:      User{TimeZone: "Mars/Olympus", QuietStart: 23 * 60, QuietEnd: 7 * 60},
+			wantQuiet: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			until, quiet := tt.user.QuietUntil(now)
+			if quiet != tt.wantQuiet {
+				t.Errorf("User.QuietUntil() quiet = %v, want %v", quiet, tt.wantQuiet)
+			}
+			if quiet && !until.Equal(tt.wantUntil) {
+				t.Errorf("User.QuietUntil() until = %v, want %v", until, tt.wantUntil)
+			}
+		})
+	}
+}
+
+func TestUser_Silent(t *testing.T) {
+	now := time.Date(2021, 6, 2, 14, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		user User
+		want bool
+	}{
+		{
+			name: "Silent by default",
+			user: User{},
+			want: true,
+		},
+		{
+			name: "Audible",
+			user: User{Audible: true},
+			want: false,
+		},
+		{
+			name: "Audible in quiet hours",
+			user: User{Audible: true, QuietStart: 14 * 60, QuietEnd: 15 * 60},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.user.Silent(now); got != tt.want {
+				t.Errorf("User.Silent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
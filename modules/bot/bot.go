@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/TechMinerApps/portier/models"
 	"github.com/TechMinerApps/portier/modules/feed"
 	"github.com/TechMinerApps/portier/modules/log"
 	"github.com/tidwall/buntdb"
@@ -16,6 +17,16 @@ import (
 type Config struct {
 	Token string
 	MemDB *buntdb.DB
+
+	// APIURL is the Telegram Bot API server, the official one if empty
+	APIURL string
+
+	// Webhook is used instead of long polling if its PublicURL is set
+	Webhook WebhookConfig
+
+	// Admins are Telegram user IDs allowed to set templates of feeds
+	// and to change settings of feeds other chats subscribe
+	Admins []int
 }
 
 // Bot is the control interface provided to portier main instance
@@ -29,6 +40,12 @@ type Bot interface {
 
 	// Bot return the original telebot.Bot object
 	Bot() *telebot.Bot
+
+	// Notify sends a plain text message to every subscriber of source
+	Notify(s *models.Source, message string) error
+
+	// Markup returns buttons of item sent to chat
+	Markup(item *models.Feed, chatID int64) *telebot.ReplyMarkup
 }
 
 // Portier interface is used to communicate to main instance
@@ -42,6 +59,12 @@ type bot struct {
 	app   Portier
 	bot   *telebot.Bot
 	memdb *buntdb.DB
+
+	// admins are Telegram user IDs of bot admins
+	admins []int
+
+	// webhook is nil when long polling
+	webhook *webhook
 }
 
 // NewBot create a bot according to config
@@ -51,21 +74,31 @@ func NewBot(c *Config, app Portier) (Bot, error) {
 	}
 	var err error
 	b := &bot{
-		app:   app,
-		bot:   &telebot.Bot{},
-		memdb: c.MemDB,
+		app:    app,
+		bot:    &telebot.Bot{},
+		memdb:  c.MemDB,
+		admins: c.Admins,
+	}
+	client := &http.Client{}
+	var poller telebot.Poller = &telebot.LongPoller{Timeout: 10 * time.Second}
+	if c.Webhook.PublicURL != "" {
+		b.webhook, err = newWebhook(c.Webhook, client, app.Logger())
+		if err != nil {
+			return nil, err
+		}
+		poller = b.webhook
 	}
 	b.bot, err = telebot.NewBot(telebot.Settings{
-		URL:         "",
+		URL:         c.APIURL,
 		Token:       c.Token,
 		Updates:     0,
-		Poller:      &telebot.LongPoller{Timeout: 10 * time.Second},
+		Poller:      poller,
 		Synchronous: false,
 		Verbose:     false,
 		ParseMode:   "",
 		Reporter: func(error) {
 		},
-		Client: &http.Client{},
+		Client: client,
 	})
 	if err != nil {
 		return nil, err
@@ -76,20 +109,73 @@ func NewBot(c *Config, app Portier) (Bot, error) {
 }
 
 func (b *bot) Start() {
+	// Long polling does not work while a webhook is set
+	if b.webhook == nil {
+		if err := b.bot.RemoveWebhook(); err != nil {
+			b.app.Logger().Errorf("Error removing webhook: %s", err.Error())
+		}
+	}
 	b.bot.Start()
 }
 
 func (b *bot) Stop() {
 	b.bot.Stop()
+
+	// Wait for webhook server to finish requests
+	if b.webhook != nil {
+		<-b.webhook.done
+	}
 }
 func (b *bot) Bot() *telebot.Bot {
 	return b.bot
 }
 
+// Notify sends message to chats subscribing s
+// paused subscriptions and chats which removed the bot are skipped
+func (b *bot) Notify(s *models.Source, message string) error {
+	var chatIDs []int64
+	err := b.app.DB().Model(&models.User{}).
+		Joins("JOIN user_sources ON user_sources.user_id = users.id").
+		Where("user_sources.source_id = ? AND user_sources.paused = ? AND users.inactive = ?", s.ID, false, false).
+		Pluck("users.telegram_id", &chatIDs).Error
+	if err != nil {
+		return err
+	}
+	for _, id := range chatIDs {
+		if _, err := b.bot.Send(&telebot.Chat{ID: id}, message); err != nil {
+			b.app.Logger().Errorf("Error sending message: %s", err.Error())
+		}
+	}
+	return nil
+}
+
 func (b *bot) configCommands() {
 	b.bot.Handle("/start", b.cmdStart)
 	b.bot.Handle("/sub", b.cmdSub)
+	b.bot.Handle(chooseFeedButton, b.onChooseFeed)
+	b.bot.Handle("/scrape", b.cmdScrape)
 	b.bot.Handle("/unsub", b.cmdUnSub)
+	b.bot.Handle(muteButton, b.onMute)
+	b.bot.Handle(unsubButton, b.onUnsubButton)
+	b.bot.Handle("/mute", b.cmdMute)
+	b.bot.Handle("/unmute", b.cmdUnmute)
+	b.bot.Handle("/digest", b.cmdDigest)
+	b.bot.Handle("/settings", b.cmdSettings)
+	b.bot.Handle("/template", b.cmdTemplate)
 	b.bot.Handle("/list", b.cmdList)
+	b.bot.Handle(listPageButton, b.onListPage)
+	b.bot.Handle(listSourceButton, b.onListSource)
+	b.bot.Handle(listPauseButton, b.onListPause)
+	b.bot.Handle(listUnsubButton, b.onListUnsub)
+	b.bot.Handle(listIntervalsButton, b.onListIntervals)
+	b.bot.Handle(listIntervalButton, b.onListInterval)
+	b.bot.Handle("/retry", b.cmdRetry)
+	b.bot.Handle("/filter", b.cmdFilter)
+	b.bot.Handle("/telegraph", b.cmdTelegraph)
+	b.bot.Handle("/fulltext", b.cmdFullText)
+	b.bot.Handle("/export", b.cmdExport)
+	b.bot.Handle("/import", b.cmdImport)
+	b.bot.Handle(telebot.OnDocument, b.onDocument)
+	b.bot.Handle(telebot.OnMigration, b.onMigration)
 	b.bot.Handle("/help", b.cmdHelp)
 }
@@ -0,0 +1,151 @@
+package bot
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/TechMinerApps/portier/models"
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+// Endpoints of buttons on broadcasted items
+// data of each button is <chat ID>|<source ID>
+var (
+	muteButton  = &telebot.InlineButton{Unique: "mute"}
+	unsubButton = &telebot.InlineButton{Unique: "unsub"}
+)
+
+// Markup returns buttons of item sent to chat
+// links open the original and Telegraph page, the others act on the subscription
+func (b *bot) Markup(item *models.Feed, chatID int64) *telebot.ReplyMarkup {
+	var links []telebot.InlineButton
+	if item.Item != nil && item.Item.Link != "" {
+		links = append(links, telebot.InlineButton{Text: "Original", URL: item.Item.Link})
+	}
+	if item.TelegraphURL != "" {
+		links = append(links, telebot.InlineButton{Text: "Telegraph", URL: item.TelegraphURL})
+	}
+
+	// Buttons are created for every message since telebot rewrites their data
+	data := strconv.FormatInt(chatID, 10) + "|" + strconv.Itoa(int(item.SourceID))
+	actions := []telebot.InlineButton{
+		{Unique: muteButton.Unique, Text: "Mute", Data: data},
+		{Unique: unsubButton.Unique, Text: "Unsubscribe", Data: data},
+	}
+
+	var rows [][]telebot.InlineButton
+	if len(links) > 0 {
+		rows = append(rows, links)
+	}
+	return &telebot.ReplyMarkup{InlineKeyboard: append(rows, actions)}
+}
+
+// onMute pauses the subscription of the item pressed on
+func (b *bot) onMute(c *telebot.Callback) {
+	b.app.Logger().Infof("Recieved mute button from user: \"%s\"", c.Sender.Username)
+	target, args, ok := b.callbackTarget(c)
+	if !ok {
+		return
+	}
+	sourceID, ok := b.sourceArg(c, args)
+	if !ok {
+		return
+	}
+	result := b.app.DB().Model(&models.Subscription{}).
+		Where("user_id = ? AND source_id = ?", target.ID, sourceID).
+		Update("paused", true)
+	if result.Error != nil {
+		b.app.Logger().Errorf("Database error: %s", result.Error.Error())
+		b.Bot().Respond(c, &telebot.CallbackResponse{Text: "Database error"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		b.Bot().Respond(c, &telebot.CallbackResponse{Text: "Feed not subscribed"})
+		return
+	}
+	b.Bot().Respond(c, &telebot.CallbackResponse{
+		Text:      "Feed muted, use /unmute " + mentionOf(c.Message.Chat) + strconv.Itoa(int(sourceID)) + " to resume",
+		ShowAlert: true,
+	})
+}
+
+// onUnsubButton unsubscribes from the source of the item pressed on
+func (b *bot) onUnsubButton(c *telebot.Callback) {
+	b.app.Logger().Infof("Recieved unsubscribe button from user: \"%s\"", c.Sender.Username)
+	target, args, ok := b.callbackTarget(c)
+	if !ok {
+		return
+	}
+	sourceID, ok := b.sourceArg(c, args)
+	if !ok {
+		return
+	}
+	removed, err := b.unsubscribe(target, sourceID)
+	if err != nil {
+		b.app.Logger().Errorf("Database error: %s", err.Error())
+		b.Bot().Respond(c, &telebot.CallbackResponse{Text: "Database error"})
+		return
+	}
+	if !removed {
+		b.Bot().Respond(c, &telebot.CallbackResponse{Text: "Feed not subscribed"})
+		return
+	}
+	b.app.Logger().Infof("Removed feed %d from chat %d by user %d", sourceID, target.TelegramID, c.Sender.ID)
+	b.Bot().Respond(c, &telebot.CallbackResponse{Text: "Feed unsubscribed"})
+}
+
+// callbackTarget finds chat of a button whose data is <chat ID>|<args>...
+// the chat can differ from where the button is, like lists of channels
+// only admins can press them for groups and channels
+func (b *bot) callbackTarget(c *telebot.Callback) (*models.User, []string, bool) {
+	parts := strings.Split(c.Data, "|")
+	if len(parts) < 2 || c.Message == nil {
+		b.Bot().Respond(c, &telebot.CallbackResponse{Text: "Illegal button"})
+		return nil, nil, false
+	}
+	chatID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		b.Bot().Respond(c, &telebot.CallbackResponse{Text: "Illegal button"})
+		return nil, nil, false
+	}
+
+	// Private chats belong to the user, IDs of them are the same
+	if chatID != int64(c.Sender.ID) {
+		admin, _, err := b.adminsOf(&telebot.Chat{ID: chatID}, c.Sender.ID)
+		if err != nil {
+			b.app.Logger().Errorf("Error getting admins of chat %d: %s", chatID, err.Error())
+			b.Bot().Respond(c, &telebot.CallbackResponse{Text: "Error getting admins"})
+			return nil, nil, false
+		}
+		if !admin {
+			b.Bot().Respond(c, &telebot.CallbackResponse{Text: "Only admins can manage subscriptions"})
+			return nil, nil, false
+		}
+	}
+
+	target, err := b.getUser(chatID)
+	if err != nil {
+		b.app.Logger().Errorf("Error finding chat %d: %s", chatID, err.Error())
+		b.Bot().Respond(c, &telebot.CallbackResponse{Text: "Chat ID not registered"})
+		return nil, nil, false
+	}
+	return target, parts[1:], true
+}
+
+// sourceArg parses the source ID in args of a button
+func (b *bot) sourceArg(c *telebot.Callback, args []string) (uint, bool) {
+	sourceID, err := strconv.Atoi(args[0])
+	if err != nil {
+		b.Bot().Respond(c, &telebot.CallbackResponse{Text: "Illegal button"})
+		return 0, false
+	}
+	return uint(sourceID), true
+}
+
+// mentionOf returns "@username " of channels to put in commands
+func mentionOf(chat *telebot.Chat) string {
+	if chat.Type == telebot.ChatChannel && chat.Username != "" {
+		return "@" + chat.Username + " "
+	}
+	return ""
+}
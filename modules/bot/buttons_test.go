@@ -0,0 +1,152 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/TechMinerApps/portier/models"
+	"github.com/mmcdole/gofeed"
+	"github.com/tidwall/buntdb"
+	"gopkg.in/tucnak/telebot.v2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func Test_bot_Markup(t *testing.T) {
+	tests := []struct {
+		name string
+		item *models.Feed
+		want [][]string
+	}{
+		{
+			name: "Original and Telegraph",
+			item: &models.Feed{SourceID: 3, Item: &gofeed.Item{Link: "https://example.com/1"}, TelegraphURL: "https://telegra.ph/1"},
+			want: [][]string{{"Original", "Telegraph"}, {"Mute", "Unsubscribe"}},
+		},
+		{
+			name: "Telegraph failed",
+			item: &models.Feed{SourceID: 3, Item: &gofeed.Item{Link: "https://example.com/1"}},
+			want: [][]string{{"Original"}, {"Mute", "Unsubscribe"}},
+		},
+		{
+			name: "No link",
+			item: &models.Feed{SourceID: 3, Item: &gofeed.Item{}},
+			want: [][]string{{"Mute", "Unsubscribe"}},
+		},
+	}
+	b := &bot{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			markup := b.Markup(tt.item, -100)
+			var got [][]string
+			for _, row := range markup.InlineKeyboard {
+				var texts []string
+				for _, button := range row {
+					texts = append(texts, button.Text)
+					if button.Unique != "" && button.Data != "-100|3" {
+						t.Errorf("bot.Markup() data of %s = %q, want %q", button.Text, button.Data, "-100|3")
+					}
+				}
+				got = append(got, texts)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("bot.Markup() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_bot_onMute(t *testing.T) {
+	api := newFakeAPI(map[string]string{
+		"getChatAdministrators": `[{"user":{"id":7},"status":"creator"}]`,
+	})
+	defer api.Close()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Subscription{}); err != nil {
+		t.Fatal(err)
+	}
+	private := models.User{TelegramID: 7}
+	group := models.User{TelegramID: -1}
+	db.Create(&private)
+	db.Create(&group)
+	db.Create(&models.Subscription{UserID: private.ID, SourceID: 3})
+	db.Create(&models.Subscription{UserID: group.ID, SourceID: 3})
+	memdb, err := buntdb.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer memdb.Close()
+	bb, err := NewBot(&Config{Token: "token", MemDB: memdb, APIURL: api.URL}, fakePortier{db: db})
+	if err != nil {
+		t.Fatalf("NewBot() error = %v", err)
+	}
+	b := bb.(*bot)
+
+	tests := []struct {
+		name      string
+		chat      *telebot.Chat
+		sender    int
+		data      string
+		wantReply string
+	}{
+		{
+			name:      "Private chat",
+			chat:      &telebot.Chat{ID: 7, Type: telebot.ChatPrivate},
+			sender:    7,
+			data:      "7|3",
+			wantReply: "Feed muted, use /unmute 3 to resume",
+		},
+		{
+			name:      "Data of another user",
+			chat:      &telebot.Chat{ID: 9, Type: telebot.ChatPrivate},
+			sender:    9,
+			data:      "7|3",
+			wantReply: "Only admins can manage subscriptions",
+		},
+		{
+			name:      "Illegal data",
+			chat:      &telebot.Chat{ID: 7, Type: telebot.ChatPrivate},
+			sender:    7,
+			data:      "7",
+			wantReply: "Illegal button",
+		},
+		{
+			name:      "Group member",
+			chat:      &telebot.Chat{ID: -1, Type: telebot.ChatGroup},
+			sender:    9,
+			data:      "-1|3",
+			wantReply: "Only admins can manage subscriptions",
+		},
+		{
+			name:      "Not subscribed",
+			chat:      &telebot.Chat{ID: 7, Type: telebot.ChatPrivate},
+			sender:    7,
+			data:      "7|4",
+			wantReply: "Feed not subscribed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b.onMute(&telebot.Callback{
+				ID:      "1",
+				Sender:  &telebot.User{ID: tt.sender},
+				Message: &telebot.Message{Chat: tt.chat},
+				Data:    tt.data,
+			})
+			params := api.wait(t, "answerCallbackQuery")
+			if params["text"] != tt.wantReply {
+				t.Errorf("bot.onMute() answered %q, want %q", params["text"], tt.wantReply)
+			}
+		})
+	}
+
+	var paused []models.Subscription
+	db.Where("paused = ?", true).Find(&paused)
+	if len(paused) != 1 || paused[0].UserID != private.ID {
+		t.Errorf("bot.onMute() paused %v, want only subscription of chat 7", paused)
+	}
+}
@@ -2,6 +2,7 @@ package bot
 
 import (
 	"github.com/TechMinerApps/portier/models"
+	"github.com/TechMinerApps/portier/modules/feed"
 	"gopkg.in/tucnak/telebot.v2"
 )
 
@@ -12,6 +13,26 @@ func (b *bot) cmdStart(m *telebot.Message) {
 	if err := b.app.DB().Where(&user).FirstOrCreate(&user).Error; err != nil {
 		b.app.Logger().Errorf("Database error: %s", err.Error())
 	}
+
+	// Resume subscriptions paused after the bot was blocked
+	if user.Inactive {
+		if err := b.app.DB().Model(&user).Update("inactive", false).Error; err != nil {
+			b.app.Logger().Errorf("Database error: %s", err.Error())
+			b.Bot().Send(m.Chat, "Database error")
+			return
+		}
+		b.app.Logger().Infof("User \"%s\" with ID %d reactivated", m.Sender.Username, m.Chat.ID)
+		b.Bot().Send(m.Chat, "Welcome back to portier\nyour subscriptions are resumed")
+		return
+	}
 	b.app.Logger().Infof("New user \"%s\" registered into database with ID: %d", m.Sender.Username, m.Chat.ID)
 	b.Bot().Send(m.Chat, "Welcome to portier\nuse /help to check usage")
 }
+
+// onMigration moves subscriptions of a group upgraded to supergroup
+func (b *bot) onMigration(from, to int64) {
+	b.app.Logger().Infof("Chat %d migrated to %d", from, to)
+	if err := feed.MigrateChat(b.app.DB(), b.memdb, from, to); err != nil {
+		b.app.Logger().Errorf("Error migrating chat %d: %s", from, err.Error())
+	}
+}
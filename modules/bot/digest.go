@@ -0,0 +1,168 @@
+package bot
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TechMinerApps/portier/models"
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+// deliverySetting is a delivery mode parsed from /digest
+// time and weekday are kept as they were if not set
+type deliverySetting struct {
+	mode       string
+	minute     int
+	weekday    time.Weekday
+	hasTime    bool
+	hasWeekday bool
+}
+
+// cmdDigest sets delivery mode of the chat or one subscription
+// usage: /digest [@channel] [ID] instant|hourly|daily [HH:MM]|weekly [DAY] [HH:MM]|default
+func (b *bot) cmdDigest(m *telebot.Message) {
+	b.app.Logger().Infof("Recieved /digest commmand from user: \"%s\"", m.Sender.Username)
+	mention, args := splitMention(strings.Fields(m.Payload))
+	target, ok := b.target(m, mention)
+	if !ok {
+		return
+	}
+	if len(args) == 0 {
+		b.Bot().Send(m.Chat, "Delivery mode: "+describeDelivery(target)+"\n"+
+			"Usage: /digest [@channel] [ID] instant|hourly|daily [HH:MM]|weekly [DAY] [HH:MM]")
+		return
+	}
+
+	var sub *models.Subscription
+	if sourceID, err := strconv.Atoi(args[0]); err == nil {
+		if sub, err = b.getSubscription(target, uint(sourceID)); err != nil {
+			b.replySubscriptionError(m, err)
+			return
+		}
+		args = args[1:]
+	}
+	setting, err := parseDelivery(args, sub != nil)
+	if err != nil {
+		b.app.Logger().Infof("/digest command received illegal input: %s", m.Payload)
+		b.Bot().Send(m.Chat, err.Error())
+		return
+	}
+
+	// Time and weekday belong to the chat, shared by all its digests
+	updates := map[string]interface{}{}
+	if setting.hasTime {
+		updates["digest_time"] = setting.minute
+	}
+	if setting.hasWeekday {
+		updates["digest_weekday"] = int(setting.weekday)
+	}
+	if sub == nil {
+		updates["delivery"] = setting.mode
+	}
+	if len(updates) > 0 {
+		if err := b.app.DB().Model(target).Updates(updates).Error; err != nil {
+			b.app.Logger().Errorf("Database error: %s", err.Error())
+			b.Bot().Send(m.Chat, "Database error")
+			return
+		}
+	}
+	if sub == nil {
+		b.Bot().Send(m.Chat, "Delivery mode set to "+describeDelivery(target))
+		return
+	}
+
+	if err := b.app.DB().Model(sub).Update("delivery", setting.mode).Error; err != nil {
+		b.app.Logger().Errorf("Database error: %s", err.Error())
+		b.Bot().Send(m.Chat, "Database error")
+		return
+	}
+	if setting.mode == "" {
+		b.Bot().Send(m.Chat, "Feed "+strconv.Itoa(int(sub.SourceID))+" follows the chat: "+describeDelivery(target))
+		return
+	}
+	user := *target
+	user.Delivery = setting.mode
+	b.Bot().Send(m.Chat, "Feed "+strconv.Itoa(int(sub.SourceID))+" delivery mode set to "+describeDelivery(&user))
+}
+
+// parseDelivery parses arguments of /digest after ID
+// default, which follows the chat, is only allowed for subscriptions
+func parseDelivery(args []string, subscription bool) (*deliverySetting, error) {
+	if len(args) == 0 {
+		return nil, errors.New("Delivery mode missing")
+	}
+	setting := &deliverySetting{mode: strings.ToLower(args[0])}
+	rest := args[1:]
+	switch setting.mode {
+	case "default":
+		if !subscription {
+			return nil, errors.New("default only applies to a feed ID")
+		}
+		setting.mode = ""
+	case models.DeliveryInstant, models.DeliveryHourly:
+	case models.DeliveryWeekly:
+		if len(rest) > 0 && !strings.Contains(rest[0], ":") {
+			weekday, ok := parseWeekday(rest[0])
+			if !ok {
+				return nil, errors.New("Unknown day " + rest[0])
+			}
+			setting.weekday, setting.hasWeekday = weekday, true
+			rest = rest[1:]
+		}
+		fallthrough
+	case models.DeliveryDaily:
+		if len(rest) > 0 {
+			minute, ok := parseClock(rest[0])
+			if !ok {
+				return nil, errors.New("Time " + rest[0] + " illegal, use HH:MM")
+			}
+			setting.minute, setting.hasTime = minute, true
+			rest = rest[1:]
+		}
+	default:
+		return nil, errors.New("Unknown delivery mode " + args[0])
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("Too many arguments")
+	}
+	return setting, nil
+}
+
+// parseClock parses HH:MM into minutes after midnight
+func parseClock(s string) (int, bool) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+// parseWeekday parses English names of days, full or in three letters
+func parseWeekday(s string) (time.Weekday, bool) {
+	s = strings.ToLower(s)
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := strings.ToLower(d.String())
+		if s == name || s == name[:3] {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// describeDelivery returns the delivery mode of user for humans
+// times are in time zone of the user, see /settings
+func describeDelivery(user *models.User) string {
+	clock := formatClock(user.DigestTime)
+	switch user.Delivery {
+	case models.DeliveryHourly:
+		return "hourly digest"
+	case models.DeliveryDaily:
+		return "daily digest at " + clock
+	case models.DeliveryWeekly:
+		return "weekly digest on " + time.Weekday(user.DigestWeekday).String() + " at " + clock
+	default:
+		return "instant"
+	}
+}
@@ -0,0 +1,88 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/TechMinerApps/portier/models"
+)
+
+func Test_parseDelivery(t *testing.T) {
+	tests := []struct {
+		name         string
+		args         []string
+		subscription bool
+		want         *deliverySetting
+		wantErr      bool
+	}{
+		{
+			name: "Instant",
+			args: []string{"instant"},
+			want: &deliverySetting{mode: models.DeliveryInstant},
+		},
+		{
+			name: "Daily without time",
+			args: []string{"Daily"},
+			want: &deliverySetting{mode: models.DeliveryDaily},
+		},
+		{
+			name: "Daily with time",
+			args: []string{"daily", "18:30"},
+			want: &deliverySetting{mode: models.DeliveryDaily, minute: 18*60 + 30, hasTime: true},
+		},
+		{
+			name: "Weekly with day and time",
+			args: []string{"weekly", "fri", "09:00"},
+			want: &deliverySetting{mode: models.DeliveryWeekly, minute: 9 * 60, hasTime: true, weekday: time.Friday, hasWeekday: true},
+		},
+		{
+			name: "Weekly with time only",
+			args: []string{"weekly", "07:15"},
+			want: &deliverySetting{mode: models.DeliveryWeekly, minute: 7*60 + 15, hasTime: true},
+		},
+		{
+			name:         "Default of subscription",
+			args:         []string{"default"},
+			subscription: true,
+			want:         &deliverySetting{mode: ""},
+		},
+		{
+			name:    "Default of chat",
+			args:    []string{"default"},
+			wantErr: true,
+		},
+		{
+			name:    "Illegal time",
+			args:    []string{"daily", "25:00"},
+			wantErr: true,
+		},
+		{
+			name:    "Unknown day",
+			args:    []string{"weekly", "someday"},
+			wantErr: true,
+		},
+		{
+			name:    "Time of hourly",
+			args:    []string{"hourly", "10:00"},
+			wantErr: true,
+		},
+		{
+			name:    "Unknown mode",
+			args:    []string{"monthly"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDelivery(tt.args, tt.subscription)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseDelivery() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseDelivery() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package bot
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TechMinerApps/portier/models"
+	"github.com/TechMinerApps/portier/modules/feed"
+	"github.com/tidwall/buntdb"
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+// Feeds found by /sub are kept in memory db under discover:<token>
+// until user chooses one from the inline keyboard
+const (
+	discoverPrefix = "discover:"
+	discoverTTL    = 10 * time.Minute
+)
+
+// chooseFeedButton is the endpoint of buttons choosing a discovered feed
+// data of each button is <token>|<index>
+var chooseFeedButton = &telebot.InlineButton{Unique: "sub"}
+
+// feedChoice is what chooseFeed keeps until user chooses
+type feedChoice struct {
+	// Target is the Telegram ID of the chat to subscribe
+	Target int64
+
+	// Manager is the only user allowed to choose
+	Manager int64
+	Feeds   []*feed.DiscoveredFeed
+}
+
+// chooseFeed asks user to choose one of feeds found on a website
+func (b *bot) chooseFeed(m *telebot.Message, target *models.User, feeds []*feed.DiscoveredFeed) {
+	token, err := newToken()
+	if err != nil {
+		b.app.Logger().Errorf("Error generating token: %s", err.Error())
+		b.Bot().Send(m.Chat, "Internal error")
+		return
+	}
+	data, err := json.Marshal(&feedChoice{Target: target.TelegramID, Manager: int64(m.Sender.ID), Feeds: feeds})
+	if err != nil {
+		b.app.Logger().Errorf("Error encoding feeds: %s", err.Error())
+		b.Bot().Send(m.Chat, "Internal error")
+		return
+	}
+	err = b.memdb.Update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set(discoverPrefix+token, string(data), &buntdb.SetOptions{Expires: true, TTL: discoverTTL})
+		return err
+	})
+	if err != nil {
+		b.app.Logger().Errorf("Memory DB insertion error: %s", err.Error())
+		b.Bot().Send(m.Chat, "Database error")
+		return
+	}
+
+	// Buttons are created for every message since telebot rewrites their data
+	var rows [][]telebot.InlineButton
+	for i, f := range feeds {
+		rows = append(rows, []telebot.InlineButton{{
+			Unique: chooseFeedButton.Unique,
+			Text:   f.Title,
+			Data:   token + "|" + strconv.Itoa(i),
+		}})
+	}
+	b.Bot().Send(m.Chat, fmt.Sprintf("Found %d feeds, choose one to subscribe", len(feeds)),
+		&telebot.ReplyMarkup{InlineKeyboard: rows})
+}
+
+// onChooseFeed subscribes to the feed chosen from keyboard of chooseFeed
+func (b *bot) onChooseFeed(c *telebot.Callback) {
+	b.app.Logger().Infof("Recieved feed choice from user: \"%s\"", c.Sender.Username)
+	parts := strings.SplitN(c.Data, "|", 2)
+	if len(parts) != 2 {
+		b.Bot().Respond(c, &telebot.CallbackResponse{Text: "Illegal choice"})
+		return
+	}
+	index, err := strconv.Atoi(parts[1])
+	if err != nil {
+		b.Bot().Respond(c, &telebot.CallbackResponse{Text: "Illegal choice"})
+		return
+	}
+
+	var choice feedChoice
+	err = b.memdb.View(func(tx *buntdb.Tx) error {
+		data, err := tx.Get(discoverPrefix + parts[0])
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal([]byte(data), &choice)
+	})
+	if err == buntdb.ErrNotFound || (err == nil && (index < 0 || index >= len(choice.Feeds))) {
+		b.Bot().Respond(c, &telebot.CallbackResponse{Text: "Choice expired, please /sub again"})
+		return
+	}
+	if err != nil {
+		b.app.Logger().Errorf("Memory DB error: %s", err.Error())
+		b.Bot().Respond(c, &telebot.CallbackResponse{Text: "Database error"})
+		return
+	}
+
+	// Admins were checked by /sub, others in the group can not choose
+	if int64(c.Sender.ID) != choice.Manager {
+		b.Bot().Respond(c, &telebot.CallbackResponse{Text: "Only the user who sent /sub can choose"})
+		return
+	}
+	target, err := b.getUser(choice.Target)
+	if err != nil {
+		b.app.Logger().Errorf("Error finding chat %d: %s", choice.Target, err.Error())
+		b.Bot().Respond(c, &telebot.CallbackResponse{Text: "Chat ID not registered, please run /start first"})
+		return
+	}
+	b.Bot().Respond(c, &telebot.CallbackResponse{})
+
+	url := choice.Feeds[index].URL
+	source, result, err := b.subscribe(target, choice.Manager, &models.Source{URL: url})
+	if err != nil {
+		b.app.Logger().Errorf("Error subscribing %s: %s", url, err.Error())
+		b.Bot().Edit(c.Message, "Error adding feed: "+err.Error())
+		return
+	}
+	b.Bot().Edit(c.Message, subscribedMessage(source, result))
+
+	b.memdb.Update(func(tx *buntdb.Tx) error {
+		_, err := tx.Delete(discoverPrefix + parts[0])
+		return err
+	})
+}
+
+// newToken returns a random token short enough for callback data
+func newToken() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
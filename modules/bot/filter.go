@@ -0,0 +1,68 @@
+package bot
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/TechMinerApps/portier/modules/filter"
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+// cmdFilter shows or sets filter rules of a subscription
+// usage: /filter [@channel] ID [RULES|clear]
+func (b *bot) cmdFilter(m *telebot.Message) {
+	b.app.Logger().Infof("Recieved /filter commmand from user: \"%s\"", m.Sender.Username)
+	mention, args := splitMention(strings.Fields(m.Payload))
+	if len(args) == 0 {
+		b.Bot().Send(m.Chat, "Usage: /filter [@channel] ID [RULES|clear]\nRules are like +golang -sponsored +title:/^go\\s\\d/ -author:bot")
+		return
+	}
+	sourceID, err := strconv.Atoi(args[0])
+	if err != nil {
+		b.app.Logger().Infof("/filter command received illegal input: %s", m.Payload)
+		b.Bot().Send(m.Chat, "source ID illegal")
+		return
+	}
+	user, ok := b.target(m, mention)
+	if !ok {
+		return
+	}
+
+	sub, err := b.getSubscription(user, uint(sourceID))
+	if err != nil {
+		b.replySubscriptionError(m, err)
+		return
+	}
+
+	// Show current rules
+	if len(args) == 1 {
+		if sub.Filter == "" {
+			b.Bot().Send(m.Chat, "No filter rules, every item is sent")
+			return
+		}
+		b.Bot().Send(m.Chat, "Filter rules: "+sub.Filter)
+		return
+	}
+
+	var rules string
+	if !(len(args) == 2 && args[1] == "clear") {
+		f, err := filter.Parse(strings.Join(args[1:], " "))
+		if err != nil {
+			b.Bot().Send(m.Chat, "Illegal filter rules: "+err.Error())
+			return
+		}
+		rules = f.String()
+	}
+
+	err = b.app.DB().Model(sub).Update("filter", rules).Error
+	if err != nil {
+		b.app.Logger().Errorf("Database error: %s", err.Error())
+		b.Bot().Send(m.Chat, "Database error")
+		return
+	}
+	if rules == "" {
+		b.Bot().Send(m.Chat, "Filter rules cleared")
+		return
+	}
+	b.Bot().Send(m.Chat, "Filter rules set: "+rules)
+}
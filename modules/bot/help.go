@@ -5,10 +5,24 @@ import "gopkg.in/tucnak/telebot.v2"
 func (b *bot) cmdHelp(m *telebot.Message) {
 	b.app.Logger().Infof("Recieved /help commmand from user: \"%s\"", m.Sender.Username)
 	var message = "*Help Message for Portier Feed Bot*\n\n" +
-		"/sub \\[URL\\]: subscribe a url\n" +
-		"/unsub \\[ID or URL\\]: unsubscribe a feed using id or url\\. ID can be gotten through /list\n" +
-		"/list : get current feed list\n" +
-		"/help : get this help"
+		"/sub \\[URL\\]: subscribe a feed, or a website to find its feeds\n" +
+		"/sub @channel \\[URL\\]: subscribe a channel you and the bot administer, @channel also works with /scrape, /unsub, /list, /mute, /unmute, /digest, /settings, /template, /retry, /filter, /telegraph, /fulltext, /export and /import\n" +
+		"/scrape \\[URL\\]: subscribe a page without feed, CSS selectors follow on new lines as `item: `, `title: `, `link: `, `date: ` and `content: `\n" +
+		"/unsub \\[ID\\]: unsubscribe a feed using id, or reply /unsub to an item\\. ID can be gotten through /list\n" +
+		"/list : list feeds page by page, tap one to see its status, pause, unsubscribe or change its interval\n" +
+		"/mute \\[ID\\]: stop sending a feed without unsubscribing, like the Mute button under items\n" +
+		"/unmute \\[ID\\]: resume a muted feed\n" +
+		"/digest \\[ID\\] instant\\|hourly\\|daily \\[HH:MM\\]\\|weekly \\[DAY\\] \\[HH:MM\\]: collect items into one message, for the chat or one feed, times are in the chat's time zone and shared by it, `default` makes a feed follow the chat\n" +
+		"/settings timezone NAME\\|quiet HH:MM\\-HH:MM\\|quiet off\\|quietmode queue\\|silent\\|sound on\\|off: show or change time zone, quiet hours when items are held or sent silently, and notification sound\n" +
+		"/template \\[ID\\] \\[clear\\]: show, set or clear the message template of the chat, or of one feed with ID, the Go template follows on new lines\n" +
+		"/retry \\[ID\\]: enable a feed disabled after too many errors\n" +
+		"/filter \\[ID\\] \\[RULES\\]: only send items matching rules, like `+golang -sponsored -author:/bot$/`, `clear` to remove them\n" +
+		"/telegraph \\[ID\\] on\\|off: turn Telegraph pages of a feed on or off, the original link is sent when off\n" +
+		"/fulltext \\[ID\\] on\\|off: fetch full articles of a feed that only has summaries\n" +
+		"/export \\[@channel\\]: export subscriptions as an OPML file\n" +
+		"/import \\[@channel\\]: import an OPML file, send it with caption /import or reply /import to it\n" +
+		"/help : get this help\n\n" +
+		"In groups only admins can manage subscriptions"
 
 	if _, err := b.bot.Send(m.Chat, message, &telebot.SendOptions{
 		DisableWebPagePreview: false,
@@ -0,0 +1,388 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/TechMinerApps/portier/models"
+	"gopkg.in/tucnak/telebot.v2"
+	"gorm.io/gorm"
+)
+
+// listPageSize is the number of feeds on a page of /list
+const listPageSize = 10
+
+// Endpoints of buttons in /list, which edit the list message in place
+// data of each button starts with the chat ID listed, see callbackTarget
+var (
+	// listPageButton shows a page, data is <chat>|<page>
+	listPageButton = &telebot.InlineButton{Unique: "lpage"}
+
+	// Buttons below act on a feed, data is <chat>|<source>|<page>
+	listSourceButton    = &telebot.InlineButton{Unique: "lsrc"}
+	listPauseButton     = &telebot.InlineButton{Unique: "lpause"}
+	listUnsubButton     = &telebot.InlineButton{Unique: "lunsub"}
+	listIntervalsButton = &telebot.InlineButton{Unique: "livls"}
+
+	// listIntervalButton sets interval of a feed, data is <chat>|<source>|<page>|<seconds>
+	listIntervalButton = &telebot.InlineButton{Unique: "livl"}
+)
+
+// intervalChoices are the polling intervals users can set
+// 0 learns the interval from the feed again
+var intervalChoices = []time.Duration{0, 5 * time.Minute, 15 * time.Minute, 30 * time.Minute, time.Hour, 6 * time.Hour, 24 * time.Hour}
+
+// cmdList lists feeds of the chat, or the channel mentioned, page by page
+// usage: /list [@channel]
+func (b *bot) cmdList(m *telebot.Message) {
+	b.app.Logger().Infof("Recieved /list commmand from user: \"%s\"", m.Sender.Username)
+	mention, _ := splitMention(strings.Fields(m.Payload))
+	target, ok := b.target(m, mention)
+	if !ok {
+		return
+	}
+	text, markup, err := b.listPage(target, 0)
+	if err != nil {
+		b.app.Logger().Errorf("Database error: %s", err.Error())
+		b.Bot().Send(m.Chat, "Database error")
+		return
+	}
+	b.Bot().Send(m.Chat, text, &telebot.SendOptions{ReplyMarkup: markup, DisableWebPagePreview: true})
+}
+
+// listPage returns a page of feeds subscribed by target
+// page is moved into range if feeds were removed meanwhile
+func (b *bot) listPage(target *models.User, page int) (string, *telebot.ReplyMarkup, error) {
+	var total int64
+	if err := b.app.DB().Model(&models.Subscription{}).Where("user_id = ?", target.ID).Count(&total).Error; err != nil {
+		return "", nil, err
+	}
+	if total == 0 {
+		return "No subscription", nil, nil
+	}
+	pages := int((total + listPageSize - 1) / listPageSize)
+	if page >= pages {
+		page = pages - 1
+	}
+	if page < 0 {
+		page = 0
+	}
+
+	var sources []models.Source
+	err := b.app.DB().
+		Joins("JOIN user_sources ON user_sources.source_id = sources.id").
+		Where("user_sources.user_id = ?", target.ID).
+		Order("sources.id").Offset(page * listPageSize).Limit(listPageSize).
+		Find(&sources).Error
+	if err != nil {
+		return "", nil, err
+	}
+
+	chat := strconv.FormatInt(target.TelegramID, 10)
+	var rows [][]telebot.InlineButton
+	for _, s := range sources {
+		rows = append(rows, []telebot.InlineButton{{
+			Unique: listSourceButton.Unique,
+			Text:   "[" + strconv.Itoa(int(s.ID)) + "] " + truncate(s.Title, 48),
+			Data:   chat + "|" + strconv.Itoa(int(s.ID)) + "|" + strconv.Itoa(page),
+		}})
+	}
+	var nav []telebot.InlineButton
+	if page > 0 {
+		nav = append(nav, telebot.InlineButton{Unique: listPageButton.Unique, Text: "« Prev", Data: chat + "|" + strconv.Itoa(page-1)})
+	}
+	if page < pages-1 {
+		nav = append(nav, telebot.InlineButton{Unique: listPageButton.Unique, Text: "Next »", Data: chat + "|" + strconv.Itoa(page+1)})
+	}
+	if len(nav) > 0 {
+		rows = append(rows, nav)
+	}
+
+	text := fmt.Sprintf("%d subscriptions, page %d/%d\nTap a feed to manage it", total, page+1, pages)
+	return text, &telebot.ReplyMarkup{InlineKeyboard: rows}, nil
+}
+
+// sourceView returns details of a feed subscribed by target
+// page is the list page to go back to
+func (b *bot) sourceView(target *models.User, sourceID uint, page int) (string, *telebot.ReplyMarkup, error) {
+	sub, err := b.getSubscription(target, sourceID)
+	if err != nil {
+		return "", nil, err
+	}
+	var source models.Source
+	if err := b.app.DB().First(&source, sourceID).Error; err != nil {
+		return "", nil, err
+	}
+
+	interval := "default"
+	if source.UpdateInterval != 0 {
+		interval = formatInterval(time.Duration(source.UpdateInterval) * time.Second)
+	}
+	if source.FixedInterval {
+		interval += ", fixed"
+	} else {
+		interval += ", learned from feed"
+	}
+	lastPoll := "never"
+	if !source.LastPolledAt.IsZero() {
+		lastPoll = source.LastPolledAt.UTC().Format("2006-01-02 15:04 MST")
+	}
+	errorCount := strconv.Itoa(int(source.ErrorCount))
+	if source.Disabled {
+		errorCount += ", disabled, use /retry " + strconv.Itoa(int(source.ID)) + " to enable it"
+	}
+	filter := sub.Filter
+	if filter == "" {
+		filter = "none"
+	}
+	lines := []string{
+		"[" + strconv.Itoa(int(source.ID)) + "] " + source.Title,
+		"URL: " + source.URL,
+		"Interval: " + interval,
+		"Last poll: " + lastPoll,
+		"Errors: " + errorCount,
+		"Filter: " + filter,
+	}
+	if sub.Paused {
+		lines = append(lines, "Paused, items are not sent")
+	}
+
+	data := strconv.FormatInt(target.TelegramID, 10) + "|" + strconv.Itoa(int(source.ID)) + "|" + strconv.Itoa(page)
+	pause := "Pause"
+	if sub.Paused {
+		pause = "Resume"
+	}
+	rows := [][]telebot.InlineButton{
+		{
+			{Unique: listPauseButton.Unique, Text: pause, Data: data},
+			{Unique: listUnsubButton.Unique, Text: "Unsubscribe", Data: data},
+		},
+		{{Unique: listIntervalsButton.Unique, Text: "Change interval", Data: data}},
+		{{Unique: listPageButton.Unique, Text: "« Back", Data: strconv.FormatInt(target.TelegramID, 10) + "|" + strconv.Itoa(page)}},
+	}
+	return strings.Join(lines, "\n"), &telebot.ReplyMarkup{InlineKeyboard: rows}, nil
+}
+
+// intervalView returns choices of polling interval of a feed
+func (b *bot) intervalView(target *models.User, sourceID uint, page int) (string, *telebot.ReplyMarkup, error) {
+	if _, err := b.getSubscription(target, sourceID); err != nil {
+		return "", nil, err
+	}
+	var source models.Source
+	if err := b.app.DB().First(&source, sourceID).Error; err != nil {
+		return "", nil, err
+	}
+
+	data := strconv.FormatInt(target.TelegramID, 10) + "|" + strconv.Itoa(int(source.ID)) + "|" + strconv.Itoa(page)
+	var choices []telebot.InlineButton
+	for _, d := range intervalChoices {
+		text := formatInterval(d)
+		if d == 0 {
+			text = "Auto"
+		}
+		choices = append(choices, telebot.InlineButton{
+			Unique: listIntervalButton.Unique,
+			Text:   text,
+			Data:   data + "|" + strconv.Itoa(int(d/time.Second)),
+		})
+	}
+	rows := [][]telebot.InlineButton{
+		choices[:4],
+		choices[4:],
+		{{Unique: listSourceButton.Unique, Text: "« Back", Data: data}},
+	}
+	text := "How often should \"" + source.Title + "\" be polled?\nAuto learns it from how often the feed updates"
+	return text, &telebot.ReplyMarkup{InlineKeyboard: rows}, nil
+}
+
+func (b *bot) onListPage(c *telebot.Callback) {
+	target, args, ok := b.callbackTarget(c)
+	if !ok {
+		return
+	}
+	page, _ := strconv.Atoi(args[0])
+	text, markup, err := b.listPage(target, page)
+	b.editView(c, text, markup, err, "")
+}
+
+func (b *bot) onListSource(c *telebot.Callback) {
+	target, sourceID, page, _, ok := b.listArgs(c)
+	if !ok {
+		return
+	}
+	text, markup, err := b.sourceView(target, sourceID, page)
+	b.editView(c, text, markup, err, "")
+}
+
+func (b *bot) onListPause(c *telebot.Callback) {
+	target, sourceID, page, _, ok := b.listArgs(c)
+	if !ok {
+		return
+	}
+	sub, err := b.getSubscription(target, sourceID)
+	if err != nil {
+		b.editView(c, "", nil, err, "")
+		return
+	}
+	paused := !sub.Paused
+	if err := b.app.DB().Model(sub).Update("paused", paused).Error; err != nil {
+		b.editView(c, "", nil, err, "")
+		return
+	}
+	b.app.Logger().Infof("Feed %d of chat %d paused: %t by user %d", sourceID, target.TelegramID, paused, c.Sender.ID)
+	text, markup, err := b.sourceView(target, sourceID, page)
+	b.editView(c, text, markup, err, "")
+}
+
+func (b *bot) onListUnsub(c *telebot.Callback) {
+	target, sourceID, page, _, ok := b.listArgs(c)
+	if !ok {
+		return
+	}
+	removed, err := b.unsubscribe(target, sourceID)
+	if err != nil {
+		b.editView(c, "", nil, err, "")
+		return
+	}
+	notice := "Feed not subscribed"
+	if removed {
+		b.app.Logger().Infof("Removed feed %d from chat %d by user %d", sourceID, target.TelegramID, c.Sender.ID)
+		notice = "Feed unsubscribed"
+	}
+	text, markup, err := b.listPage(target, page)
+	b.editView(c, text, markup, err, notice)
+}
+
+func (b *bot) onListIntervals(c *telebot.Callback) {
+	target, sourceID, page, _, ok := b.listArgs(c)
+	if !ok {
+		return
+	}
+	text, markup, err := b.intervalView(target, sourceID, page)
+	b.editView(c, text, markup, err, "")
+}
+
+// onListInterval sets polling interval of a feed for everyone subscribing it
+// only bot admins can change it once other chats subscribe the feed
+func (b *bot) onListInterval(c *telebot.Callback) {
+	target, sourceID, page, args, ok := b.listArgs(c)
+	if !ok {
+		return
+	}
+	if len(args) < 3 {
+		b.Bot().Respond(c, &telebot.CallbackResponse{Text: "Illegal button"})
+		return
+	}
+	seconds, err := strconv.Atoi(args[2])
+	if err != nil || !validInterval(seconds) {
+		b.Bot().Respond(c, &telebot.CallbackResponse{Text: "Illegal button"})
+		return
+	}
+	if _, err := b.getSubscription(target, sourceID); err != nil {
+		b.editView(c, "", nil, err, "")
+		return
+	}
+	owner, err := b.ownsSource(c.Sender.ID, sourceID)
+	if err != nil {
+		b.editView(c, "", nil, err, "")
+		return
+	}
+	if !owner {
+		b.Bot().Respond(c, &telebot.CallbackResponse{Text: "Other chats subscribe this feed, only bot admins can change its interval"})
+		return
+	}
+
+	var source models.Source
+	if err := b.app.DB().First(&source, sourceID).Error; err != nil {
+		b.editView(c, "", nil, err, "")
+		return
+	}
+	updates := map[string]interface{}{"fixed_interval": seconds != 0}
+	if seconds != 0 {
+		updates["update_interval"] = seconds
+	}
+	if err := b.app.DB().Model(&source).Updates(updates).Error; err != nil {
+		b.editView(c, "", nil, err, "")
+		return
+	}
+	b.app.Logger().Infof("Interval of feed \"%s\" set to %ds by user %d", source.Title, seconds, c.Sender.ID)
+
+	// Reschedule with the new interval, disabled feeds are not scheduled
+	if !source.Disabled {
+		if err := b.app.Poller().UpdateSource(&source); err != nil {
+			b.app.Logger().Warnf("Error rescheduling feed \"%s\": %s", source.Title, err.Error())
+		}
+	}
+	text, markup, err := b.sourceView(target, sourceID, page)
+	b.editView(c, text, markup, err, "Interval changed")
+}
+
+// listArgs parses data of buttons acting on a feed in /list
+// args are what follows the chat ID
+func (b *bot) listArgs(c *telebot.Callback) (*models.User, uint, int, []string, bool) {
+	target, args, ok := b.callbackTarget(c)
+	if !ok {
+		return nil, 0, 0, nil, false
+	}
+	if len(args) < 2 {
+		b.Bot().Respond(c, &telebot.CallbackResponse{Text: "Illegal button"})
+		return nil, 0, 0, nil, false
+	}
+	sourceID, ok := b.sourceArg(c, args)
+	if !ok {
+		return nil, 0, 0, nil, false
+	}
+	page, _ := strconv.Atoi(args[1])
+	return target, sourceID, page, args, true
+}
+
+// editView replaces the message of c with a view and answers c with notice
+// err of building the view is reported instead
+func (b *bot) editView(c *telebot.Callback, text string, markup *telebot.ReplyMarkup, err error, notice string) {
+	if err == gorm.ErrRecordNotFound {
+		b.Bot().Respond(c, &telebot.CallbackResponse{Text: "Feed not subscribed"})
+		return
+	}
+	if err != nil {
+		b.app.Logger().Errorf("Database error: %s", err.Error())
+		b.Bot().Respond(c, &telebot.CallbackResponse{Text: "Database error"})
+		return
+	}
+	b.Bot().Respond(c, &telebot.CallbackResponse{Text: notice})
+	if _, err := b.Bot().Edit(c.Message, text, &telebot.SendOptions{ReplyMarkup: markup, DisableWebPagePreview: true}); err != nil {
+		b.app.Logger().Warnf("Error editing list message: %s", err.Error())
+	}
+}
+
+// validInterval reports whether seconds is one of intervalChoices
+func validInterval(seconds int) bool {
+	for _, d := range intervalChoices {
+		if int(d/time.Second) == seconds {
+			return true
+		}
+	}
+	return false
+}
+
+// formatInterval formats d without zero units, like 1h instead of 1h0m0s
+func formatInterval(d time.Duration) string {
+	text := d.String()
+	if strings.HasSuffix(text, "m0s") {
+		text = strings.TrimSuffix(text, "0s")
+	}
+	if strings.HasSuffix(text, "h0m") {
+		text = strings.TrimSuffix(text, "0m")
+	}
+	return text
+}
+
+// truncate shortens s to at most n characters
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
@@ -0,0 +1,103 @@
+package bot
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TechMinerApps/portier/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func Test_bot_listPage(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Source{}, &models.Subscription{}); err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{TelegramID: 7}
+	db.Create(&user)
+	for i := 1; i <= 23; i++ {
+		source := models.Source{Title: fmt.Sprintf("Feed %d", i), URL: fmt.Sprintf("https://example.com/%d", i)}
+		db.Create(&source)
+		db.Create(&models.Subscription{UserID: user.ID, SourceID: source.ID})
+	}
+	b := &bot{app: fakePortier{db: db}}
+
+	tests := []struct {
+		name      string
+		page      int
+		wantText  string
+		wantFirst string
+		wantNav   []string
+	}{
+		{
+			name:      "First page",
+			page:      0,
+			wantText:  "23 subscriptions, page 1/3",
+			wantFirst: "[1] Feed 1",
+			wantNav:   []string{"Next »"},
+		},
+		{
+			name:      "Middle page",
+			page:      1,
+			wantText:  "23 subscriptions, page 2/3",
+			wantFirst: "[11] Feed 11",
+			wantNav:   []string{"« Prev", "Next »"},
+		},
+		{
+			name:      "Page out of range",
+			page:      5,
+			wantText:  "23 subscriptions, page 3/3",
+			wantFirst: "[21] Feed 21",
+			wantNav:   []string{"« Prev"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, markup, err := b.listPage(&user, tt.page)
+			if err != nil {
+				t.Fatalf("bot.listPage() error = %v", err)
+			}
+			if !strings.HasPrefix(text, tt.wantText) {
+				t.Errorf("bot.listPage() text = %q, want prefix %q", text, tt.wantText)
+			}
+			rows := markup.InlineKeyboard
+			if got := rows[0][0].Text; got != tt.wantFirst {
+				t.Errorf("bot.listPage() first feed = %q, want %q", got, tt.wantFirst)
+			}
+			var nav []string
+			for _, button := range rows[len(rows)-1] {
+				nav = append(nav, button.Text)
+			}
+			if !reflect.DeepEqual(nav, tt.wantNav) {
+				t.Errorf("bot.listPage() navigation = %v, want %v", nav, tt.wantNav)
+			}
+		})
+	}
+}
+
+func Test_formatInterval(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{d: 5 * time.Minute, want: "5m"},
+		{d: time.Hour, want: "1h"},
+		{d: 90 * time.Minute, want: "1h30m"},
+		{d: 24 * time.Hour, want: "24h"},
+		{d: 45 * time.Second, want: "45s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := formatInterval(tt.d); got != tt.want {
+				t.Errorf("formatInterval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package bot
+
+import (
+	"strconv"
+	"strings"
+
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+// cmdMute stops sending items of a feed without unsubscribing
+// usage: /mute [@channel] ID
+func (b *bot) cmdMute(m *telebot.Message) {
+	b.setPaused(m, "mute", true)
+}
+
+// cmdUnmute resumes a feed muted by /mute or the mute button
+// usage: /unmute [@channel] ID
+func (b *bot) cmdUnmute(m *telebot.Message) {
+	b.setPaused(m, "unmute", false)
+}
+
+// setPaused sets Paused of a subscription of the chat
+func (b *bot) setPaused(m *telebot.Message, command string, paused bool) {
+	b.app.Logger().Infof("Recieved /%s commmand from user: \"%s\"", command, m.Sender.Username)
+	mention, args := splitMention(strings.Fields(m.Payload))
+	if len(args) != 1 {
+		b.Bot().Send(m.Chat, "Usage: /"+command+" [@channel] ID")
+		return
+	}
+	sourceID, err := strconv.Atoi(args[0])
+	if err != nil {
+		b.app.Logger().Infof("/%s command received illegal input: %s", command, m.Payload)
+		b.Bot().Send(m.Chat, "source ID illegal")
+		return
+	}
+	target, ok := b.target(m, mention)
+	if !ok {
+		return
+	}
+	sub, err := b.getSubscription(target, uint(sourceID))
+	if err != nil {
+		b.replySubscriptionError(m, err)
+		return
+	}
+	if err := b.app.DB().Model(sub).Update("paused", paused).Error; err != nil {
+		b.app.Logger().Errorf("Database error: %s", err.Error())
+		b.Bot().Send(m.Chat, "Database error")
+		return
+	}
+	if paused {
+		b.Bot().Send(m.Chat, "Feed "+args[0]+" muted")
+		return
+	}
+	b.Bot().Send(m.Chat, "Feed "+args[0]+" unmuted")
+}
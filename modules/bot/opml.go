@@ -0,0 +1,140 @@
+package bot
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/TechMinerApps/portier/models"
+	"github.com/TechMinerApps/portier/modules/opml"
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+// maxOPMLSize limits the size of uploaded OPML files
+const maxOPMLSize = 1 << 20
+
+// cmdExport sends subscriptions of the chat as an OPML file
+// usage: /export [@channel]
+func (b *bot) cmdExport(m *telebot.Message) {
+	b.app.Logger().Infof("Recieved /export commmand from user: \"%s\"", m.Sender.Username)
+	mention, _ := splitMention(strings.Fields(m.Payload))
+	user, ok := b.target(m, mention)
+	if !ok {
+		return
+	}
+	var sources []*models.Source
+	if err := b.app.DB().Model(user).Association("Sources").Find(&sources); err != nil {
+		b.app.Logger().Errorf("Database error: %s", err.Error())
+		b.Bot().Send(m.Chat, "Database error")
+		return
+	}
+	if len(sources) == 0 {
+		b.Bot().Send(m.Chat, "No subscription")
+		return
+	}
+
+	var feeds []opml.Feed
+	for _, s := range sources {
+		// Scraped pages are not feeds other readers understand
+		if s.Kind == models.SourceScrape {
+			continue
+		}
+		feeds = append(feeds, opml.Feed{Title: s.Title, URL: s.URL})
+	}
+	data, err := opml.New("Portier Subscriptions", feeds).Marshal()
+	if err != nil {
+		b.app.Logger().Errorf("Error generating OPML: %s", err.Error())
+		b.Bot().Send(m.Chat, "Error generating OPML")
+		return
+	}
+
+	doc := &telebot.Document{
+		File:     telebot.FromReader(bytes.NewReader(data)),
+		FileName: "portier.opml",
+		MIME:     "text/x-opml",
+	}
+	if _, err := b.bot.Send(m.Chat, doc); err != nil {
+		b.app.Logger().Errorf("Error sending message: %s", err.Error())
+	}
+}
+
+// cmdImport accepts /import as a reply to an OPML file
+// usage: /import [@channel]
+func (b *bot) cmdImport(m *telebot.Message) {
+	b.app.Logger().Infof("Recieved /import commmand from user: \"%s\"", m.Sender.Username)
+	if !m.IsReply() || m.ReplyTo.Document == nil {
+		b.Bot().Send(m.Chat, "Send an OPML file with caption /import [@channel], or reply /import [@channel] to an OPML file")
+		return
+	}
+	mention, _ := splitMention(strings.Fields(m.Payload))
+	b.importOPML(m, m.ReplyTo.Document, mention)
+}
+
+// onDocument accepts OPML files sent with caption /import
+func (b *bot) onDocument(m *telebot.Message) {
+	if !strings.HasPrefix(m.Caption, "/import") {
+		return
+	}
+	b.app.Logger().Infof("Recieved OPML file from user: \"%s\"", m.Sender.Username)
+
+	// Caption is the command with its arguments, like /import @channel
+	mention, _ := splitMention(strings.Fields(m.Caption)[1:])
+	b.importOPML(m, m.Document, mention)
+}
+
+// importOPML subscribes the chat, or the channel mentioned, to feeds in doc
+func (b *bot) importOPML(m *telebot.Message, doc *telebot.Document, mention string) {
+	user, ok := b.target(m, mention)
+	if !ok {
+		return
+	}
+	if doc.FileSize > maxOPMLSize {
+		b.Bot().Send(m.Chat, "OPML file too large")
+		return
+	}
+
+	reader, err := b.bot.GetFile(&doc.File)
+	if err != nil {
+		b.app.Logger().Errorf("Error downloading file: %s", err.Error())
+		b.Bot().Send(m.Chat, "Error downloading file")
+		return
+	}
+	defer reader.Close()
+	o, err := opml.Parse(io.LimitReader(reader, maxOPMLSize))
+	if err != nil {
+		b.app.Logger().Infof("Illegal OPML file from user \"%s\": %s", m.Sender.Username, err.Error())
+		b.Bot().Send(m.Chat, "Illegal OPML file")
+		return
+	}
+
+	feeds := o.Feeds()
+	if len(feeds) == 0 {
+		b.Bot().Send(m.Chat, "No feed found in OPML file")
+		return
+	}
+	b.Bot().Send(m.Chat, fmt.Sprintf("Importing %d feeds, this may take a while", len(feeds)))
+
+	var added, duplicated int
+	var failed []string
+	for _, f := range feeds {
+		_, result, err := b.subscribe(user, int64(m.Sender.ID), &models.Source{URL: f.URL})
+		switch {
+		case err != nil:
+			b.app.Logger().Warnf("Error importing %s: %s", f.URL, err.Error())
+			failed = append(failed, f.URL)
+		case result == subscribeDuplicated:
+			duplicated++
+		default:
+			added++
+		}
+	}
+
+	b.app.Logger().Infof("Imported OPML for user \"%s\": %d added, %d duplicated, %d failed",
+		m.Sender.Username, added, duplicated, len(failed))
+	message := fmt.Sprintf("Import finished\nAdded: %d\nDuplicated: %d\nFailed: %d", added, duplicated, len(failed))
+	if len(failed) > 0 {
+		message += "\n\nFailed feeds:\n" + strings.Join(failed, "\n")
+	}
+	b.Bot().Send(m.Chat, message, &telebot.SendOptions{DisableWebPagePreview: true})
+}
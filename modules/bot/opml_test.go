@@ -0,0 +1,74 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/TechMinerApps/portier/models"
+	"github.com/tidwall/buntdb"
+	"gopkg.in/tucnak/telebot.v2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func Test_bot_opmlChannel(t *testing.T) {
+	api := newFakeAPI(map[string]string{
+		"getChat:@lazy":              `{"id":-101,"type":"channel","username":"lazy"}`,
+		"getChatAdministrators:-101": `[{"user":{"id":7},"status":"creator"}]`,
+	})
+	defer api.Close()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.User{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&models.User{TelegramID: 7})
+	memdb, err := buntdb.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer memdb.Close()
+	bb, err := NewBot(&Config{Token: "token", MemDB: memdb, APIURL: api.URL}, fakePortier{db: db})
+	if err != nil {
+		t.Fatalf("NewBot() error = %v", err)
+	}
+	b := bb.(*bot)
+
+	private := &telebot.Chat{ID: 7, Type: telebot.ChatPrivate}
+	doc := &telebot.Document{File: telebot.File{FileID: "opml"}, FileName: "feeds.opml"}
+	tests := []struct {
+		name   string
+		handle func(m *telebot.Message)
+		m      *telebot.Message
+	}{
+		{
+			name:   "Export",
+			handle: b.cmdExport,
+			m:      &telebot.Message{Payload: "@lazy"},
+		},
+		{
+			name:   "Import with caption",
+			handle: b.onDocument,
+			m:      &telebot.Message{Caption: "/import @lazy", Document: doc},
+		},
+		{
+			name:   "Import as reply",
+			handle: b.cmdImport,
+			m:      &telebot.Message{Payload: "@lazy", ReplyTo: &telebot.Message{Document: doc}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.m.Chat = private
+			tt.m.Sender = &telebot.User{ID: 7}
+			tt.handle(tt.m)
+			// Reaching the channel check means @lazy was taken as the target
+			params := api.wait(t, "sendMessage")
+			if want := "The bot must be an admin of @lazy to post"; params["text"] != want {
+				t.Errorf("replied %q, want %q", params["text"], want)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package bot
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/TechMinerApps/portier/models"
+	"github.com/TechMinerApps/portier/modules/scrape"
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+const scrapeUsage = "Usage: /scrape [@channel] URL\n" +
+	"item: CSS selector of each item\n" +
+	"title: selector of title in item\n" +
+	"link: selector of link in item, optional\n" +
+	"date: selector of date in item, optional\n" +
+	"content: selector of content in item, optional"
+
+// cmdScrape subscribes to a HTML page without feed
+// selectors are given one per line after the URL
+func (b *bot) cmdScrape(m *telebot.Message) {
+	b.app.Logger().Infof("Recieved /scrape commmand from user: \"%s\"", m.Sender.Username)
+	mention, pageURL, spec, err := parseScrape(m.Text)
+	if err != nil {
+		b.Bot().Send(m.Chat, err.Error()+"\n\n"+scrapeUsage, &telebot.SendOptions{DisableWebPagePreview: true})
+		return
+	}
+	target, ok := b.target(m, mention)
+	if !ok {
+		return
+	}
+
+	source, result, err := b.subscribe(target, int64(m.Sender.ID), &models.Source{
+		URL:      pageURL,
+		Kind:     models.SourceScrape,
+		Selector: spec.String(),
+	})
+	if err != nil {
+		b.app.Logger().Errorf("Error subscribing %s: %s", pageURL, err.Error())
+		b.Bot().Send(m.Chat, "Error adding page: "+err.Error())
+		return
+	}
+	b.Bot().Send(m.Chat, subscribedMessage(source, result))
+}
+
+// parseScrape parses mention, URL and selectors of /scrape command
+func parseScrape(text string) (string, string, *scrape.Spec, error) {
+	lines := strings.Split(text, "\n")
+	mention, fields := splitMention(strings.Fields(lines[0])[1:])
+	if len(fields) != 1 {
+		return "", "", nil, usageError("URL is required")
+	}
+	u, err := url.Parse(fields[0])
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", "", nil, usageError("URL illegal")
+	}
+
+	var spec scrape.Spec
+	for _, line := range lines[1:] {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return "", "", nil, usageError("Illegal line \"" + line + "\"")
+		}
+		selector := strings.TrimSpace(parts[1])
+		switch strings.ToLower(strings.TrimSpace(parts[0])) {
+		case "item":
+			spec.Item = selector
+		case "title":
+			spec.Title = selector
+		case "link":
+			spec.Link = selector
+		case "date":
+			spec.Date = selector
+		case "content":
+			spec.Content = selector
+		default:
+			return "", "", nil, usageError("Unknown selector \"" + parts[0] + "\"")
+		}
+	}
+	if err := spec.Validate(); err != nil {
+		return "", "", nil, err
+	}
+	return mention, u.String(), &spec, nil
+}
+
+// usageError is an error shown to user with usage
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
@@ -0,0 +1,113 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/TechMinerApps/portier/models"
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+const settingsUsage = "Usage: /settings [@channel] timezone NAME|quiet HH:MM-HH:MM|quiet off|quietmode queue|silent|sound on|off"
+
+// cmdSettings shows or changes delivery settings of the chat
+// usage: /settings [@channel] [NAME VALUE]
+func (b *bot) cmdSettings(m *telebot.Message) {
+	b.app.Logger().Infof("Recieved /settings commmand from user: \"%s\"", m.Sender.Username)
+	mention, args := splitMention(strings.Fields(m.Payload))
+	target, ok := b.target(m, mention)
+	if !ok {
+		return
+	}
+	if len(args) == 0 {
+		b.Bot().Send(m.Chat, formatSettings(target)+"\n\n"+settingsUsage)
+		return
+	}
+	updates, err := parseSettings(args)
+	if err != nil {
+		b.app.Logger().Infof("/settings command received illegal input: %s", m.Payload)
+		b.Bot().Send(m.Chat, err.Error()+"\n"+settingsUsage)
+		return
+	}
+	if err := b.app.DB().Model(target).Updates(updates).Error; err != nil {
+		b.app.Logger().Errorf("Database error: %s", err.Error())
+		b.Bot().Send(m.Chat, "Database error")
+		return
+	}
+	b.Bot().Send(m.Chat, "Settings updated\n\n"+formatSettings(target))
+}
+
+// parseSettings parses a setting and its value into columns of User to update
+func parseSettings(args []string) (map[string]interface{}, error) {
+	if len(args) != 2 {
+		return nil, errors.New("A setting and its value are required")
+	}
+	value := args[1]
+	switch strings.ToLower(args[0]) {
+	case "timezone":
+		if _, err := time.LoadLocation(value); err != nil || strings.EqualFold(value, "local") {
+			return nil, errors.New("Unknown time zone " + value + ", use a name like Europe/Berlin")
+		}
+		return map[string]interface{}{"time_zone": value}, nil
+	case "quiet":
+		if strings.EqualFold(value, "off") {
+			return map[string]interface{}{"quiet_start": 0, "quiet_end": 0}, nil
+		}
+		bounds := strings.Split(value, "-")
+		if len(bounds) != 2 {
+			return nil, errors.New("Quiet hours " + value + " illegal, use HH:MM-HH:MM")
+		}
+		start, ok := parseClock(bounds[0])
+		end, ok2 := parseClock(bounds[1])
+		if !ok || !ok2 {
+			return nil, errors.New("Quiet hours " + value + " illegal, use HH:MM-HH:MM")
+		}
+		return map[string]interface{}{"quiet_start": start, "quiet_end": end}, nil
+	case "quietmode":
+		mode := strings.ToLower(value)
+		if mode != models.QuietQueue && mode != models.QuietSilent {
+			return nil, errors.New("Quiet mode must be queue or silent")
+		}
+		return map[string]interface{}{"quiet_mode": mode}, nil
+	case "sound":
+		switch strings.ToLower(value) {
+		case "on":
+			return map[string]interface{}{"audible": true}, nil
+		case "off":
+			return map[string]interface{}{"audible": false}, nil
+		}
+		return nil, errors.New("Sound must be on or off")
+	}
+	return nil, errors.New("Unknown setting " + args[0])
+}
+
+// formatSettings returns settings of user for humans
+func formatSettings(user *models.User) string {
+	zone := user.TimeZone
+	if zone == "" {
+		zone = "UTC"
+	}
+	quiet := "off"
+	if user.QuietStart != user.QuietEnd {
+		mode := user.QuietMode
+		if mode == "" {
+			mode = models.QuietSilent
+		}
+		quiet = formatClock(user.QuietStart) + "-" + formatClock(user.QuietEnd) + ", " + mode
+	}
+	sound := "off"
+	if user.Audible {
+		sound = "on"
+	}
+	return "Time zone: " + zone + "\n" +
+		"Quiet hours: " + quiet + "\n" +
+		"Sound: " + sound + "\n" +
+		"Delivery mode: " + describeDelivery(user)
+}
+
+// formatClock formats minutes after midnight as HH:MM
+func formatClock(minute int) string {
+	return fmt.Sprintf("%02d:%02d", minute/60, minute%60)
+}
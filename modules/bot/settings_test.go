@@ -0,0 +1,85 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/TechMinerApps/portier/models"
+)
+
+func Test_parseSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{
+			name: "Time zone",
+			args: []string{"timezone", "Asia/Shanghai"},
+			want: map[string]interface{}{"time_zone": "Asia/Shanghai"},
+		},
+		{
+			name:    "Unknown time zone",
+			args:    []string{"timezone", "Mars/Olympus"},
+			wantErr: true,
+		},
+		{
+			name:    "Local time zone",
+			args:    []string{"timezone", "Local"},
+			wantErr: true,
+		},
+		{
+			name: "Quiet hours",
+			args: []string{"quiet", "23:00-07:30"},
+			want: map[string]interface{}{"quiet_start": 23 * 60, "quiet_end": 7*60 + 30},
+		},
+		{
+			name: "Quiet hours off",
+			args: []string{"Quiet", "OFF"},
+			want: map[string]interface{}{"quiet_start": 0, "quiet_end": 0},
+		},
+		{
+			name:    "Illegal quiet hours",
+			args:    []string{"quiet", "23:00"},
+			wantErr: true,
+		},
+		{
+			name: "Quiet mode",
+			args: []string{"quietmode", "queue"},
+			want: map[string]interface{}{"quiet_mode": models.QuietQueue},
+		},
+		{
+			name:    "Unknown quiet mode",
+			args:    []string{"quietmode", "drop"},
+			wantErr: true,
+		},
+		{
+			name: "Sound",
+			args: []string{"sound", "on"},
+			want: map[string]interface{}{"audible": true},
+		},
+		{
+			name:    "Missing value",
+			args:    []string{"sound"},
+			wantErr: true,
+		},
+		{
+			name:    "Unknown setting",
+			args:    []string{"color", "blue"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSettings(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseSettings() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSettings() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,9 +1,12 @@
 package bot
 
 import (
+	"errors"
 	"strconv"
+	"strings"
 
 	"github.com/TechMinerApps/portier/models"
+	"github.com/TechMinerApps/portier/modules/feed"
 	"github.com/tidwall/buntdb"
 
 	"gorm.io/gorm"
@@ -11,97 +14,294 @@ import (
 	"gopkg.in/tucnak/telebot.v2"
 )
 
+// subscribeResult tells what subscribe did
+type subscribeResult int
+
+const (
+	subscribeAdded subscribeResult = iota
+	subscribeDuplicated
+)
+
+// getUser finds the registered user of a chat
+func (b *bot) getUser(chatID int64) (*models.User, error) {
+	var user models.User
+	if err := b.app.DB().Where("telegram_id = ?", chatID).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// replyUserError tells user why getUser failed
+func (b *bot) replyUserError(m *telebot.Message, err error) {
+	if err != gorm.ErrRecordNotFound {
+		b.app.Logger().Errorf("Database error: %s", err.Error())
+		b.Bot().Send(m.Chat, "Database error")
+		return
+	}
+	b.app.Logger().Errorf("Chat ID not registered")
+	b.Bot().Send(m.Chat, "Chat ID not registered, please run /start first")
+}
+
+// getSubscription finds the subscription of user to a source
+func (b *bot) getSubscription(user *models.User, sourceID uint) (*models.Subscription, error) {
+	var sub models.Subscription
+	err := b.app.DB().Where("user_id = ? AND source_id = ?", user.ID, sourceID).First(&sub).Error
+	if err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// replySubscriptionError tells user why getSubscription failed
+func (b *bot) replySubscriptionError(m *telebot.Message, err error) {
+	if err != gorm.ErrRecordNotFound {
+		b.app.Logger().Errorf("Database error: %s", err.Error())
+		b.Bot().Send(m.Chat, "Database error")
+		return
+	}
+	b.Bot().Send(m.Chat, "Feed not subscribed")
+}
+
+// subscribe subscribes target chat to candidate, which has URL, Kind and Selector set
+// the source is created if not exist, after it is fetched and parsed successfully
+// managerID is the Telegram user subscribing, recorded in the subscription
+func (b *bot) subscribe(target *models.User, managerID int64, candidate *models.Source) (*models.Source, subscribeResult, error) {
+	if candidate.Kind == "" {
+		candidate.Kind = models.SourceFeed
+	}
+	var source models.Source
+	err := b.app.DB().Where("url = ? AND kind = ? AND selector = ?", candidate.URL, candidate.Kind, candidate.Selector).First(&source).Error
+	switch {
+	case err == gorm.ErrRecordNotFound:
+		source = *candidate
+		// UpdateInterval is learned by poller from the feed
+		feed, err := b.app.Poller().Preview(&source)
+		if err != nil {
+			return nil, subscribeAdded, err
+		}
+		if source.Kind == models.SourceScrape && len(feed.Items) == 0 {
+			return nil, subscribeAdded, errors.New("selectors matched no items")
+		}
+		source.Title = feed.Title
+		if source.Title == "" {
+			source.Title = source.URL
+		}
+		if err := b.app.DB().Create(&source).Error; err != nil {
+			return nil, subscribeAdded, err
+		}
+	case err != nil:
+		return nil, subscribeAdded, err
+	default:
+		if _, err := b.getSubscription(target, source.ID); err == nil {
+			return &source, subscribeDuplicated, nil
+		} else if err != gorm.ErrRecordNotFound {
+			return nil, subscribeAdded, err
+		}
+	}
+
+	sub := models.Subscription{UserID: target.ID, SourceID: source.ID, ManagerID: managerID}
+	if err := b.app.DB().Create(&sub).Error; err != nil {
+		return nil, subscribeAdded, err
+	}
+
+	// Disabled source must be retried before polling again
+	if !source.Disabled {
+		b.app.Poller().AddSource(&source)
+	}
+	b.app.Logger().Infof("Add feed \"%s\" to chat %d by user %d success", source.Title, target.TelegramID, managerID)
+	return &source, subscribeAdded, nil
+}
+
+// cmdSub subscribes the chat, or the channel mentioned, to a feed
+// usage: /sub [@channel] URL
 func (b *bot) cmdSub(m *telebot.Message) {
 	b.app.Logger().Infof("Recieved /sub commmand from user: \"%s\"", m.Sender.Username)
-	var source models.Source
-	source.URL, _ = GetURLAndMentionFromMessage(m)
-	source.Title, _ = b.app.Poller().FetchTitle(source.URL)
-	source.UpdateInterval = 300 // hardcoded for now
-	var user models.User
-	if err := b.app.DB().Model(&user).Association("Sources").Error; err != nil {
-		b.app.Logger().Errorf("Error starting association mode: %s", err.Error())
+	url, mention := GetURLAndMentionFromMessage(m)
+	if url == "" {
+		b.Bot().Send(m.Chat, "Usage: /sub [@channel] URL")
+		return
+	}
+	target, ok := b.target(m, mention)
+	if !ok {
+		return
+	}
+
+	// Known feeds are subscribed directly, websites are searched for feeds
+	var known int64
+	if err := b.app.DB().Model(&models.Source{}).Where("url = ? AND kind = ?", url, models.SourceFeed).Count(&known).Error; err != nil {
+		b.app.Logger().Errorf("Database error: %s", err.Error())
 		b.Bot().Send(m.Chat, "Database error")
 		return
 	}
-	if err := b.app.DB().Model(&user).Where("telegram_id = ?", m.Chat.ID).First(&user).Error; err != nil {
-		if err != gorm.ErrRecordNotFound {
-			b.app.Logger().Errorf("Database error: %s", err.Error())
-			b.Bot().Send(m.Chat, "Database error")
+	if known == 0 {
+		feeds, err := b.app.Poller().Discover(url)
+		if err != nil {
+			b.app.Logger().Infof("Error discovering feeds of %s: %s", url, err.Error())
+			b.Bot().Send(m.Chat, "Error adding feed: "+err.Error())
 			return
 		}
-		b.app.Logger().Errorf("Chat ID not registered")
-		b.Bot().Send(m.Chat, "Chat ID not registered, please run /start first")
-		return
+		if len(feeds) > 1 {
+			b.chooseFeed(m, target, feeds)
+			return
+		}
+		url = feeds[0].URL
 	}
-	b.app.DB().Model(&source).Where("url = ?", source.URL).First(&source)
-	b.app.DB().Model(&user).Association("Sources").Append(&source)
 
-	b.app.Poller().AddSource(&source)
-	b.app.Logger().Infof("Add feed \"%s\" to user \"%s\" success", source.Title, m.Sender.Username)
-	b.Bot().Send(m.Chat, "Add Feed \""+source.Title+"\" Success")
+	source, result, err := b.subscribe(target, int64(m.Sender.ID), &models.Source{URL: url})
+	if err != nil {
+		b.app.Logger().Errorf("Error subscribing %s: %s", url, err.Error())
+		b.Bot().Send(m.Chat, "Error adding feed: "+err.Error())
+		return
+	}
+	b.Bot().Send(m.Chat, subscribedMessage(source, result))
+}
 
+// subscribedMessage tells user the result of subscribe
+func subscribedMessage(source *models.Source, result subscribeResult) string {
+	if result == subscribeDuplicated {
+		return "Feed \"" + source.Title + "\" already subscribed"
+	}
+	if source.Disabled {
+		return "Add Feed \"" + source.Title + "\" Success\nThis feed is disabled because of errors, use /retry " + strconv.Itoa(int(source.ID)) + " to enable it"
+	}
+	return "Add Feed \"" + source.Title + "\" Success"
 }
+
+// cmdUnSub unsubscribes the chat, or the channel mentioned, from a feed
+// usage: /unsub [@channel] ID, or reply /unsub to an item
 func (b *bot) cmdUnSub(m *telebot.Message) {
 	b.app.Logger().Infof("Recieved /unsub commmand from user: \"%s\"", m.Sender.Username)
-	var user models.User
-	b.app.DB().Model(&user).First(&user).Where("telegram_id = ?", m.Chat.ID)
-	if m.IsReply() {
+	mention, args := splitMention(strings.Fields(m.Payload))
+	var sourceID int
+	switch {
+	case len(args) == 1:
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			b.app.Logger().Infof("/unsub command received illegal input: %s", m.Payload)
+			b.Bot().Send(m.Chat, "source ID illegal")
+			return
+		}
+		sourceID = id
+	case len(args) == 0 && m.IsReply():
+		var val string
 		err := b.memdb.View(func(tx *buntdb.Tx) error {
-			val, ok := tx.Get(strconv.Itoa(m.ReplyTo.ID))
-			sourceID, err := strconv.Atoi(val)
-			if err != nil {
-				b.app.Logger().Panicf("Unexpected string to interger convertion error: %s", err.Error())
-			}
-			var source models.Source
-			source.ID = uint(sourceID)
-			b.app.DB().Model(source).Association("Users")
-			b.app.DB().Model(source).Association("Users").Delete(user)
-			return ok
+			var err error
+			val, err = tx.Get(feed.MessageKey(m.Chat.ID, m.ReplyTo.ID))
+			return err
 		})
+		if err == buntdb.ErrNotFound {
+			b.Bot().Send(m.Chat, "Feed of this message not found, use /unsub ID instead")
+			return
+		}
 		if err != nil {
 			b.app.Logger().Errorf("Memory DB error: %s", err.Error())
 			b.Bot().Send(m.Chat, "Database error")
-		}
-	} else {
-		sourceID, err := strconv.Atoi(m.Payload)
-		if err != nil {
-			b.app.Logger().Infof("/unsub command received illegal input: %s", m.Payload)
-			b.Bot().Send(m.Chat, "source ID illegal")
 			return
 		}
-		var source models.Source
-		source.ID = uint(sourceID)
-		b.app.DB().Model(source).Association("Users")
-		if err = b.app.DB().Model(source).Association("Users").Delete(user); err != nil {
-			b.app.Logger().Errorf("Database error: %s", err.Error())
+		if sourceID, err = strconv.Atoi(val); err != nil {
+			b.app.Logger().Errorf("Illegal source ID in memory DB: %s", val)
 			b.Bot().Send(m.Chat, "Database error")
 			return
 		}
+	default:
+		b.Bot().Send(m.Chat, "Usage: /unsub [@channel] ID, or reply /unsub to an item")
+		return
+	}
+	target, ok := b.target(m, mention)
+	if !ok {
+		return
+	}
 
+	removed, err := b.unsubscribe(target, uint(sourceID))
+	if err != nil {
+		b.app.Logger().Errorf("Database error: %s", err.Error())
+		b.Bot().Send(m.Chat, "Database error")
+		return
 	}
-	b.Bot().Send(m.Chat, "Subscription deleted if exist.")
+	if !removed {
+		b.Bot().Send(m.Chat, "Feed not subscribed")
+		return
+	}
+	b.app.Logger().Infof("Removed feed %d from chat %d by user %d", sourceID, target.TelegramID, m.Sender.ID)
+	b.Bot().Send(m.Chat, "Feed "+strconv.Itoa(sourceID)+" unsubscribed")
+}
 
+// unsubscribe removes subscription of target to source, false if there is none
+// sources nobody subscribes are not polled anymore
+func (b *bot) unsubscribe(target *models.User, sourceID uint) (bool, error) {
+	result := b.app.DB().Where("user_id = ? AND source_id = ?", target.ID, sourceID).Delete(&models.Subscription{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	// Template of the subscription goes with it
+	if err := b.app.DB().Where("user_id = ? AND source_id = ?", target.ID, sourceID).Delete(&models.Template{}).Error; err != nil {
+		return true, err
+	}
+
+	var left int64
+	if err := b.app.DB().Model(&models.Subscription{}).Where("source_id = ?", sourceID).Count(&left).Error; err != nil {
+		return true, err
+	}
+	if left == 0 {
+		b.app.Poller().RemoveSource(&models.Source{ID: sourceID})
+	}
+	return true, nil
 }
 
-func (b *bot) cmdList(m *telebot.Message) {
-	b.app.Logger().Infof("Recieved /list commmand from user: \"%s\"", m.Sender.Username)
-	var user models.User
-	if err := b.app.DB().Model(user).First(&user).Where("telegram_id = ?", m.Chat.ID).Error; err != nil {
-		b.app.Logger().Errorf("Database error: %s", err.Error())
-		b.Bot().Send(m.Chat, "Database error")
+// cmdRetry enables a disabled feed subscribed by the chat
+// usage: /retry [@channel] ID
+func (b *bot) cmdRetry(m *telebot.Message) {
+	b.app.Logger().Infof("Recieved /retry commmand from user: \"%s\"", m.Sender.Username)
+	mention, args := splitMention(strings.Fields(m.Payload))
+	if len(args) != 1 {
+		b.Bot().Send(m.Chat, "Usage: /retry [@channel] ID")
 		return
 	}
-	var sources []models.Source
-	b.app.DB().Model(user).Association("Sources")
-	b.app.DB().Model(user).Association("Sources").Find(&sources)
-	var message string
-	if len(sources) == 0 {
-		b.bot.Send(m.Chat, "No subscription")
+	sourceID, err := strconv.Atoi(args[0])
+	if err != nil {
+		b.app.Logger().Infof("/retry command received illegal input: %s", m.Payload)
+		b.Bot().Send(m.Chat, "source ID illegal")
 		return
 	}
-	for _, s := range sources {
-		message = message + "[" + strconv.Itoa(int(s.ID)) + "]: " + s.Title + "\n"
+	user, ok := b.target(m, mention)
+	if !ok {
+		return
+	}
+	if _, err := b.getSubscription(user, uint(sourceID)); err != nil {
+		b.replySubscriptionError(m, err)
+		return
+	}
+	var source models.Source
+	if err := b.app.DB().First(&source, sourceID).Error; err != nil {
+		if err != gorm.ErrRecordNotFound {
+			b.app.Logger().Errorf("Database error: %s", err.Error())
+			b.Bot().Send(m.Chat, "Database error")
+			return
+		}
+		b.Bot().Send(m.Chat, "Feed not found")
+		return
+	}
+	if !source.Disabled {
+		b.Bot().Send(m.Chat, "Feed \""+source.Title+"\" is not disabled")
+		return
 	}
-	b.bot.Send(m.Chat, message)
 
+	source.Disabled = false
+	source.ErrorCount = 0
+	err = b.app.DB().Model(&source).Updates(map[string]interface{}{
+		"disabled":    false,
+		"error_count": 0,
+	}).Error
+	if err != nil {
+		b.app.Logger().Errorf("Database error: %s", err.Error())
+		b.Bot().Send(m.Chat, "Database error")
+		return
+	}
+	b.app.Poller().AddSource(&source)
+	b.app.Logger().Infof("Feed \"%s\" enabled by user \"%s\"", source.Title, m.Sender.Username)
+	b.Bot().Send(m.Chat, "Feed \""+source.Title+"\" enabled")
 }
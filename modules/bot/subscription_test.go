@@ -0,0 +1,113 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/TechMinerApps/portier/models"
+	"github.com/tidwall/buntdb"
+	"gopkg.in/tucnak/telebot.v2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// newSubscribedBot returns a bot whose DB has chats 7, -1, 8 and 9 subscribing disabled feed 1
+// 8 paused it and 9 removed the bot, group -1 is administered by 7
+func newSubscribedBot(t *testing.T, api *fakeAPI) *bot {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Source{}, &models.Subscription{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&models.Source{Title: "broken", Disabled: true})
+	for _, u := range []*models.User{{TelegramID: 7}, {TelegramID: -1}, {TelegramID: 8}, {TelegramID: 9, Inactive: true}} {
+		db.Create(u)
+		db.Create(&models.Subscription{UserID: int64(u.ID), SourceID: 1, Paused: u.TelegramID == 8})
+	}
+	db.Create(&models.User{TelegramID: 10})
+	memdb, err := buntdb.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { memdb.Close() })
+	bb, err := NewBot(&Config{Token: "token", MemDB: memdb, APIURL: api.URL}, fakePortier{db: db})
+	if err != nil {
+		t.Fatalf("NewBot() error = %v", err)
+	}
+	return bb.(*bot)
+}
+
+func Test_bot_cmdRetry(t *testing.T) {
+	api := newFakeAPI(map[string]string{
+		"getChatAdministrators:-1": `[{"user":{"id":7},"status":"creator"}]`,
+	})
+	defer api.Close()
+	b := newSubscribedBot(t, api)
+
+	tests := []struct {
+		name      string
+		chat      *telebot.Chat
+		sender    int
+		payload   string
+		wantReply string
+	}{
+		{
+			name:      "Not subscribed",
+			chat:      &telebot.Chat{ID: 10, Type: telebot.ChatPrivate},
+			sender:    10,
+			payload:   "1",
+			wantReply: "Feed not subscribed",
+		},
+		{
+			name:      "Group member",
+			chat:      &telebot.Chat{ID: -1, Type: telebot.ChatGroup},
+			sender:    10,
+			payload:   "1",
+			wantReply: "Only admins of this group can manage its subscriptions",
+		},
+		{
+			name:      "Illegal ID",
+			chat:      &telebot.Chat{ID: 7, Type: telebot.ChatPrivate},
+			sender:    7,
+			payload:   "one",
+			wantReply: "source ID illegal",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b.cmdRetry(&telebot.Message{Chat: tt.chat, Sender: &telebot.User{ID: tt.sender}, Payload: tt.payload})
+			params := api.wait(t, "sendMessage")
+			if params["text"] != tt.wantReply {
+				t.Errorf("/retry replied %q, want %q", params["text"], tt.wantReply)
+			}
+			var source models.Source
+			b.app.DB().First(&source, 1)
+			if !source.Disabled {
+				t.Errorf("/retry enabled the feed")
+			}
+		})
+	}
+}
+
+func Test_bot_Notify(t *testing.T) {
+	api := newFakeAPI(nil)
+	defer api.Close()
+	b := newSubscribedBot(t, api)
+
+	if err := b.Notify(&models.Source{ID: 1}, "disabled"); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	got := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		got[api.wait(t, "sendMessage")["chat_id"]] = true
+	}
+	if !got["7"] || !got["-1"] {
+		t.Errorf("Notify() sent to %v, want 7 and -1", got)
+	}
+	select {
+	case call := <-api.calls:
+		t.Errorf("Notify() also called %s with %v", call.method, call.params)
+	default:
+	}
+}
@@ -0,0 +1,108 @@
+package bot
+
+import (
+	"strings"
+
+	"github.com/TechMinerApps/portier/models"
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+// target finds the chat whose subscriptions a command manages
+// it is the channel of mention if set, otherwise the chat command is sent in
+// only admins can manage subscriptions of groups and channels
+func (b *bot) target(m *telebot.Message, mention string) (*models.User, bool) {
+	if mention == "" {
+		if isGroup(m.Chat) && !b.checkAdmin(m, m.Chat, "this group", false) {
+			return nil, false
+		}
+		user, err := b.getUser(m.Chat.ID)
+		if err != nil {
+			b.replyUserError(m, err)
+			return nil, false
+		}
+		return user, true
+	}
+
+	chat, err := b.bot.ChatByID(mention)
+	if err != nil {
+		b.app.Logger().Infof("Error finding chat %s: %s", mention, err.Error())
+		b.Bot().Send(m.Chat, "Channel "+mention+" not found, the bot must be added to it first")
+		return nil, false
+	}
+	if chat.Type != telebot.ChatChannel && chat.Type != telebot.ChatChannelPrivate {
+		b.Bot().Send(m.Chat, mention+" is not a channel")
+		return nil, false
+	}
+	if !b.checkAdmin(m, chat, mention, true) {
+		return nil, false
+	}
+
+	// Channels can not /start, they are registered when first managed
+	user := models.User{TelegramID: chat.ID}
+	if err := b.app.DB().Where(&user).FirstOrCreate(&user).Error; err != nil {
+		b.app.Logger().Errorf("Database error: %s", err.Error())
+		b.Bot().Send(m.Chat, "Database error")
+		return nil, false
+	}
+	return &user, true
+}
+
+// checkAdmin tells sender of m if they are not an admin of chat
+// withBot also requires the bot to be an admin, which channels need to post
+func (b *bot) checkAdmin(m *telebot.Message, chat *telebot.Chat, name string, withBot bool) bool {
+	sender, self, err := b.adminsOf(chat, m.Sender.ID)
+	if err != nil {
+		b.app.Logger().Errorf("Error getting admins of %s: %s", name, err.Error())
+		b.Bot().Send(m.Chat, "Error getting admins of "+name)
+		return false
+	}
+	if !sender {
+		b.Bot().Send(m.Chat, "Only admins of "+name+" can manage its subscriptions")
+		return false
+	}
+	if withBot && !self {
+		b.Bot().Send(m.Chat, "The bot must be an admin of "+name+" to post")
+		return false
+	}
+	return true
+}
+
+// adminsOf reports whether user and the bot are admins of chat
+func (b *bot) adminsOf(chat *telebot.Chat, userID int) (user bool, self bool, err error) {
+	admins, err := b.bot.AdminsOf(chat)
+	if err != nil {
+		return false, false, err
+	}
+	for _, a := range admins {
+		if a.User == nil {
+			continue
+		}
+		user = user || a.User.ID == userID
+		self = self || a.User.ID == b.bot.Me.ID
+	}
+	return user, self, nil
+}
+
+// ownsSource reports whether sender may change settings of a source shared by all subscribers
+// bot admins always can, others only if their chat is the only subscriber
+func (b *bot) ownsSource(senderID int, sourceID uint) (bool, error) {
+	if b.isAdmin(senderID) {
+		return true, nil
+	}
+	var count int64
+	err := b.app.DB().Model(&models.Subscription{}).Where("source_id = ?", sourceID).Count(&count).Error
+	return count <= 1, err
+}
+
+// isGroup reports whether chat is a group or supergroup
+func isGroup(chat *telebot.Chat) bool {
+	return chat.Type == telebot.ChatGroup || chat.Type == telebot.ChatSuperGroup
+}
+
+// splitMention removes the leading @mention from args of a command
+func splitMention(args []string) (string, []string) {
+	if len(args) > 0 && strings.HasPrefix(args[0], "@") {
+		return args[0], args[1:]
+	}
+	return "", args
+}
@@ -0,0 +1,171 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/TechMinerApps/portier/models"
+	"github.com/tidwall/buntdb"
+	"gopkg.in/tucnak/telebot.v2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func Test_bot_target(t *testing.T) {
+	const admins = `[{"user":{"id":7},"status":"creator"},{"user":{"id":1,"is_bot":true},"status":"administrator"}]`
+	api := newFakeAPI(map[string]string{
+		"getChat:@news":              `{"id":-100,"type":"channel","username":"news"}`,
+		"getChat:@lazy":              `{"id":-101,"type":"channel","username":"lazy"}`,
+		"getChat:@chat":              `{"id":-102,"type":"supergroup","username":"chat"}`,
+		"getChatAdministrators:-1":   admins,
+		"getChatAdministrators:-100": admins,
+		"getChatAdministrators:-101": `[{"user":{"id":7},"status":"creator"}]`,
+	})
+	defer api.Close()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.User{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&models.User{TelegramID: 7})
+	db.Create(&models.User{TelegramID: -1})
+	memdb, err := buntdb.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer memdb.Close()
+	bb, err := NewBot(&Config{Token: "token", MemDB: memdb, APIURL: api.URL}, fakePortier{db: db})
+	if err != nil {
+		t.Fatalf("NewBot() error = %v", err)
+	}
+	b := bb.(*bot)
+
+	private := &telebot.Chat{ID: 7, Type: telebot.ChatPrivate}
+	group := &telebot.Chat{ID: -1, Type: telebot.ChatGroup}
+	tests := []struct {
+		name      string
+		chat      *telebot.Chat
+		sender    int
+		mention   string
+		wantChat  int64
+		wantReply string
+	}{
+		{
+			name:     "Private chat",
+			chat:     private,
+			sender:   7,
+			wantChat: 7,
+		},
+		{
+			name:      "Unregistered private chat",
+			chat:      &telebot.Chat{ID: 8, Type: telebot.ChatPrivate},
+			sender:    8,
+			wantReply: "Chat ID not registered, please run /start first",
+		},
+		{
+			name:     "Group admin",
+			chat:     group,
+			sender:   7,
+			wantChat: -1,
+		},
+		{
+			name:      "Group member",
+			chat:      group,
+			sender:    9,
+			wantReply: "Only admins of this group can manage its subscriptions",
+		},
+		{
+			name:     "Channel admin",
+			chat:     private,
+			sender:   7,
+			mention:  "@news",
+			wantChat: -100,
+		},
+		{
+			name:      "Channel without bot as admin",
+			chat:      private,
+			sender:    7,
+			mention:   "@lazy",
+			wantReply: "The bot must be an admin of @lazy to post",
+		},
+		{
+			name:      "Mentioned group",
+			chat:      private,
+			sender:    7,
+			mention:   "@chat",
+			wantReply: "@chat is not a channel",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &telebot.Message{Chat: tt.chat, Sender: &telebot.User{ID: tt.sender}}
+			got, ok := b.target(m, tt.mention)
+			if ok != (tt.wantReply == "") {
+				t.Fatalf("bot.target() ok = %v, want %v", ok, tt.wantReply == "")
+			}
+			if ok {
+				if got.TelegramID != tt.wantChat {
+					t.Errorf("bot.target() chat = %d, want %d", got.TelegramID, tt.wantChat)
+				}
+				return
+			}
+			params := api.wait(t, "sendMessage")
+			if params["text"] != tt.wantReply {
+				t.Errorf("bot.target() replied %q, want %q", params["text"], tt.wantReply)
+			}
+		})
+	}
+}
+
+func Test_bot_ownsSource(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Subscription{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&models.Subscription{UserID: 1, SourceID: 1})
+	db.Create(&models.Subscription{UserID: 1, SourceID: 2})
+	db.Create(&models.Subscription{UserID: 2, SourceID: 2})
+	b := &bot{app: fakePortier{db: db}, admins: []int{9}}
+
+	tests := []struct {
+		name     string
+		sender   int
+		sourceID uint
+		want     bool
+	}{
+		{
+			name:     "Only subscriber",
+			sender:   1,
+			sourceID: 1,
+			want:     true,
+		},
+		{
+			name:     "Shared feed",
+			sender:   1,
+			sourceID: 2,
+			want:     false,
+		},
+		{
+			name:     "Bot admin",
+			sender:   9,
+			sourceID: 2,
+			want:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := b.ownsSource(tt.sender, tt.sourceID)
+			if err != nil {
+				t.Fatalf("ownsSource() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ownsSource() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
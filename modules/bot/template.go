@@ -0,0 +1,167 @@
+package bot
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/TechMinerApps/portier/models"
+	"github.com/TechMinerApps/portier/modules/render"
+	"gopkg.in/tucnak/telebot.v2"
+	"gorm.io/gorm"
+)
+
+const templateUsage = "Usage: /template [@channel] [ID] [clear]\n" +
+	"The Go template follows on new lines, it is executed with each item like the global one, " +
+	"{{ .Item.Title }}, {{ .Item.Link }}, {{ .TelegraphURL }} and {{ .Published.Format \"Jan 2 15:04\" }} can be used\n" +
+	"Without ID it applies to every feed of the chat, bot admins can set one for every chat of a feed with /template source ID"
+
+// templateCommand is a parsed /template command
+type templateCommand struct {
+	mention string
+
+	// source is set for templates of a source, only bot admins can use it
+	source bool
+
+	// sourceID is zero for templates of a chat
+	sourceID uint
+	clear    bool
+	text     string
+}
+
+// cmdTemplate shows, sets or clears a message template
+// usage: /template [@channel] [ID] [clear], or /template source ID [clear]
+// the template follows on new lines
+func (b *bot) cmdTemplate(m *telebot.Message) {
+	b.app.Logger().Infof("Recieved /template commmand from user: \"%s\"", m.Sender.Username)
+	cmd, err := parseTemplate(m.Text)
+	if err != nil {
+		b.Bot().Send(m.Chat, err.Error()+"\n\n"+templateUsage)
+		return
+	}
+
+	scope := models.Template{SourceID: cmd.sourceID}
+	if cmd.source {
+		if !b.isAdmin(m.Sender.ID) {
+			b.Bot().Send(m.Chat, "Only bot admins can set templates of a feed")
+			return
+		}
+		if err := b.app.DB().First(&models.Source{}, cmd.sourceID).Error; err != nil {
+			if err != gorm.ErrRecordNotFound {
+				b.app.Logger().Errorf("Database error: %s", err.Error())
+				b.Bot().Send(m.Chat, "Database error")
+				return
+			}
+			b.Bot().Send(m.Chat, "Feed not found")
+			return
+		}
+	} else {
+		target, ok := b.target(m, cmd.mention)
+		if !ok {
+			return
+		}
+		if cmd.sourceID != 0 {
+			if _, err := b.getSubscription(target, cmd.sourceID); err != nil {
+				b.replySubscriptionError(m, err)
+				return
+			}
+		}
+		scope.UserID = target.ID
+	}
+
+	var current models.Template
+	err = b.app.DB().Where("user_id = ? AND source_id = ?", scope.UserID, scope.SourceID).First(&current).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		b.app.Logger().Errorf("Database error: %s", err.Error())
+		b.Bot().Send(m.Chat, "Database error")
+		return
+	}
+	found := err == nil
+
+	switch {
+	case cmd.clear:
+		if found {
+			err = b.app.DB().Delete(&current).Error
+		}
+	case cmd.text == "":
+		if !found {
+			b.Bot().Send(m.Chat, "No template set here, a more general one or the global one is used\n\n"+templateUsage)
+			return
+		}
+		b.Bot().Send(m.Chat, current.Text)
+		return
+	default:
+		if err := render.Validate(cmd.text); err != nil {
+			b.Bot().Send(m.Chat, "Template illegal: "+err.Error())
+			return
+		}
+		if found {
+			err = b.app.DB().Model(&current).Update("text", cmd.text).Error
+		} else {
+			scope.Text = cmd.text
+			err = b.app.DB().Create(&scope).Error
+		}
+	}
+	if err != nil {
+		b.app.Logger().Errorf("Database error: %s", err.Error())
+		b.Bot().Send(m.Chat, "Database error")
+		return
+	}
+	if cmd.clear {
+		b.Bot().Send(m.Chat, "Template cleared")
+		return
+	}
+	b.Bot().Send(m.Chat, "Template saved")
+}
+
+// parseTemplate parses the command line and template of /template
+func parseTemplate(text string) (*templateCommand, error) {
+	lines := strings.SplitN(text, "\n", 2)
+	cmd := &templateCommand{}
+	if len(lines) == 2 {
+		cmd.text = strings.TrimSpace(lines[1])
+	}
+
+	var args []string
+	cmd.mention, args = splitMention(strings.Fields(lines[0])[1:])
+	if len(args) > 0 && args[0] == "source" {
+		if cmd.mention != "" {
+			return nil, usageError("@channel can not be used with source")
+		}
+		cmd.source = true
+		args = args[1:]
+		if len(args) == 0 {
+			return nil, usageError("Feed ID is required")
+		}
+	}
+	if len(args) > 0 && args[len(args)-1] == "clear" {
+		cmd.clear = true
+		args = args[:len(args)-1]
+	}
+	if len(args) > 1 {
+		return nil, usageError("Too many arguments")
+	}
+	if len(args) == 1 {
+		sourceID, err := strconv.Atoi(args[0])
+		if err != nil || sourceID <= 0 {
+			return nil, usageError("Feed ID illegal")
+		}
+		cmd.sourceID = uint(sourceID)
+	}
+	if cmd.source && cmd.sourceID == 0 {
+		return nil, usageError("Feed ID is required")
+	}
+	if cmd.clear && cmd.text != "" {
+		return nil, usageError("clear takes no template")
+	}
+	return cmd, nil
+}
+
+// isAdmin reports whether a Telegram user is an admin of the bot
+func (b *bot) isAdmin(userID int) bool {
+	for _, id := range b.admins {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_parseTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    *templateCommand
+		wantErr bool
+	}{
+		{
+			name: "Show chat template",
+			text: "/template",
+			want: &templateCommand{},
+		},
+		{
+			name: "Set chat template",
+			text: "/template\n*{{ .Item.Title }}*\n{{ .Item.Link }}\n",
+			want: &templateCommand{text: "*{{ .Item.Title }}*\n{{ .Item.Link }}"},
+		},
+		{
+			name: "Set subscription template of channel",
+			text: "/template @news 3\n{{ .Item.Title }}",
+			want: &templateCommand{mention: "@news", sourceID: 3, text: "{{ .Item.Title }}"},
+		},
+		{
+			name: "Clear subscription template",
+			text: "/template 3 clear",
+			want: &templateCommand{sourceID: 3, clear: true},
+		},
+		{
+			name: "Set source template",
+			text: "/template source 3\n{{ .Item.Title }}",
+			want: &templateCommand{source: true, sourceID: 3, text: "{{ .Item.Title }}"},
+		},
+		{
+			name:    "Source without ID",
+			text:    "/template source",
+			wantErr: true,
+		},
+		{
+			name:    "Source of channel",
+			text:    "/template @news source 3",
+			wantErr: true,
+		},
+		{
+			name:    "Illegal ID",
+			text:    "/template abc",
+			wantErr: true,
+		},
+		{
+			name:    "Clear with template",
+			text:    "/template clear\n{{ .Item.Title }}",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTemplate(tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseTemplate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTemplate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package bot
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/TechMinerApps/portier/models"
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+// cmdTelegraph turns Telegraph pages of a feed on or off
+// usage: /telegraph [@channel] ID on|off
+func (b *bot) cmdTelegraph(m *telebot.Message) {
+	b.toggleSource(m, "telegraph", "Telegraph", "disable_telegraph", true)
+}
+
+// cmdFullText turns full article extraction of a feed on or off
+// like /telegraph only bot admins can change it for feeds other chats subscribe
+// usage: /fulltext [@channel] ID on|off
+func (b *bot) cmdFullText(m *telebot.Message) {
+	b.toggleSource(m, "fulltext", "Full text", "full_text", false)
+}
+
+// toggleSource sets a boolean column of a source subscribed by the chat
+// invert is set if the column disables the feature
+// the column is shared by all subscribers, see ownsSource
+func (b *bot) toggleSource(m *telebot.Message, command string, feature string, column string, invert bool) {
+	b.app.Logger().Infof("Recieved /%s commmand from user: \"%s\"", command, m.Sender.Username)
+	mention, args := splitMention(strings.Fields(m.Payload))
+	if len(args) != 2 || (args[1] != "on" && args[1] != "off") {
+		b.Bot().Send(m.Chat, "Usage: /"+command+" [@channel] ID on|off")
+		return
+	}
+	sourceID, err := strconv.Atoi(args[0])
+	if err != nil {
+		b.app.Logger().Infof("/%s command received illegal input: %s", command, m.Payload)
+		b.Bot().Send(m.Chat, "source ID illegal")
+		return
+	}
+	user, ok := b.target(m, mention)
+	if !ok {
+		return
+	}
+	if _, err := b.getSubscription(user, uint(sourceID)); err != nil {
+		b.replySubscriptionError(m, err)
+		return
+	}
+	owner, err := b.ownsSource(m.Sender.ID, uint(sourceID))
+	if err != nil {
+		b.app.Logger().Errorf("Database error: %s", err.Error())
+		b.Bot().Send(m.Chat, "Database error")
+		return
+	}
+	if !owner {
+		b.Bot().Send(m.Chat, "Other chats subscribe feed "+args[0]+", only bot admins can change it")
+		return
+	}
+
+	on := args[1] == "on"
+	var source models.Source
+	source.ID = uint(sourceID)
+	if err := b.app.DB().Model(&source).Update(column, on != invert).Error; err != nil {
+		b.app.Logger().Errorf("Database error: %s", err.Error())
+		b.Bot().Send(m.Chat, "Database error")
+		return
+	}
+	b.Bot().Send(m.Chat, feature+" turned "+args[1]+" for feed "+args[0])
+}
@@ -0,0 +1,127 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/TechMinerApps/portier/models"
+	"github.com/tidwall/buntdb"
+	"gopkg.in/tucnak/telebot.v2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func Test_bot_toggleSource(t *testing.T) {
+	api := newFakeAPI(nil)
+	defer api.Close()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Source{}, &models.Subscription{}); err != nil {
+		t.Fatal(err)
+	}
+	alice := &models.User{TelegramID: 7}
+	bob := &models.User{TelegramID: 8}
+	db.Create(alice)
+	db.Create(bob)
+	db.Create(&models.Source{Title: "own"})
+	db.Create(&models.Source{Title: "shared"})
+	db.Create(&models.Subscription{UserID: int64(alice.ID), SourceID: 1})
+	db.Create(&models.Subscription{UserID: int64(alice.ID), SourceID: 2})
+	db.Create(&models.Subscription{UserID: int64(bob.ID), SourceID: 2})
+	memdb, err := buntdb.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer memdb.Close()
+	bb, err := NewBot(&Config{Token: "token", MemDB: memdb, APIURL: api.URL, Admins: []int{9}}, fakePortier{db: db})
+	if err != nil {
+		t.Fatalf("NewBot() error = %v", err)
+	}
+	b := bb.(*bot)
+
+	tests := []struct {
+		name        string
+		command     func(*telebot.Message)
+		column      string
+		sender      int
+		payload     string
+		wantReply   string
+		wantChanged bool
+	}{
+		{
+			name:        "Telegraph of own feed",
+			command:     b.cmdTelegraph,
+			column:      "disable_telegraph",
+			sender:      7,
+			payload:     "1 off",
+			wantReply:   "Telegraph turned off for feed 1",
+			wantChanged: true,
+		},
+		{
+			name:        "Telegraph of shared feed",
+			command:     b.cmdTelegraph,
+			column:      "disable_telegraph",
+			sender:      7,
+			payload:     "2 off",
+			wantReply:   "Other chats subscribe feed 2, only bot admins can change it",
+			wantChanged: false,
+		},
+		{
+			name:        "Telegraph by bot admin",
+			command:     b.cmdTelegraph,
+			column:      "disable_telegraph",
+			sender:      9,
+			payload:     "2 off",
+			wantReply:   "Telegraph turned off for feed 2",
+			wantChanged: true,
+		},
+		{
+			name:        "Full text of own feed",
+			command:     b.cmdFullText,
+			column:      "full_text",
+			sender:      7,
+			payload:     "1 on",
+			wantReply:   "Full text turned on for feed 1",
+			wantChanged: true,
+		},
+		{
+			name:        "Full text of shared feed",
+			command:     b.cmdFullText,
+			column:      "full_text",
+			sender:      7,
+			payload:     "2 on",
+			wantReply:   "Other chats subscribe feed 2, only bot admins can change it",
+			wantChanged: false,
+		},
+		{
+			name:        "Full text by bot admin",
+			command:     b.cmdFullText,
+			column:      "full_text",
+			sender:      9,
+			payload:     "2 on",
+			wantReply:   "Full text turned on for feed 2",
+			wantChanged: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db.Model(&models.Source{}).Where("1 = 1").Updates(map[string]interface{}{"disable_telegraph": false, "full_text": false})
+			// Every command is sent in the private chat of alice
+			chat := &telebot.Chat{ID: 7, Type: telebot.ChatPrivate}
+			m := &telebot.Message{Chat: chat, Sender: &telebot.User{ID: tt.sender}, Payload: tt.payload}
+			tt.command(m)
+
+			params := api.wait(t, "sendMessage")
+			if params["text"] != tt.wantReply {
+				t.Errorf("command replied %q, want %q", params["text"], tt.wantReply)
+			}
+			var changed int64
+			db.Model(&models.Source{}).Where(tt.column+" = ?", true).Count(&changed)
+			if got := changed == 1; got != tt.wantChanged {
+				t.Errorf("%s of the feed changed = %v, want %v", tt.column, got, tt.wantChanged)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/TechMinerApps/portier/modules/log"
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	// secretTokenHeader carries the secret token in every request from Telegram
+	secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+	// maxUpdateSize limits the size of an update, Telegram sends one at a time
+	maxUpdateSize = 1 << 20
+
+	// shutdownTimeout is how long Stop waits for requests being handled
+	shutdownTimeout = 10 * time.Second
+)
+
+// WebhookConfig makes bot receive updates by webhook instead of long polling
+type WebhookConfig struct {
+	// Listen is the address of the webhook server
+	Listen string
+
+	// PublicURL is where Telegram sends updates, webhook is disabled if empty
+	// usually a reverse proxy in front of Listen
+	PublicURL string
+
+	// SecretToken is checked against the header of every request if not empty
+	SecretToken string
+
+	// Cert and Key serve webhook with TLS
+	// Cert is uploaded to Telegram so self-signed certificates work
+	Cert string
+	Key  string
+}
+
+// webhook is a telebot.Poller receiving updates from its own HTTP server
+// telebot.Webhook can not check secret token nor stop gracefully
+type webhook struct {
+	WebhookConfig
+	client *http.Client
+	logger log.Logger
+
+	dest chan<- telebot.Update
+	stop <-chan struct{}
+
+	// done is closed after the server is shut down
+	done chan struct{}
+}
+
+func newWebhook(c WebhookConfig, client *http.Client, logger log.Logger) (*webhook, error) {
+	if c.Listen == "" {
+		return nil, errors.New("webhook needs an address to listen")
+	}
+	if (c.Cert == "") != (c.Key == "") {
+		return nil, errors.New("webhook needs both certificate and key for TLS")
+	}
+	return &webhook{
+		WebhookConfig: c,
+		client:        client,
+		logger:        logger,
+		done:          make(chan struct{}),
+	}, nil
+}
+
+func (h *webhook) Poll(b *telebot.Bot, dest chan telebot.Update, stop chan struct{}) {
+	defer close(h.done)
+	h.dest = dest
+	h.stop = stop
+
+	if err := h.register(b); err != nil {
+		h.logger.Errorf("Error setting webhook: %s", err.Error())
+		<-stop
+		return
+	}
+
+	server := &http.Server{Addr: h.Listen, Handler: h}
+	serveErr := make(chan error, 1)
+	go func() {
+		if h.Cert != "" {
+			serveErr <- server.ListenAndServeTLS(h.Cert, h.Key)
+		} else {
+			serveErr <- server.ListenAndServe()
+		}
+	}()
+	h.logger.Infof("Webhook listening on %s", h.Listen)
+
+	select {
+	case <-stop:
+	case err := <-serveErr:
+		h.logger.Errorf("Webhook server error: %s", err.Error())
+		<-stop
+		return
+	}
+
+	// Finish updates being received, Telegram resends the rest after restart
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		h.logger.Errorf("Error shutting down webhook server: %s", err.Error())
+	}
+}
+
+func (h *webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.SecretToken != "" &&
+		subtle.ConstantTimeCompare([]byte(r.Header.Get(secretTokenHeader)), []byte(h.SecretToken)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var update telebot.Update
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxUpdateSize)).Decode(&update); err != nil {
+		http.Error(w, "illegal update", http.StatusBadRequest)
+		return
+	}
+	select {
+	case h.dest <- update:
+	case <-h.stop:
+		// Not acknowledged so Telegram sends it again
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+	}
+}
+
+// register tells Telegram to send updates to PublicURL
+func (h *webhook) register(b *telebot.Bot) error {
+	params := map[string]string{"url": h.PublicURL}
+	if h.SecretToken != "" {
+		params["secret_token"] = h.SecretToken
+	}
+	if h.Cert == "" {
+		_, err := b.Raw("setWebhook", params)
+		return err
+	}
+
+	// Certificate is uploaded as a file, which Raw can not do
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for key, value := range params {
+		if err := form.WriteField(key, value); err != nil {
+			return err
+		}
+	}
+	cert, err := os.Open(h.Cert)
+	if err != nil {
+		return err
+	}
+	defer cert.Close()
+	part, err := form.CreateFormFile("certificate", filepath.Base(h.Cert))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, cert); err != nil {
+		return err
+	}
+	if err := form.Close(); err != nil {
+		return err
+	}
+
+	resp, err := h.client.Post(b.URL+"/bot"+b.Token+"/setWebhook", form.FormDataContentType(), &body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Ok          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if !result.Ok {
+		return errors.New(result.Description)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package bot
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TechMinerApps/portier/modules/feed"
+	"github.com/TechMinerApps/portier/modules/log"
+	"github.com/tidwall/buntdb"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// fakePortier serves commands that do not poll
+type fakePortier struct {
+	db *gorm.DB
+}
+
+func (fakePortier) Poller() feed.Poller { return nil }
+func (fakePortier) Logger() log.Logger  { return zap.NewNop().Sugar() }
+func (p fakePortier) DB() *gorm.DB      { return p.db }
+
+// apiCall is a method called on fakeAPI with its JSON params
+type apiCall struct {
+	method string
+	params map[string]string
+}
+
+// fakeAPI is a Telegram Bot API server recording calls
+type fakeAPI struct {
+	*httptest.Server
+	calls chan apiCall
+}
+
+// newFakeAPI answers methods with JSON results, true if not in results
+// results are keyed by method, or method:chat_id to answer one chat
+// the bot has ID 1, getMe and methods in results are not recorded
+func newFakeAPI(results map[string]string) *fakeAPI {
+	api := &fakeAPI{calls: make(chan apiCall, 10)}
+	api.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := apiCall{method: path.Base(r.URL.Path)}
+		json.NewDecoder(r.Body).Decode(&call.params)
+		result, ok := results[call.method+":"+call.params["chat_id"]]
+		if !ok {
+			result, ok = results[call.method]
+		}
+		if ok {
+			w.Write([]byte(`{"ok":true,"result":` + result + `}`))
+			return
+		}
+		switch call.method {
+		case "getMe":
+			w.Write([]byte(`{"ok":true,"result":{"id":1,"is_bot":true,"username":"portier_bot"}}`))
+			return
+		case "sendMessage":
+			w.Write([]byte(`{"ok":true,"result":{"message_id":1,"chat":{"id":` + call.params["chat_id"] + `}}}`))
+		default:
+			w.Write([]byte(`{"ok":true,"result":true}`))
+		}
+		api.calls <- call
+	}))
+	return api
+}
+
+// wait returns params of the next call, which must be method
+func (api *fakeAPI) wait(t *testing.T, method string) map[string]string {
+	select {
+	case call := <-api.calls:
+		if call.method != method {
+			t.Fatalf("called %s, want %s", call.method, method)
+		}
+		return call.params
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s not called", method)
+	}
+	return nil
+}
+
+// freeAddr returns a local address nothing listens on
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func Test_webhook(t *testing.T) {
+	const (
+		publicURL = "https://portier.example.com/telegram"
+		secret    = "s3cret-token"
+		update    = `{"update_id":1,"message":{"message_id":1,"from":{"id":42},"chat":{"id":42,"type":"private"},"text":"/help"}}`
+	)
+	api := newFakeAPI(nil)
+	defer api.Close()
+	memdb, err := buntdb.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer memdb.Close()
+
+	addr := freeAddr(t)
+	b, err := NewBot(&Config{
+		Token:   "token",
+		MemDB:   memdb,
+		APIURL:  api.URL,
+		Webhook: WebhookConfig{Listen: addr, PublicURL: publicURL, SecretToken: secret},
+	}, fakePortier{})
+	if err != nil {
+		t.Fatalf("NewBot() error = %v", err)
+	}
+	go b.Start()
+
+	params := api.wait(t, "setWebhook")
+	if got := params["url"]; got != publicURL {
+		t.Errorf("setWebhook url = %q, want %q", got, publicURL)
+	}
+	if got := params["secret_token"]; got != secret {
+		t.Errorf("setWebhook secret_token = %q, want %q", got, secret)
+	}
+
+	// Server starts listening after setWebhook returns
+	post := func(token string) int {
+		for i := 0; i < 50; i++ {
+			req, _ := http.NewRequest(http.MethodPost, "http://"+addr+"/telegram", strings.NewReader(update))
+			if token != "" {
+				req.Header.Set(secretTokenHeader, token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err == nil {
+				resp.Body.Close()
+				return resp.StatusCode
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		t.Fatalf("webhook server not listening on %s", addr)
+		return 0
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+		wantReply  bool
+	}{
+		{
+			name:       "Missing secret token",
+			token:      "",
+			wantStatus: http.StatusUnauthorized,
+			wantReply:  false,
+		},
+		{
+			name:       "Wrong secret token",
+			token:      "guess",
+			wantStatus: http.StatusUnauthorized,
+			wantReply:  false,
+		},
+		{
+			name:       "Valid secret token",
+			token:      secret,
+			wantStatus: http.StatusOK,
+			wantReply:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := post(tt.token); got != tt.wantStatus {
+				t.Errorf("webhook responded %d, want %d", got, tt.wantStatus)
+			}
+			if tt.wantReply {
+				params := api.wait(t, "sendMessage")
+				if got := params["chat_id"]; got != "42" {
+					t.Errorf("replied to chat %s, want 42", got)
+				}
+			}
+		})
+	}
+
+	// Stop returns after the server is shut down
+	b.Stop()
+	if _, err := http.Post("http://"+addr+"/telegram", "application/json", strings.NewReader(update)); err == nil {
+		t.Errorf("webhook server still listening after Stop()")
+	}
+	select {
+	case call := <-api.calls:
+		t.Errorf("unexpected call %s", call.method)
+	default:
+	}
+}
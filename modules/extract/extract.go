@@ -0,0 +1,134 @@
+package extract
+
+import (
+	"errors"
+	"io"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// ErrNoArticle is returned when no article body is found in a page
+var ErrNoArticle = errors.New("no article found")
+
+// MinLength is the shortest text accepted as an article body
+const MinLength = 250
+
+var (
+	// unlikely are elements never holding article body
+	unlikely = "script, style, noscript, iframe, form, button, nav, header, footer, aside, svg, template"
+
+	// positive and negative match class and id of elements
+	positive = regexp.MustCompile(`(?i)article|body|content|entry|main|page|post|text|blog|story`)
+	negative = regexp.MustCompile(`(?i)comment|meta|footer|footnote|sidebar|sponsor|banner|share|related|nav|menu|social|promo|widget|subscribe|newsletter|advert|\bads?\b`)
+)
+
+// Extract returns HTML of the main article body of the page read from r
+// a readability style score is given to containers of paragraphs
+// by their text length, commas, class names and link density
+func Extract(r io.Reader) (string, error) {
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return "", err
+	}
+	doc.Find(unlikely).Remove()
+
+	scores := make(map[*html.Node]float64)
+	var candidates []*goquery.Selection
+	doc.Find("p, pre, td, blockquote").Each(func(_ int, p *goquery.Selection) {
+		text := strings.TrimSpace(p.Text())
+		if len(text) < 25 {
+			return
+		}
+		score := 1 + float64(strings.Count(text, ",")) + math.Min(float64(len(text))/100, 3)
+
+		// Parent gets full score, grandparent gets half
+		for i, parent := range []*goquery.Selection{p.Parent(), p.Parent().Parent()} {
+			if parent.Length() == 0 {
+				continue
+			}
+			node := parent.Get(0)
+			if _, ok := scores[node]; !ok {
+				scores[node] = weight(parent)
+				candidates = append(candidates, parent)
+			}
+			scores[node] += score / float64(i+1)
+		}
+	})
+
+	var top *goquery.Selection
+	topScore := 0.0
+	for _, c := range candidates {
+		score := scores[c.Get(0)] * (1 - linkDensity(c))
+		if top == nil || score > topScore {
+			top, topScore = c, score
+		}
+	}
+	if top == nil {
+		return "", ErrNoArticle
+	}
+
+	// Drop ads and share bars inside the article
+	top.Find("*").Each(func(_ int, s *goquery.Selection) {
+		names := s.AttrOr("class", "") + " " + s.AttrOr("id", "")
+		if negative.MatchString(names) && !positive.MatchString(names) {
+			s.Remove()
+		}
+	})
+	if len(strings.TrimSpace(top.Text())) < MinLength {
+		return "", ErrNoArticle
+	}
+	return top.Html()
+}
+
+// weight scores an element by its tag, class and id
+func weight(s *goquery.Selection) float64 {
+	var w float64
+	switch goquery.NodeName(s) {
+	case "article", "main":
+		w += 10
+	case "div":
+		w += 5
+	case "body":
+		w -= 5
+	}
+	for _, attr := range []string{"class", "id"} {
+		value, ok := s.Attr(attr)
+		if !ok {
+			continue
+		}
+		if negative.MatchString(value) {
+			w -= 25
+		}
+		if positive.MatchString(value) {
+			w += 25
+		}
+	}
+	return w
+}
+
+// linkDensity is the ratio of link text in all text of s
+func linkDensity(s *goquery.Selection) float64 {
+	length := len(s.Text())
+	if length == 0 {
+		return 0
+	}
+	links := 0
+	s.Find("a").Each(func(_ int, a *goquery.Selection) {
+		links += len(a.Text())
+	})
+	return float64(links) / float64(length)
+}
+
+// Text returns the text of HTML content
+// used to tell if content is only a teaser
+func Text(content string) string {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(content))
+	if err != nil {
+		return content
+	}
+	return strings.TrimSpace(doc.Text())
+}
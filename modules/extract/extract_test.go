@@ -0,0 +1,72 @@
+package extract
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name     string
+		contains []string
+		excludes []string
+		wantErr  error
+	}{
+		{
+			name: "blog",
+			contains: []string{
+				"could no longer keep up",
+				"Remote caching changed everything",
+				"remote_cache=grpcs://cache.example.com",
+				"build-times.png",
+				"make the same decision again",
+			},
+			excludes: []string{"Great write-up", "Recent Posts", "All rights reserved", "Careers"},
+		},
+		{
+			name: "news",
+			contains: []string{
+				"voted seven to two",
+				"the first segment, along Fifth Avenue",
+				"most important safety project",
+			},
+			excludes: []string{"Parking rates to rise", "Subscribe", "spring sale"},
+		},
+		{
+			name:    "teaser",
+			wantErr: ErrNoArticle,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", tt.name+".html"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			got, err := Extract(f)
+			if err != tt.wantErr {
+				t.Fatalf("Extract() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(got, s) {
+					t.Errorf("Extract() does not contain %q", s)
+				}
+			}
+			for _, s := range tt.excludes {
+				if strings.Contains(got, s) {
+					t.Errorf("Extract() contains %q", s)
+				}
+			}
+		})
+	}
+}
+
+func TestText(t *testing.T) {
+	if got := Text("<p>Read <b>more</b></p>"); got != "Read more" {
+		t.Errorf("Text() = %q, want %q", got, "Read more")
+	}
+}
@@ -0,0 +1,32 @@
+package feed
+
+import (
+	"math/rand"
+	"time"
+)
+
+// maxBackoff is the longest delay between two polls of a failing source
+const maxBackoff = 24 * time.Hour
+
+// backoff returns the delay before next poll after errorCount continuous failures
+// the delay doubles on every failure up to maxBackoff, plus up to 20% random jitter
+// so failing sources on the same host do not retry at the same time
+func backoff(interval time.Duration, errorCount uint) time.Duration {
+	delay := interval
+	for i := uint(0); i < errorCount && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	jitter := time.Duration(rand.Int63n(int64(delay)/5 + 1))
+	return delay + jitter
+}
+
+// jitter returns a random duration in [0, d)
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)))
+}
@@ -0,0 +1,46 @@
+package feed
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_backoff(t *testing.T) {
+	type args struct {
+		interval   time.Duration
+		errorCount uint
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantMin time.Duration
+		wantMax time.Duration
+	}{
+		{
+			name:    "No error",
+			args:    args{interval: time.Minute, errorCount: 0},
+			wantMin: time.Minute,
+			wantMax: time.Minute + 12*time.Second,
+		},
+		{
+			name:    "Three errors",
+			args:    args{interval: time.Minute, errorCount: 3},
+			wantMin: 8 * time.Minute,
+			wantMax: 8*time.Minute + 96*time.Second,
+		},
+		{
+			name:    "Capped",
+			args:    args{interval: time.Hour, errorCount: 100},
+			wantMin: maxBackoff,
+			wantMax: maxBackoff + maxBackoff/5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := backoff(tt.args.interval, tt.args.errorCount)
+			if got < tt.wantMin || got > tt.wantMax {
+				t.Errorf("backoff() = %v, want between %v and %v", got, tt.wantMin, tt.wantMax)
+			}
+		})
+	}
+}
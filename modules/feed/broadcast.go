@@ -1,10 +1,15 @@
 package feed
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/TechMinerApps/portier/models"
+	"github.com/TechMinerApps/portier/modules/filter"
 	"github.com/TechMinerApps/portier/modules/log"
 	"github.com/TechMinerApps/portier/modules/render"
 	"github.com/TechMinerApps/portier/modules/telegraph"
@@ -28,7 +33,7 @@ type BroadCastConfig struct {
 	// MemDB is used to store chat id
 	MemDB *buntdb.DB
 
-	// WorkerCount is used in concurrent broadcast
+	// WorkerCount is the number of concurrent senders
 	WorkerCount int
 
 	// FeedChannel is where feed item comes from
@@ -43,13 +48,47 @@ type BroadCastConfig struct {
 	// Template is a string used to render text
 	Template string
 
+	// DigestTemplate is used to render digests, see render.Config
+	DigestTemplate string
+
 	// Telegraph is the config of telegraph module
 	Telegraph *telegraph.Config
+
+	// Markup returns buttons of item sent to chat, can be nil
+	Markup func(item *models.Feed, chatID int64) *telebot.ReplyMarkup
+}
+
+// maxSenderWait is the longest time a sender waits for a busy chat
+// deliveries waiting longer are put back into queue
+const maxSenderWait = time.Second
+
+// publishTimeout is the longest time to wait for a Telegraph page
+// items are sent without it after that
+const publishTimeout = time.Minute
+
+// messageTTL is how long the source of a sent message is remembered
+const messageTTL = 30 * 24 * time.Hour
+
+// MessageKey is the memory db key holding source ID of a message sent to chat
+func MessageKey(chatID int64, messageID int) string {
+	return fmt.Sprintf("msg:%d:%d", chatID, messageID)
 }
 
 type broadcaster struct {
-	renderer render.Renderer
-	tgph     telegraph.Telegraph
+	renderer  render.Renderer
+	templates *render.Cache
+	tgph      telegraph.Telegraph
+	outbox    *outbox
+	digests   *digests
+	retries   *telegraphRetries
+	limiter   *limiter
+	queue     chan *delivery
+
+	// ctx is canceled by Stop, wg counts goroutines Stop waits for
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
 	BroadCastConfig
 }
 
@@ -69,12 +108,23 @@ func NewBroadcaster(c *BroadCastConfig) (BroadCaster, error) {
 		return nil, errors.New("broadcaster config error")
 	}
 	b := &broadcaster{
+		outbox:          &outbox{db: c.MemDB},
+		digests:         &digests{db: c.MemDB},
+		templates:       render.NewCache(templateCacheSize),
+		retries:         &telegraphRetries{db: c.MemDB},
+		limiter:         newLimiter(),
+		queue:           make(chan *delivery, 100),
 		BroadCastConfig: *c,
 	}
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	if b.WorkerCount < 1 {
+		b.WorkerCount = 1
+	}
 
 	var err error
 	cfg := render.Config{
-		Template: c.Template,
+		Template:       c.Template,
+		DigestTemplate: c.DigestTemplate,
 	}
 	b.renderer, err = render.NewRenderer(cfg)
 	if err != nil {
@@ -90,76 +140,414 @@ func (b *broadcaster) Start() {
 
 	b.tgph.Start()
 
-	// Create workers according to WorkerCount
+	// Read outbox before poller starts adding new items
+	// so items left by last run are not sent twice
+	feeds, deliveries, err := b.outbox.pending()
+	if err != nil {
+		b.Logger.Errorf("Error reading outbox: %s", err.Error())
+	}
+	b.run(func() { b.replay(feeds, deliveries) })
+
+	// Add Telegraph pages to messages sent without them
+	b.run(b.retryTelegraph)
+
+	// Send digests when they are due
+	b.run(b.flushDigests)
+
+	// Create senders according to WorkerCount
+	// they share one limiter to follow Telegram rate limits
 	for i := 0; i < b.WorkerCount; i++ {
-		go func() {
-			for item := range b.FeedChannel {
-				b.Logger.Debugf("Broadcasting feed item %s", item.Item.Title)
-				b.broadcast(item)
+		b.run(b.sender)
+	}
 
-			}
-		}()
+	// Items are broadcasted by one goroutine per Telegraph account
+	// so publishing pages runs in parallel, sending is done by senders
+	consumers := b.Telegraph.AccountNumber
+	if consumers < 1 {
+		consumers = 1
+	}
+	for i := 0; i < consumers; i++ {
+		b.run(b.consume)
 	}
 }
+
+// Stop stops taking work and blocks until running deliveries return
+// items and deliveries not done yet stay in outbox for next start
+// poller must be stopped before so nothing is left in FeedChannel
 func (b *broadcaster) Stop() {
-	// Do nothing now
+	b.cancel()
+	b.wg.Wait()
+}
+
+// run starts f in a goroutine Stop waits for
+func (b *broadcaster) run(f func()) {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		f()
+	}()
+}
+
+// stopped reports whether Stop is called
+func (b *broadcaster) stopped() bool {
+	return b.ctx.Err() != nil
+}
+
+// consume broadcasts items from FeedChannel until it is closed or Stop is called
+func (b *broadcaster) consume() {
+	for {
+		select {
+		case item, ok := <-b.FeedChannel:
+			if !ok {
+				return
+			}
+			b.Logger.Debugf("Broadcasting feed item %s", item.Item.Title)
+			b.broadcast(item)
+		case <-b.ctx.Done():
+			return
+		}
+	}
+}
+
+// enqueue puts delivery into queue, returns false if Stop is called
+// the delivery stays in outbox then
+func (b *broadcaster) enqueue(d *delivery) bool {
+	if b.stopped() {
+		return false
+	}
+	select {
+	case b.queue <- d:
+		return true
+	case <-b.ctx.Done():
+		return false
+	}
+}
+
+// replay sends what is left in outbox by last run
+func (b *broadcaster) replay(feeds []*models.Feed, deliveries []*delivery) {
+	if len(feeds) == 0 && len(deliveries) == 0 {
+		return
+	}
+	b.Logger.Infof("Replaying %d feed items and %d deliveries from outbox", len(feeds), len(deliveries))
+	for _, d := range deliveries {
+		if !b.enqueue(d) {
+			return
+		}
+	}
+	for _, item := range feeds {
+		if b.stopped() {
+			return
+		}
+		b.broadcast(item)
+	}
 }
 
 func (b *broadcaster) broadcast(item *models.Feed) {
 	var source models.Source
-	source.ID = item.SourceID
+	if err := b.DB.First(&source, item.SourceID).Error; err != nil {
+		b.Logger.Errorf("Database error: %s", err.Error())
+		return
+	}
 
-	var err error
-	item.TelegraphURL, err = b.tgph.Publish(item)
+	// Telegraph is optional, send with original link if it is not available
+	if item.TelegraphStatus == "" {
+		b.publish(&source, item)
+	}
+
+	// Publishing is canceled by Stop, item is broadcasted again on next start
+	if b.stopped() {
+		return
+	}
+
+	// Find active users subscribed
+	var recipients []*recipient
+	err := b.DB.Model(&models.Subscription{}).
+		Select("users.telegram_id, user_sources.filter, user_sources.delivery, "+
+			"users.delivery AS user_delivery, users.digest_time, users.digest_weekday, users.time_zone").
+		Joins("JOIN users ON users.id = user_sources.user_id").
+		Where("user_sources.source_id = ? AND user_sources.paused = ? AND users.inactive = ?", source.ID, false, false).
+		Scan(&recipients).Error
 	if err != nil {
+		b.Logger.Errorf("Database error: %s", err.Error())
 		return
 	}
 
-	// Find users subscribed
-	var users []*models.User
-	b.DB.Model(&source).Association("Users")
-	b.DB.Model(&source).Association("Users").Find(&users)
+	var chatIDs []int64
+	now := time.Now()
+	for _, r := range recipients {
+		if !b.accept(r, item) {
+			continue
+		}
+		mode := r.mode()
+		if !models.IsDigest(mode) {
+			chatIDs = append(chatIDs, r.TelegramID)
+			continue
+		}
+		loc := (&models.User{TimeZone: r.TimeZone}).Location()
+		due := nextDigest(mode, r.DigestTime, time.Weekday(r.DigestWeekday), now, loc)
+		if err := b.digests.add(r.TelegramID, mode, due, item); err != nil {
+			b.Logger.Errorf("Memory DB insertion error: %s", err.Error())
+		}
+	}
 
-	for _, u := range users {
+	// Persist deliveries before sending so they can be replayed
+	if err := b.outbox.expand(item, chatIDs); err != nil {
+		b.Logger.Errorf("Error writing outbox: %s", err.Error())
+		return
+	}
 
-		// Send message sequentially
-		b.send(u.TelegramID, item)
+	for _, id := range chatIDs {
+		if !b.enqueue(&delivery{Feed: item, ChatID: id}) {
+			return
+		}
 	}
 
 }
 
-func (b *broadcaster) send(telegramID int64, item *models.Feed) {
+// publish creates Telegraph page of item and records the result in TelegraphStatus
+func (b *broadcaster) publish(source *models.Source, item *models.Feed) {
+	if source.DisableTelegraph {
+		item.TelegraphStatus = models.TelegraphDisabled
+		return
+	}
+	ctx, cancel := context.WithTimeout(b.ctx, publishTimeout)
+	defer cancel()
+	url, err := b.tgph.Publish(ctx, item)
+	if err != nil {
+		b.Logger.Warnf("Error publishing \"%s\" to Telegraph, sending without it: %s", item.Item.Title, err.Error())
+		item.TelegraphStatus = models.TelegraphFailed
+		return
+	}
+	item.TelegraphURL = url
+	item.TelegraphStatus = models.TelegraphPublished
+}
 
-	var err error
+// recipient is a chat subscribed to a source with its filter rules
+// and delivery settings
+type recipient struct {
+	TelegramID    int64
+	Filter        string
+	Delivery      string
+	UserDelivery  string
+	DigestTime    int
+	DigestWeekday int
+	TimeZone      string
+}
 
-	// Render message
-	message, err := b.renderer.Render(item)
+// mode returns delivery mode of the subscription
+func (r *recipient) mode() string {
+	if r.Delivery != "" {
+		return r.Delivery
+	}
+	if r.UserDelivery != "" {
+		return r.UserDelivery
+	}
+	return models.DeliveryInstant
+}
+
+// accept checks item against the filter rules of recipient
+// rules are validated when set, so a broken one only logs and lets item through
+func (b *broadcaster) accept(r *recipient, item *models.Feed) bool {
+	if r.Filter == "" || item.Item == nil {
+		return true
+	}
+	f, err := filter.Parse(r.Filter)
 	if err != nil {
-		b.Logger.Errorf("Error rendering message: %s", err.Error())
+		b.Logger.Errorf("Illegal filter of chat %d: %s", r.TelegramID, err.Error())
+		return true
+	}
+	return f.Match(item.Item)
+}
+
+// sender sends deliveries from queue when limiter allows
+// deliveries to chats in quiet hours of queue mode wait until they end
+func (b *broadcaster) sender() {
+	for {
+		var d *delivery
+		select {
+		case d = <-b.queue:
+		case <-b.ctx.Done():
+			return
+		}
+
+		// Done already, like a migrated group merged into a registered supergroup
+		if !b.outbox.waiting(d.Feed.FeedID, d.ChatID) {
+			continue
+		}
+		chat := b.chatSettings(d.ChatID)
+		if until, quiet := chat.QuietUntil(time.Now()); quiet && chat.QuietMode == models.QuietQueue {
+			b.requeue(d, time.Until(until))
+			continue
+		}
+		wait, ok := b.limiter.reserve(d.ChatID, time.Now(), maxSenderWait)
+		if !ok {
+			// Do not hold a sender for a busy chat
+			b.requeue(d, wait)
+			continue
+		}
+		time.Sleep(wait)
+		b.deliver(d, chat)
+	}
+}
+
+// chatSettings loads the user of chat for its delivery settings
+// defaults are used if it can not be loaded
+func (b *broadcaster) chatSettings(chatID int64) *models.User {
+	user := models.User{TelegramID: chatID}
+	if err := b.DB.Where("telegram_id = ?", chatID).First(&user).Error; err != nil {
+		b.Logger.Errorf("Database error: %s", err.Error())
+	}
+	return &user
+}
+
+// requeue puts delivery back into queue after d
+func (b *broadcaster) requeue(d *delivery, after time.Duration) {
+	time.AfterFunc(after, func() {
+		b.enqueue(d)
+	})
+}
+
+// maxDeliveryAttempts is how many times a transient failure is retried with backoff
+// before the delivery is parked
+const maxDeliveryAttempts = 5
+
+// deliveryRetryInterval is the delay before first retry of a failed delivery
+const deliveryRetryInterval = 10 * time.Second
+
+// deliveryParkInterval is the delay between retries of a parked delivery
+const deliveryParkInterval = time.Hour
+
+// renderError is returned by send when the message can not be rendered
+// rendering fails the same way every time, so it is not retried
+type renderError struct {
+	err error
+}
+
+func (e *renderError) Error() string {
+	return "rendering message: " + e.err.Error()
+}
+
+func (e *renderError) Unwrap() error {
+	return e.err
+}
+
+// deliver sends item to chat and marks the delivery done if accepted
+// transient failures are retried with backoff then parked, permanent ones are dropped
+func (b *broadcaster) deliver(d *delivery, chat *models.User) {
+	m, err := b.send(chat, d.Feed)
+
+	// Telegram asks to slow down, try again later
+	var flood telebot.FloodError
+	if errors.As(err, &flood) {
+		retry := time.Duration(flood.RetryAfter) * time.Second
+		if retry <= 0 {
+			retry = time.Second
+		}
+		b.Logger.Warnf("Hitting Telegram rate limit sending to %d, retry after %s", d.ChatID, retry)
+		b.limiter.pause(d.ChatID, retry, time.Now())
+		b.requeue(d, retry)
 		return
 	}
 
-	// Set telebot options
-	options := &telebot.SendOptions{
-		DisableWebPagePreview: false,
-		ParseMode:             telebot.ModeMarkdownV2,
-		DisableNotification:   true,
+	// Group upgraded to supergroup, follow it to the new chat
+	if isChatMigrated(err) {
+		b.migrate(d)
+		return
+	}
+
+	// Chat blocked or removed the bot, stop sending to it
+	var renderErr *renderError
+	if isChatGone(err) {
+		b.deactivate(d.ChatID)
+	} else if isPermanent(err) || errors.As(err, &renderErr) {
+		// Message can never be sent, drop it so it is not resent forever
+		b.Logger.Errorf("Dropping item %s for chat %d: %s", d.Feed.FeedID, d.ChatID, err.Error())
+	} else if err != nil {
+		d.Attempts++
+		retry := deliveryParkInterval
+		if d.Attempts < maxDeliveryAttempts {
+			retry = backoff(deliveryRetryInterval, d.Attempts-1)
+		}
+		b.Logger.Warnf("Error sending item %s to chat %d, retry after %s: %s", d.Feed.FeedID, d.ChatID, retry, err.Error())
+		b.requeue(d, retry)
+		return
+	}
+
+	// Sent without Telegraph page, add it to the message once publishing works
+	if err == nil && d.Feed.TelegraphStatus == models.TelegraphFailed {
+		if err := b.retries.add(d.Feed, d.ChatID, m.ID); err != nil {
+			b.Logger.Errorf("Memory DB insertion error: %s", err.Error())
+		}
+	}
+	if err := b.outbox.done(d.Feed.FeedID, d.ChatID); err != nil {
+		b.Logger.Errorf("Error writing outbox: %s", err.Error())
+	}
+}
+
+// deactivate pauses subscriptions of chat until it sends /start again
+func (b *broadcaster) deactivate(chatID int64) {
+	b.Logger.Infof("Chat %d blocked or removed the bot, deactivating", chatID)
+	err := b.DB.Model(&models.User{}).Where("telegram_id = ?", chatID).Update("inactive", true).Error
+	if err != nil {
+		b.Logger.Errorf("Database error: %s", err.Error())
+	}
+}
+
+// migrate moves subscriptions of a migrated group and resends delivery
+func (b *broadcaster) migrate(d *delivery) {
+	to, ok := migratedTo(b.Bot, d.ChatID)
+	if !ok {
+		b.Logger.Errorf("Chat %d migrated but new chat ID unknown", d.ChatID)
+		return
+	}
+	b.Logger.Infof("Chat %d migrated to %d", d.ChatID, to)
+	if err := MigrateChat(b.DB, b.MemDB, d.ChatID, to); err != nil {
+		b.Logger.Errorf("Error migrating chat %d: %s", d.ChatID, err.Error())
+		return
+	}
+	b.enqueue(&delivery{Feed: d.Feed, ChatID: to})
+}
+
+func (b *broadcaster) send(chat *models.User, item *models.Feed) (*telebot.Message, error) {
+
+	var err error
+	telegramID := chat.TelegramID
+
+	// Render message with template of the chat
+	message, err := b.render(chat, item)
+	if err != nil {
+		b.Logger.Errorf("Error rendering message: %s", err.Error())
+		return nil, &renderError{err: err}
 	}
 
 	// Send via bot
-	m, err := b.Bot.Send(&tgRecipient{ID: telegramID}, message, options)
+	m, err := b.Bot.Send(&tgRecipient{ID: telegramID}, message, b.sendOptions(item, telegramID, chat.Silent(time.Now())))
 	if err != nil {
 		b.Logger.Errorf("Error sending message: %s\n Message is: %s", err.Error(), message)
+		return nil, err
 	}
 
 	// Store the message ID into DB
-	// For /unsub to use
+	// For /unsub replying to it to use
 	err = b.MemDB.Update(func(tx *buntdb.Tx) error {
-		_, _, err := tx.Set(strconv.Itoa(m.ID), strconv.Itoa(int(item.SourceID)), nil)
+		_, _, err := tx.Set(MessageKey(telegramID, m.ID), strconv.Itoa(int(item.SourceID)), &buntdb.SetOptions{Expires: true, TTL: messageTTL})
 		return err
 	})
 	if err != nil {
 		b.Logger.Errorf("Memory DB insertion error: %s", err.Error())
 	}
+	return m, nil
+}
 
+// sendOptions returns telebot options of item broadcasted to chat
+func (b *broadcaster) sendOptions(item *models.Feed, chatID int64, silent bool) *telebot.SendOptions {
+	opts := &telebot.SendOptions{
+		DisableWebPagePreview: false,
+		ParseMode:             telebot.ModeMarkdownV2,
+		DisableNotification:   silent,
+	}
+	if b.Markup != nil {
+		opts.ReplyMarkup = b.Markup(item, chatID)
+	}
+	return opts
 }
@@ -0,0 +1,158 @@
+package feed
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/TechMinerApps/portier/models"
+	"github.com/TechMinerApps/portier/modules/render"
+	"github.com/mmcdole/gofeed"
+	"github.com/tidwall/buntdb"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func Test_broadcaster_deliver(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Template{}); err != nil {
+		t.Fatal(err)
+	}
+	memdb, err := buntdb.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer memdb.Close()
+	tests := []struct {
+		name     string
+		template string
+		wantSent int
+	}{
+		{
+			// Telegram refuses the message itself, it would be refused again after restart
+			name:     "Refused by Telegram",
+			wantSent: 1,
+		},
+		{
+			// Item has no author, rendering fails the same way every time
+			name:     "Broken template",
+			template: "{{ .Item.Author.Name }}",
+			wantSent: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			renderer, err := render.NewRenderer(render.Config{Template: tt.template})
+			if err != nil {
+				t.Fatal(err)
+			}
+			bot, sent := fakeTelegram(t, func(m sentMessage) string {
+				return "Bad Request: message thread not found"
+			})
+			b := &broadcaster{
+				renderer:  renderer,
+				templates: render.NewCache(templateCacheSize),
+				outbox:    &outbox{db: memdb},
+				queue:     make(chan *delivery, 1),
+				BroadCastConfig: BroadCastConfig{
+					DB:     db,
+					MemDB:  memdb,
+					Bot:    bot,
+					Logger: zap.NewNop().Sugar(),
+				},
+			}
+			chat := &models.User{TelegramID: 10}
+			feed := &models.Feed{SourceID: 1, FeedID: "a", Item: &gofeed.Item{Title: "a"}}
+			if err := b.outbox.expand(feed, []int64{chat.TelegramID}); err != nil {
+				t.Fatal(err)
+			}
+
+			b.deliver(&delivery{Feed: feed, ChatID: chat.TelegramID}, chat)
+
+			if len(*sent) != tt.wantSent {
+				t.Errorf("sent %d messages, want %d", len(*sent), tt.wantSent)
+			}
+			if _, deliveries, _ := b.outbox.pending(); len(deliveries) != 0 {
+				t.Errorf("outbox kept %d deliveries which can never be sent, want 0", len(deliveries))
+			}
+			if len(b.queue) != 0 {
+				t.Errorf("delivery which can never be sent was queued again")
+			}
+		})
+	}
+}
+
+func Test_broadcaster_Stop(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Template{}); err != nil {
+		t.Fatal(err)
+	}
+	memdb, err := buntdb.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer memdb.Close()
+	renderer, err := render.NewRenderer(render.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Telegram answers once the test lets it
+	sending := make(chan struct{})
+	answer := make(chan struct{})
+	bot, _ := fakeTelegram(t, func(m sentMessage) string {
+		close(sending)
+		<-answer
+		return ""
+	})
+	b := &broadcaster{
+		renderer:  renderer,
+		templates: render.NewCache(templateCacheSize),
+		outbox:    &outbox{db: memdb},
+		limiter:   newLimiter(),
+		queue:     make(chan *delivery, 1),
+		BroadCastConfig: BroadCastConfig{
+			DB:     db,
+			MemDB:  memdb,
+			Bot:    bot,
+			Logger: zap.NewNop().Sugar(),
+		},
+	}
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	feed := &models.Feed{SourceID: 1, FeedID: "a", Item: &gofeed.Item{Title: "a"}}
+	if err := b.outbox.expand(feed, []int64{10}); err != nil {
+		t.Fatal(err)
+	}
+	b.run(b.sender)
+	b.queue <- &delivery{Feed: feed, ChatID: 10}
+	<-sending
+
+	stopped := make(chan struct{})
+	go func() {
+		b.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		t.Fatal("Stop() returned while a delivery is running")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(answer)
+	<-stopped
+
+	// The running delivery is marked done before Stop returns
+	if _, deliveries, _ := b.outbox.pending(); len(deliveries) != 0 {
+		t.Errorf("outbox kept %d deliveries after Stop, want 0", len(deliveries))
+	}
+	// Nothing is taken from queue after Stop
+	if b.enqueue(&delivery{Feed: feed, ChatID: 10}) {
+		t.Errorf("enqueue() = true after Stop")
+	}
+}
@@ -0,0 +1,108 @@
+package feed
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+// goneErrors are errors meaning the chat will never accept messages
+// until user talks to the bot again
+var goneErrors = []error{
+	telebot.ErrBlockedByUser,
+	telebot.ErrUserIsDeactivated,
+	telebot.ErrNotStartedByUser,
+	telebot.ErrChatNotFound,
+	telebot.ErrBotKickedFromGroup,
+	telebot.ErrBotKickedFromSuperGroup,
+
+	// telebot maps "bot was kicked from the group chat" to this error
+	telebot.ErrKickingChatOwner,
+}
+
+// goneDescriptions match errors telebot does not know
+var goneDescriptions = []string{
+	"bot was blocked by the user",
+	"user is deactivated",
+	"chat not found",
+	"bot was kicked",
+	"bot is not a member",
+}
+
+// migratedDescription is returned when sending to a group upgraded to supergroup
+const migratedDescription = "group chat was upgraded to a supergroup chat"
+
+// isChatGone reports whether err means the chat blocked or removed the bot
+func isChatGone(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, e := range goneErrors {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	message := err.Error()
+	for _, d := range goneDescriptions {
+		if strings.Contains(message, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDescription is returned for messages with broken formatting
+const parseDescription = "can't parse entities"
+
+// isParseError reports whether err means Telegram can not parse formatting of a message
+func isParseError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), parseDescription)
+}
+
+// errorCodeRegex matches the code telebot appends to API errors
+var errorCodeRegex = regexp.MustCompile(`\((\d{3})\)$`)
+
+// isPermanent reports whether err means Telegram will never accept the message
+// like bad requests and forbidden chats, sending it again does not help
+// rate limits, migrations and gone chats are handled before and are not permanent
+func isPermanent(err error) bool {
+	if err == nil {
+		return false
+	}
+	code := 0
+	var apiErr *telebot.APIError
+	if errors.As(err, &apiErr) {
+		code = apiErr.Code
+	} else if match := errorCodeRegex.FindStringSubmatch(err.Error()); match != nil {
+		code, _ = strconv.Atoi(match[1])
+	}
+	return code >= 400 && code < 500 && code != 429
+}
+
+// isChatMigrated reports whether err means the group is now a supergroup
+func isChatMigrated(err error) bool {
+	return err != nil && strings.Contains(err.Error(), migratedDescription)
+}
+
+// migratedTo asks Telegram for the new ID of a migrated group
+// telebot drops the migrate_to_chat_id parameter from errors
+// so a harmless chat action is sent to read the raw response
+func migratedTo(bot *telebot.Bot, chatID int64) (int64, bool) {
+	data, _ := bot.Raw("sendChatAction", map[string]interface{}{
+		"chat_id": chatID,
+		"action":  telebot.Typing,
+	})
+	var resp struct {
+		Parameters struct {
+			MigrateTo int64 `json:"migrate_to_chat_id"`
+		} `json:"parameters"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil || resp.Parameters.MigrateTo == 0 {
+		return 0, false
+	}
+	return resp.Parameters.MigrateTo, true
+}
@@ -0,0 +1,101 @@
+package feed
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+func Test_isChatGone(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "Nil",
+			err:  nil,
+			want: false,
+		},
+		{
+			name: "Blocked",
+			err:  telebot.ErrBlockedByUser,
+			want: true,
+		},
+		{
+			name: "Chat not found",
+			err:  telebot.ErrChatNotFound,
+			want: true,
+		},
+		{
+			name: "Unknown kicked",
+			err:  fmt.Errorf("telegram unknown: Forbidden: bot was kicked from the channel chat (403)"),
+			want: true,
+		},
+		{
+			name: "Flood",
+			err:  telebot.FloodError{APIError: telebot.NewAPIError(429, "Too Many Requests: retry after 5"), RetryAfter: 5},
+			want: false,
+		},
+		{
+			name: "Network",
+			err:  errors.New("connection reset by peer"),
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isChatGone(tt.err); got != tt.want {
+				t.Errorf("isChatGone() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_isPermanent(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "Nil",
+			err:  nil,
+			want: false,
+		},
+		{
+			name: "Known bad request",
+			err:  telebot.ErrEmptyMessage,
+			want: true,
+		},
+		{
+			name: "Unknown bad request",
+			err:  fmt.Errorf("telegram unknown: Bad Request: message thread not found (400)"),
+			want: true,
+		},
+		{
+			name: "Server error",
+			err:  fmt.Errorf("telegram unknown: Internal Server Error (500)"),
+			want: false,
+		},
+		{
+			name: "Flood",
+			err:  telebot.FloodError{APIError: telebot.NewAPIError(429, "Too Many Requests: retry after 5"), RetryAfter: 5},
+			want: false,
+		},
+		{
+			name: "Network",
+			err:  errors.New("connection reset by peer"),
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isPermanent(tt.err); got != tt.want {
+				t.Errorf("isPermanent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,396 @@
+package feed
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TechMinerApps/portier/models"
+	"github.com/TechMinerApps/portier/modules/render"
+	"github.com/tidwall/buntdb"
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+// Digest keys in memory db
+// digest:due:<ChatID>:<Mode> holds when the digest of a chat is sent, in RFC 3339
+// digest:item:<ChatID>:<Mode>:<FeedID> holds an item waiting for the digest
+// digest:attempts:<ChatID>:<Mode> counts failed attempts to send the digest
+const (
+	digestDuePrefix      = "digest:due:"
+	digestItemPrefix     = "digest:item:"
+	digestAttemptsPrefix = "digest:attempts:"
+)
+
+// digestCheckInterval is the period of looking for due digests
+const digestCheckInterval = time.Minute
+
+// maxDigestAttempts is the number of failed sends before a digest is dropped
+const maxDigestAttempts = 3
+
+// digestEntry is an item stored for a digest
+type digestEntry struct {
+	Feed    *models.Feed
+	AddedAt time.Time
+}
+
+// digestBatch is a digest of a chat in one mode
+type digestBatch struct {
+	ChatID int64
+	Mode   string
+}
+
+// digests holds items of chats in digest modes until they are due
+type digests struct {
+	db *buntdb.DB
+}
+
+func digestDueKey(chatID int64, mode string) string {
+	return digestDuePrefix + strconv.FormatInt(chatID, 10) + ":" + mode
+}
+
+func digestAttemptsKey(chatID int64, mode string) string {
+	return digestAttemptsPrefix + strconv.FormatInt(chatID, 10) + ":" + mode
+}
+
+func digestItemPrefixOf(chatID int64, mode string) string {
+	return digestItemPrefix + strconv.FormatInt(chatID, 10) + ":" + mode + ":"
+}
+
+// moveChat moves digests of a chat to another within tx
+// used when a group is migrated to supergroup
+func (d *digests) moveChat(tx *buntdb.Tx, from int64, to int64) error {
+	moves := make(map[string]string)
+	for _, prefix := range []string{digestDuePrefix, digestItemPrefix, digestAttemptsPrefix} {
+		old := prefix + strconv.FormatInt(from, 10) + ":"
+		err := tx.AscendKeys(old+"*", func(key, value string) bool {
+			moves[key] = prefix + strconv.FormatInt(to, 10) + ":" + strings.TrimPrefix(key, old)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return renameKeys(tx, moves)
+}
+
+// add stores item for the digest of chat
+// due is only set if the digest has none, so it is not pushed back by new items
+func (d *digests) add(chatID int64, mode string, due time.Time, feed *models.Feed) error {
+	data, err := json.Marshal(&digestEntry{Feed: feed, AddedAt: time.Now()})
+	if err != nil {
+		return err
+	}
+	return d.db.Update(func(tx *buntdb.Tx) error {
+		if _, _, err := tx.Set(digestItemPrefixOf(chatID, mode)+feed.FeedID, string(data), nil); err != nil {
+			return err
+		}
+		_, err := tx.Get(digestDueKey(chatID, mode))
+		if err != buntdb.ErrNotFound {
+			return err
+		}
+		_, _, err = tx.Set(digestDueKey(chatID, mode), due.Format(time.RFC3339), nil)
+		return err
+	})
+}
+
+// due returns digests to send at now
+func (d *digests) due(now time.Time) ([]digestBatch, error) {
+	var batches []digestBatch
+	err := d.db.View(func(tx *buntdb.Tx) error {
+		return tx.AscendKeys(digestDuePrefix+"*", func(key, value string) bool {
+			at, err := time.Parse(time.RFC3339, value)
+			if err != nil || at.After(now) {
+				return true
+			}
+			parts := strings.Split(strings.TrimPrefix(key, digestDuePrefix), ":")
+			if len(parts) != 2 {
+				return true
+			}
+			chatID, err := strconv.ParseInt(parts[0], 10, 64)
+			if err != nil {
+				return true
+			}
+			batches = append(batches, digestBatch{ChatID: chatID, Mode: parts[1]})
+			return true
+		})
+	})
+	return batches, err
+}
+
+// items returns items of a digest in the order they were added
+func (d *digests) items(chatID int64, mode string) ([]*models.Feed, error) {
+	var entries []*digestEntry
+	err := d.db.View(func(tx *buntdb.Tx) error {
+		var err error
+		tx.AscendKeys(digestItemPrefixOf(chatID, mode)+"*", func(key, value string) bool {
+			var entry digestEntry
+			if err = json.Unmarshal([]byte(value), &entry); err != nil {
+				return false
+			}
+			entries = append(entries, &entry)
+			return true
+		})
+		return err
+	})
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].AddedAt.Before(entries[j].AddedAt)
+	})
+	feeds := make([]*models.Feed, 0, len(entries))
+	for _, e := range entries {
+		feeds = append(feeds, e.Feed)
+	}
+	return feeds, err
+}
+
+// remove deletes sent items of a digest
+// items added while sending keep the digest due, so they go out on next check
+func (d *digests) remove(chatID int64, mode string, feeds []*models.Feed) error {
+	return d.db.Update(func(tx *buntdb.Tx) error {
+		prefix := digestItemPrefixOf(chatID, mode)
+		for _, feed := range feeds {
+			if _, err := tx.Delete(prefix + feed.FeedID); err != nil && err != buntdb.ErrNotFound {
+				return err
+			}
+		}
+		remaining := false
+		tx.AscendKeys(prefix+"*", func(key, value string) bool {
+			remaining = true
+			return false
+		})
+		if remaining {
+			return nil
+		}
+		for _, key := range []string{digestDueKey(chatID, mode), digestAttemptsKey(chatID, mode)} {
+			if _, err := tx.Delete(key); err != nil && err != buntdb.ErrNotFound {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// drop deletes a digest with all its items
+func (d *digests) drop(chatID int64, mode string) error {
+	return d.db.Update(func(tx *buntdb.Tx) error {
+		keys := []string{digestDueKey(chatID, mode), digestAttemptsKey(chatID, mode)}
+		tx.AscendKeys(digestItemPrefixOf(chatID, mode)+"*", func(key, value string) bool {
+			keys = append(keys, key)
+			return true
+		})
+		for _, key := range keys {
+			if _, err := tx.Delete(key); err != nil && err != buntdb.ErrNotFound {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// fail counts a failed attempt of a digest and moves it to its next schedule
+// the number of failed attempts is returned
+func (d *digests) fail(chatID int64, mode string, now time.Time) (int, error) {
+	attempts := 0
+	err := d.db.Update(func(tx *buntdb.Tx) error {
+		if value, err := tx.Get(digestAttemptsKey(chatID, mode)); err == nil {
+			attempts, _ = strconv.Atoi(value)
+		}
+		attempts++
+		if _, _, err := tx.Set(digestAttemptsKey(chatID, mode), strconv.Itoa(attempts), nil); err != nil {
+			return err
+		}
+		return postpone(tx, chatID, mode, now)
+	})
+	return attempts, err
+}
+
+// delay makes a digest due at until
+func (d *digests) delay(chatID int64, mode string, until time.Time) error {
+	return d.db.Update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set(digestDueKey(chatID, mode), until.Format(time.RFC3339), nil)
+		return err
+	})
+}
+
+// postpone moves a due digest to its next schedule within tx
+func postpone(tx *buntdb.Tx, chatID int64, mode string, now time.Time) error {
+	due := now
+	if value, err := tx.Get(digestDueKey(chatID, mode)); err == nil {
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			due = t
+		}
+	}
+	for !due.After(now) {
+		due = due.Add(digestPeriod(mode))
+	}
+	_, _, err := tx.Set(digestDueKey(chatID, mode), due.Format(time.RFC3339), nil)
+	return err
+}
+
+// digestPeriod returns the time between two digests of mode
+func digestPeriod(mode string) time.Duration {
+	switch mode {
+	case models.DeliveryDaily:
+		return 24 * time.Hour
+	case models.DeliveryWeekly:
+		return 7 * 24 * time.Hour
+	default:
+		return time.Hour
+	}
+}
+
+// nextDigest returns when the next digest of mode is sent after now
+// hourly digests are sent at the top of hours
+// daily and weekly ones at minute after midnight in loc, on weekday for weekly
+func nextDigest(mode string, minute int, weekday time.Weekday, now time.Time, loc *time.Location) time.Time {
+	local := now.In(loc)
+	if mode == models.DeliveryHourly {
+		return time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), 0, 0, 0, loc).Add(time.Hour)
+	}
+	next := time.Date(local.Year(), local.Month(), local.Day(), minute/60, minute%60, 0, 0, loc)
+	days := 1
+	if mode == models.DeliveryWeekly {
+		next = next.AddDate(0, 0, (int(weekday)-int(local.Weekday())+7)%7)
+		days = 7
+	}
+	if !next.After(now) {
+		next = next.AddDate(0, 0, days)
+	}
+	return next
+}
+
+// flushDigests sends due digests periodically
+func (b *broadcaster) flushDigests() {
+	ticker := time.NewTicker(digestCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-b.ctx.Done():
+			return
+		}
+		batches, err := b.digests.due(time.Now())
+		if err != nil {
+			b.Logger.Errorf("Memory DB error: %s", err.Error())
+			continue
+		}
+		for _, batch := range batches {
+			if b.stopped() {
+				return
+			}
+			b.flushDigest(batch)
+		}
+	}
+}
+
+// flushDigest renders a digest and sends it in as many messages as needed
+// items are removed as soon as the message holding them is sent
+// so a failure later does not send them again
+// digests due in quiet hours of queue mode wait until they end
+func (b *broadcaster) flushDigest(batch digestBatch) {
+	chat := b.chatSettings(batch.ChatID)
+	now := time.Now()
+	if until, quiet := chat.QuietUntil(now); quiet && chat.QuietMode == models.QuietQueue {
+		if err := b.digests.delay(batch.ChatID, batch.Mode, until); err != nil {
+			b.Logger.Errorf("Memory DB error: %s", err.Error())
+		}
+		return
+	}
+	feeds, err := b.digests.items(batch.ChatID, batch.Mode)
+	if err != nil {
+		b.Logger.Errorf("Memory DB error: %s", err.Error())
+		return
+	}
+	loc := chat.Location()
+	for _, feed := range feeds {
+		feed.Location = loc
+	}
+	parts, err := b.renderer.RenderDigest(&render.Digest{Mode: batch.Mode, Items: feeds}, render.MaxMessageLength)
+	if err != nil {
+		b.Logger.Errorf("Error rendering digest: %s", err.Error())
+		b.failDigest(batch)
+		return
+	}
+
+	for _, part := range parts {
+		err := b.sendDigestPart(batch.ChatID, part.Text, chat.Silent(now))
+		if isChatGone(err) {
+			b.deactivate(batch.ChatID)
+			b.dropDigest(batch)
+			return
+		}
+		if err != nil {
+			b.Logger.Errorf("Error sending digest to %d: %s", batch.ChatID, err.Error())
+			b.failDigest(batch)
+			return
+		}
+		if err := b.digests.remove(batch.ChatID, batch.Mode, part.Items); err != nil {
+			b.Logger.Errorf("Memory DB error: %s", err.Error())
+			return
+		}
+	}
+	if len(parts) == 0 {
+		b.dropDigest(batch)
+	}
+}
+
+// failDigest postpones a digest to its next schedule
+// it is dropped after maxDigestAttempts so a broken one does not pile up forever
+func (b *broadcaster) failDigest(batch digestBatch) {
+	attempts, err := b.digests.fail(batch.ChatID, batch.Mode, time.Now())
+	if err != nil {
+		b.Logger.Errorf("Memory DB error: %s", err.Error())
+		return
+	}
+	if attempts >= maxDigestAttempts {
+		b.Logger.Errorf("Dropping %s digest of chat %d after %d failed attempts", batch.Mode, batch.ChatID, attempts)
+		b.dropDigest(batch)
+	}
+}
+
+func (b *broadcaster) dropDigest(batch digestBatch) {
+	if err := b.digests.drop(batch.ChatID, batch.Mode); err != nil {
+		b.Logger.Errorf("Memory DB error: %s", err.Error())
+	}
+}
+
+// sendDigestPart sends a message of a digest following rate limits
+// it is sent as plain text if Telegram can not parse its MarkdownV2
+func (b *broadcaster) sendDigestPart(chatID int64, text string, silent bool) error {
+	opts := &telebot.SendOptions{
+		DisableWebPagePreview: true,
+		ParseMode:             telebot.ModeMarkdownV2,
+		DisableNotification:   silent,
+	}
+	for {
+		for {
+			wait, ok := b.limiter.reserve(chatID, time.Now(), maxSenderWait)
+			time.Sleep(wait)
+			if ok {
+				break
+			}
+		}
+		_, err := b.Bot.Send(&tgRecipient{ID: chatID}, text, opts)
+
+		// Telegram asks to slow down, send the part again later
+		var flood telebot.FloodError
+		if errors.As(err, &flood) {
+			retry := time.Duration(flood.RetryAfter) * time.Second
+			if retry <= 0 {
+				retry = time.Second
+			}
+			b.Logger.Warnf("Hitting Telegram rate limit sending digest to %d, retry after %s", chatID, retry)
+			b.limiter.pause(chatID, retry, time.Now())
+			continue
+		}
+		if isParseError(err) && opts.ParseMode != telebot.ModeDefault {
+			b.Logger.Warnf("Digest to %d not accepted as MarkdownV2, sending as plain text: %s", chatID, err.Error())
+			text = render.UnescapeMarkdown(text)
+			opts.ParseMode = telebot.ModeDefault
+			continue
+		}
+		return err
+	}
+}
@@ -0,0 +1,356 @@
+package feed
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TechMinerApps/portier/models"
+	"github.com/TechMinerApps/portier/modules/render"
+	"github.com/mmcdole/gofeed"
+	"github.com/tidwall/buntdb"
+	"go.uber.org/zap"
+	"gopkg.in/tucnak/telebot.v2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func Test_nextDigest(t *testing.T) {
+	// 2021-06-02 is a Wednesday
+	now := time.Date(2021, 6, 2, 10, 30, 0, 0, time.UTC)
+	tokyo := time.FixedZone("JST", 9*60*60)
+	india := time.FixedZone("IST", 5*60*60+30*60)
+	tests := []struct {
+		name    string
+		mode    string
+		minute  int
+		weekday time.Weekday
+		loc     *time.Location
+		want    time.Time
+	}{
+		{
+			name: "Hourly",
+			loc:  time.UTC,
+			mode: models.DeliveryHourly,
+			want: time.Date(2021, 6, 2, 11, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "Daily later today",
+			loc:    time.UTC,
+			mode:   models.DeliveryDaily,
+			minute: 18 * 60,
+			want:   time.Date(2021, 6, 2, 18, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "Daily passed today",
+			loc:    time.UTC,
+			mode:   models.DeliveryDaily,
+			minute: 8 * 60,
+			want:   time.Date(2021, 6, 3, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "Weekly later this week",
+			loc:     time.UTC,
+			mode:    models.DeliveryWeekly,
+			minute:  9 * 60,
+			weekday: time.Friday,
+			want:    time.Date(2021, 6, 4, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "Weekly passed today",
+			loc:     time.UTC,
+			mode:    models.DeliveryWeekly,
+			minute:  9 * 60,
+			weekday: time.Wednesday,
+			want:    time.Date(2021, 6, 9, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "Weekly next week",
+			loc:     time.UTC,
+			mode:    models.DeliveryWeekly,
+			weekday: time.Monday,
+			want:    time.Date(2021, 6, 7, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "Hourly in half hour offset",
+			mode: models.DeliveryHourly,
+			loc:  india,
+			want: time.Date(2021, 6, 2, 11, 30, 0, 0, time.UTC),
+		},
+		{
+			name:   "Daily in time zone",
+			mode:   models.DeliveryDaily,
+			minute: 8 * 60,
+			loc:    tokyo,
+			want:   time.Date(2021, 6, 3, 8, 0, 0, 0, tokyo),
+		},
+		{
+			name:    "Weekly on local weekday",
+			mode:    models.DeliveryWeekly,
+			minute:  9 * 60,
+			weekday: time.Thursday,
+			loc:     tokyo,
+			want:    time.Date(2021, 6, 3, 9, 0, 0, 0, tokyo),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nextDigest(tt.mode, tt.minute, tt.weekday, now, tt.loc); !got.Equal(tt.want) {
+				t.Errorf("nextDigest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_digests(t *testing.T) {
+	db, err := buntdb.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	d := &digests{db: db}
+
+	now := time.Date(2021, 6, 2, 10, 30, 0, 0, time.UTC)
+	newFeed := func(id string) *models.Feed {
+		return &models.Feed{SourceID: 1, FeedID: id, Item: &gofeed.Item{Title: id}}
+	}
+	for _, id := range []string{"b", "a"} {
+		if err := d.add(10, models.DeliveryHourly, now.Add(time.Hour), newFeed(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Later items do not push back the digest
+	if err := d.add(10, models.DeliveryHourly, now.Add(2*time.Hour), newFeed("c")); err != nil {
+		t.Fatal(err)
+	}
+
+	if batches, _ := d.due(now); len(batches) != 0 {
+		t.Errorf("digests.due() = %v before due, want none", batches)
+	}
+	batches, err := d.due(now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batches) != 1 || batches[0].ChatID != 10 || batches[0].Mode != models.DeliveryHourly {
+		t.Fatalf("digests.due() = %v, want [10 hourly]", batches)
+	}
+
+	feeds, err := d.items(10, models.DeliveryHourly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feeds) != 3 || feeds[0].FeedID != "b" || feeds[1].FeedID != "a" || feeds[2].FeedID != "c" {
+		t.Fatalf("digests.items() = %v, want [b a c] in order added", feeds)
+	}
+
+	// Failed digests wait for the next schedule
+	attempts, err := d.fail(10, models.DeliveryHourly, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 1 {
+		t.Errorf("digests.fail() = %d, want 1", attempts)
+	}
+	if batches, _ := d.due(now.Add(time.Hour)); len(batches) != 0 {
+		t.Errorf("digests.due() = %v after failed, want none", batches)
+	}
+
+	// Items added while sending stay due
+	if err := d.remove(10, models.DeliveryHourly, feeds[:2]); err != nil {
+		t.Fatal(err)
+	}
+	if batches, _ := d.due(now.Add(2 * time.Hour)); len(batches) != 1 {
+		t.Errorf("digests.due() = %v with items left, want one", batches)
+	}
+	if err := d.remove(10, models.DeliveryHourly, feeds[2:]); err != nil {
+		t.Fatal(err)
+	}
+	if batches, _ := d.due(now.Add(24 * time.Hour)); len(batches) != 0 {
+		t.Errorf("digests.due() = %v after sent, want none", batches)
+	}
+}
+
+func Test_digests_drop(t *testing.T) {
+	db, err := buntdb.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	d := &digests{db: db}
+
+	now := time.Now()
+	feed := &models.Feed{SourceID: 1, FeedID: "a", Item: &gofeed.Item{Title: "a"}}
+	if err := d.add(10, models.DeliveryDaily, now, feed); err != nil {
+		t.Fatal(err)
+	}
+	d.fail(10, models.DeliveryDaily, now)
+	if err := d.drop(10, models.DeliveryDaily); err != nil {
+		t.Fatal(err)
+	}
+	if feeds, _ := d.items(10, models.DeliveryDaily); len(feeds) != 0 {
+		t.Errorf("digests.items() = %v after drop, want none", feeds)
+	}
+	if batches, _ := d.due(now.Add(30 * 24 * time.Hour)); len(batches) != 0 {
+		t.Errorf("digests.due() = %v after drop, want none", batches)
+	}
+
+	// Attempts start over for a new digest
+	d.add(10, models.DeliveryDaily, now, feed)
+	if attempts, _ := d.fail(10, models.DeliveryDaily, now); attempts != 1 {
+		t.Errorf("digests.fail() = %d after drop, want 1", attempts)
+	}
+}
+
+// sentMessage is a sendMessage call to fakeTelegram
+type sentMessage struct {
+	Text      string `json:"text"`
+	ParseMode string `json:"parse_mode"`
+}
+
+// fakeTelegram answers sendMessage with reject, ok if it returns empty
+func fakeTelegram(t *testing.T, reject func(m sentMessage) string) (*telebot.Bot, *[]sentMessage) {
+	var sent []sentMessage
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch path.Base(r.URL.Path) {
+		case "getMe":
+			w.Write([]byte(`{"ok":true,"result":{"id":1,"is_bot":true,"username":"portier_bot"}}`))
+		case "sendMessage":
+			var m sentMessage
+			json.NewDecoder(r.Body).Decode(&m)
+			sent = append(sent, m)
+			if description := reject(m); description != "" {
+				w.Write([]byte(`{"ok":false,"error_code":400,"description":"` + description + `"}`))
+				return
+			}
+			w.Write([]byte(`{"ok":true,"result":{"message_id":1,"chat":{"id":10}}}`))
+		}
+	}))
+	t.Cleanup(api.Close)
+	bot, err := telebot.NewBot(telebot.Settings{URL: api.URL, Token: "token", Reporter: func(error) {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bot, &sent
+}
+
+func Test_broadcaster_flushDigest(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.User{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&models.User{TelegramID: 10})
+	renderer, err := render.NewRenderer(render.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Long titles put every item in its own message
+	newFeed := func(id string) *models.Feed {
+		return &models.Feed{SourceID: 1, FeedID: id, Item: &gofeed.Item{Title: id + strings.Repeat(" x", 1500)}}
+	}
+	batch := digestBatch{ChatID: 10, Mode: models.DeliveryDaily}
+
+	tests := []struct {
+		name string
+		// reject decides response of n-th flush to a message
+		reject     func(flush int, m sentMessage) string
+		flushes    int
+		wantSent   []string
+		wantQueued int
+	}{
+		{
+			name: "Sent parts are not sent again",
+			reject: func(flush int, m sentMessage) string {
+				if flush == 0 && strings.HasPrefix(m.Text[strings.Index(m.Text, "•"):], "• B") {
+					return "Bad Request: message thread not found"
+				}
+				return ""
+			},
+			flushes:    2,
+			wantSent:   []string{"A", "B", "B"},
+			wantQueued: 0,
+		},
+		{
+			name: "Plain text if Markdown is rejected",
+			reject: func(flush int, m sentMessage) string {
+				if m.ParseMode != "" && strings.Contains(m.Text, "• A") {
+					return "Bad Request: can't parse entities: character '-' is reserved"
+				}
+				return ""
+			},
+			flushes:    1,
+			wantSent:   []string{"A", "A", "B"},
+			wantQueued: 0,
+		},
+		{
+			name: "Dropped after too many attempts",
+			reject: func(flush int, m sentMessage) string {
+				return "Bad Request: message thread not found"
+			},
+			flushes:    maxDigestAttempts,
+			wantSent:   []string{"A", "A", "A"},
+			wantQueued: 0,
+		},
+		{
+			name: "Kept before too many attempts",
+			reject: func(flush int, m sentMessage) string {
+				return "Bad Request: message thread not found"
+			},
+			flushes:    maxDigestAttempts - 1,
+			wantSent:   []string{"A", "A"},
+			wantQueued: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memdb, err := buntdb.Open(":memory:")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer memdb.Close()
+
+			flush := 0
+			bot, sent := fakeTelegram(t, func(m sentMessage) string { return tt.reject(flush, m) })
+			b := &broadcaster{
+				renderer: renderer,
+				digests:  &digests{db: memdb},
+				BroadCastConfig: BroadCastConfig{
+					DB:     db,
+					MemDB:  memdb,
+					Bot:    bot,
+					Logger: zap.NewNop().Sugar(),
+				},
+			}
+			for _, id := range []string{"A", "B"} {
+				if err := b.digests.add(batch.ChatID, batch.Mode, time.Now(), newFeed(id)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for ; flush < tt.flushes; flush++ {
+				// Each flush starts with free rate limits to keep the test fast
+				b.limiter = newLimiter()
+				b.flushDigest(batch)
+			}
+
+			var got []string
+			for _, m := range *sent {
+				text := m.Text[strings.Index(m.Text, "•"):]
+				got = append(got, strings.TrimPrefix(text, "• ")[:1])
+			}
+			if !reflect.DeepEqual(got, tt.wantSent) {
+				t.Errorf("sent items %v, want %v", got, tt.wantSent)
+			}
+			if feeds, _ := b.digests.items(batch.ChatID, batch.Mode); len(feeds) != tt.wantQueued {
+				t.Errorf("%d items left in digest, want %d", len(feeds), tt.wantQueued)
+			}
+		})
+	}
+}
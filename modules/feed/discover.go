@@ -0,0 +1,141 @@
+package feed
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/mmcdole/gofeed"
+)
+
+// ErrNoFeed is returned when no feed is found on a website
+var ErrNoFeed = errors.New("no feed found")
+
+// DiscoveredFeed is a valid feed found on a website
+type DiscoveredFeed struct {
+	URL   string
+	Title string
+}
+
+// feedTypes are MIME types of feeds in <link rel="alternate">
+var feedTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/feed+json": true,
+	"application/json":      true,
+	"application/xml":       true,
+	"text/xml":              true,
+}
+
+// commonPaths are tried if a page does not link to its feeds
+var commonPaths = []string{"feed", "rss", "rss.xml", "atom.xml", "feed.xml", "index.xml"}
+
+// Discover finds feeds of the website at pageURL
+// pageURL is returned as is if it is a feed already
+// otherwise feeds linked by <link rel="alternate"> are used
+// and common paths like /feed and /rss.xml are tried if there is none
+// only feeds fetched and parsed successfully are returned
+func (p *poller) Discover(pageURL string) ([]*DiscoveredFeed, error) {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	result, err := p.fetcher.Fetch(pageURL, "", "")
+	if err != nil {
+		return nil, err
+	}
+	if feed, _, err := parseFeed(result.Body); err == nil {
+		return []*DiscoveredFeed{discovered(pageURL, feed, "")}, nil
+	}
+
+	candidates, titles := linkedFeeds(result.Body, base)
+	if len(candidates) == 0 {
+		candidates = guessFeeds(base)
+	}
+
+	var feeds []*DiscoveredFeed
+	for _, candidate := range candidates {
+		result, err := p.fetcher.Fetch(candidate, "", "")
+		if err != nil {
+			continue
+		}
+		feed, _, err := parseFeed(result.Body)
+		if err != nil {
+			continue
+		}
+		feeds = append(feeds, discovered(candidate, feed, titles[candidate]))
+	}
+	if len(feeds) == 0 {
+		return nil, ErrNoFeed
+	}
+	return feeds, nil
+}
+
+// discovered names a feed by its title, the title of link or its URL
+func discovered(feedURL string, feed *gofeed.Feed, linkTitle string) *DiscoveredFeed {
+	title := strings.TrimSpace(feed.Title)
+	if title == "" {
+		title = linkTitle
+	}
+	if title == "" {
+		title = feedURL
+	}
+	return &DiscoveredFeed{URL: feedURL, Title: title}
+}
+
+// linkedFeeds returns URLs of feeds linked in a HTML page and their titles
+func linkedFeeds(body []byte, base *url.URL) ([]string, map[string]string) {
+	titles := make(map[string]string)
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, titles
+	}
+
+	var urls []string
+	doc.Find("link[rel~=alternate][href]").Each(func(_ int, s *goquery.Selection) {
+		mime := strings.ToLower(strings.TrimSpace(s.AttrOr("type", "")))
+		if i := strings.Index(mime, ";"); i >= 0 {
+			mime = strings.TrimSpace(mime[:i])
+		}
+		if !feedTypes[mime] {
+			return
+		}
+		ref, err := url.Parse(strings.TrimSpace(s.AttrOr("href", "")))
+		if err != nil {
+			return
+		}
+		u := base.ResolveReference(ref).String()
+		if _, ok := titles[u]; ok {
+			return
+		}
+		titles[u] = strings.TrimSpace(s.AttrOr("title", ""))
+		urls = append(urls, u)
+	})
+	return urls, titles
+}
+
+// guessFeeds returns common feed URLs of the site
+// paths under the page are tried before those under the root
+func guessFeeds(base *url.URL) []string {
+	dirs := []string{"/"}
+	if dir := base.Path; dir != "" && dir != "/" {
+		if !strings.HasSuffix(dir, "/") {
+			dir += "/"
+		}
+		dirs = append([]string{dir}, dirs...)
+	}
+
+	var urls []string
+	for _, dir := range dirs {
+		for _, path := range commonPaths {
+			u := *base
+			u.Path = dir + path
+			u.RawQuery = ""
+			u.Fragment = ""
+			urls = append(urls, u.String())
+		}
+	}
+	return urls
+}
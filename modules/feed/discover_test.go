@@ -0,0 +1,84 @@
+package feed
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func Test_poller_Discover(t *testing.T) {
+	const (
+		rss  = `<?xml version="1.0"?><rss version="2.0"><channel><title>Posts</title><item><title>a</title></item></channel></rss>`
+		atom = `<?xml version="1.0"?><feed xmlns="http://www.w3.org/2005/Atom"><title>Comments</title></feed>`
+	)
+	pages := map[string]string{
+		// Links two feeds and a broken one
+		"/": `<html><head>
+			<link rel="alternate" type="application/rss+xml" title="Posts feed" href="/posts.xml">
+			<link rel="alternate" type="application/atom+xml; charset=utf-8" href="comments.atom">
+			<link rel="alternate" type="application/rss+xml" href="/missing.xml">
+			<link rel="alternate" hreflang="de" href="/de/">
+			<link rel="stylesheet" href="/style.css">
+			</head><body></body></html>`,
+		"/posts.xml":     rss,
+		"/comments.atom": atom,
+
+		// Links nothing, feed is at a common path
+		"/blog/":         `<html><body><h1>Blog</h1></body></html>`,
+		"/blog/atom.xml": atom,
+		"/nothing/":      `<html><body>Nothing here</body></html>`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+	p := &poller{fetcher: NewHTTPFetcher(nil)}
+
+	tests := []struct {
+		name    string
+		url     string
+		want    []*DiscoveredFeed
+		wantErr bool
+	}{
+		{
+			name: "Feed URL",
+			url:  server.URL + "/posts.xml",
+			want: []*DiscoveredFeed{{URL: server.URL + "/posts.xml", Title: "Posts"}},
+		},
+		{
+			name: "Linked feeds",
+			url:  server.URL + "/",
+			want: []*DiscoveredFeed{
+				{URL: server.URL + "/posts.xml", Title: "Posts"},
+				{URL: server.URL + "/comments.atom", Title: "Comments"},
+			},
+		},
+		{
+			name: "Common path",
+			url:  server.URL + "/blog/",
+			want: []*DiscoveredFeed{{URL: server.URL + "/blog/atom.xml", Title: "Comments"}},
+		},
+		{
+			name:    "No feed",
+			url:     server.URL + "/nothing/",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.Discover(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Discover() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Discover() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package feed
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Fetcher downloads the raw content of a feed
+// it is pluggable so poller can be tested without network
+type Fetcher interface {
+
+	// Fetch get the content of url
+	// etag and lastModified are the validators from last fetch, can be empty
+	Fetch(url string, etag string, lastModified string) (*FetchResult, error)
+}
+
+// FetchResult is the result of a conditional fetch
+type FetchResult struct {
+
+	// NotModified is true when server respond 304, Body is empty then
+	NotModified bool
+
+	Body         []byte
+	ETag         string
+	LastModified string
+}
+
+type httpFetcher struct {
+	client *http.Client
+}
+
+// NewHTTPFetcher creates a Fetcher using the provided http client
+// a default client with timeout is used if client is nil
+func NewHTTPFetcher(client *http.Client) Fetcher {
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &httpFetcher{client: client}
+}
+
+func (f *httpFetcher) Fetch(url string, etag string, lastModified string) (*FetchResult, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Portier")
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := &FetchResult{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		// Server may omit validators in 304, keep the old ones
+		if result.ETag == "" {
+			result.ETag = etag
+		}
+		if result.LastModified == "" {
+			result.LastModified = lastModified
+		}
+		result.NotModified = true
+		return result, nil
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("unexpected http status: %s", resp.Status)
+	}
+
+	result.Body, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,79 @@
+package feed
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_httpFetcher_Fetch(t *testing.T) {
+	const (
+		etag         = `"v1"`
+		lastModified = "Wed, 21 Oct 2015 07:28:00 GMT"
+		body         = "<rss></rss>"
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag || r.Header.Get("If-Modified-Since") == lastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified)
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	type args struct {
+		etag         string
+		lastModified string
+	}
+	tests := []struct {
+		name            string
+		args            args
+		wantNotModified bool
+		wantBody        string
+	}{
+		{
+			name:            "First fetch",
+			args:            args{},
+			wantNotModified: false,
+			wantBody:        body,
+		},
+		{
+			name:            "ETag match",
+			args:            args{etag: etag},
+			wantNotModified: true,
+			wantBody:        "",
+		},
+		{
+			name:            "Last-Modified match",
+			args:            args{lastModified: lastModified},
+			wantNotModified: true,
+			wantBody:        "",
+		},
+		{
+			name:            "Stale ETag",
+			args:            args{etag: `"v0"`},
+			wantNotModified: false,
+			wantBody:        body,
+		},
+	}
+	f := NewHTTPFetcher(server.Client())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := f.Fetch(server.URL, tt.args.etag, tt.args.lastModified)
+			if err != nil {
+				t.Fatalf("httpFetcher.Fetch() error = %v", err)
+			}
+			if got.NotModified != tt.wantNotModified {
+				t.Errorf("httpFetcher.Fetch() NotModified = %v, want %v", got.NotModified, tt.wantNotModified)
+			}
+			if string(got.Body) != tt.wantBody {
+				t.Errorf("httpFetcher.Fetch() Body = %v, want %v", string(got.Body), tt.wantBody)
+			}
+			if got.ETag == "" && got.LastModified == "" {
+				t.Errorf("httpFetcher.Fetch() lost validators")
+			}
+		})
+	}
+}
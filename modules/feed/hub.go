@@ -0,0 +1,50 @@
+package feed
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// hubLinks returns the WebSub hub and self links declared by a RSS or Atom feed
+// like <link rel="hub" href="..."/> or <atom:link rel="hub" href="..."/>
+// gofeed drops them from RSS feeds, so raw XML is scanned until the first item
+func hubLinks(body []byte) (hub string, self string) {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.Strict = false
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		// Only attributes in ASCII are needed
+		return input, nil
+	}
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return hub, self
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "item", "entry":
+			return hub, self
+		case "link":
+			var rel, href string
+			for _, attr := range start.Attr {
+				switch attr.Name.Local {
+				case "rel":
+					rel = strings.TrimSpace(attr.Value)
+				case "href":
+					href = strings.TrimSpace(attr.Value)
+				}
+			}
+			switch {
+			case rel == "hub" && hub == "":
+				hub = href
+			case rel == "self" && self == "":
+				self = href
+			}
+		}
+	}
+}
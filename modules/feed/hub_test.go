@@ -0,0 +1,47 @@
+package feed
+
+import "testing"
+
+func Test_hubLinks(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantHub  string
+		wantSelf string
+	}{
+		{
+			name: "RSS",
+			body: `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom"><channel>
+<title>Blog</title><link>https://example.com/</link>
+<atom:link rel="hub" href="https://pubsubhubbub.appspot.com/"/>
+<atom:link rel="self" type="application/rss+xml" href="https://example.com/feed"/>
+<item><atom:link rel="hub" href="https://other.example/"/></item>
+</channel></rss>`,
+			wantHub:  "https://pubsubhubbub.appspot.com/",
+			wantSelf: "https://example.com/feed",
+		},
+		{
+			name: "Atom",
+			body: `<?xml version="1.0" encoding="ISO-8859-1"?>
+<feed xmlns="http://www.w3.org/2005/Atom"><title>Blog</title>
+<link rel="self" href="https://example.com/atom.xml"/>
+<link rel="hub" href="https://hub.example.com/"/>
+<entry><title>a</title></entry></feed>`,
+			wantHub:  "https://hub.example.com/",
+			wantSelf: "https://example.com/atom.xml",
+		},
+		{
+			name: "No hub",
+			body: `<rss version="2.0"><channel><title>Blog</title><item><title>a</title></item></channel></rss>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub, self := hubLinks([]byte(tt.body))
+			if hub != tt.wantHub || self != tt.wantSelf {
+				t.Errorf("hubLinks() = %q, %q, want %q, %q", hub, self, tt.wantHub, tt.wantSelf)
+			}
+		})
+	}
+}
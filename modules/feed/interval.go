@@ -0,0 +1,124 @@
+package feed
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/mmcdole/gofeed/rss"
+)
+
+// maxSampleItems is the number of recent items used to estimate publishing rate
+const maxSampleItems = 20
+
+// parseFeed parses body into a universal feed
+// ttl is the <ttl> declared by RSS feeds, 0 if not set
+func parseFeed(body []byte) (feed *gofeed.Feed, ttl time.Duration, err error) {
+	// Universal feed drops <ttl>, parse RSS by hand to keep it
+	if gofeed.DetectFeedType(bytes.NewReader(body)) != gofeed.FeedTypeRSS {
+		// gofeed.Parser is not safe for concurrent use
+		feed, err = gofeed.NewParser().Parse(bytes.NewReader(body))
+		return feed, 0, err
+	}
+
+	rssFeed, err := (&rss.Parser{}).Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	feed, err = (&gofeed.DefaultRSSTranslator{}).Translate(rssFeed)
+	if err != nil {
+		return nil, 0, err
+	}
+	if minutes, err := strconv.Atoi(strings.TrimSpace(rssFeed.TTL)); err == nil && minutes > 0 {
+		ttl = time.Duration(minutes) * time.Minute
+	}
+	return feed, ttl, nil
+}
+
+// updatePeriod returns the period declared by sy:updatePeriod and sy:updateFrequency
+// 0 if feed does not declare it
+func updatePeriod(feed *gofeed.Feed) time.Duration {
+	sy, ok := feed.Extensions["sy"]
+	if !ok {
+		return 0
+	}
+
+	var unit time.Duration
+	if periods := sy["updatePeriod"]; len(periods) > 0 {
+		switch strings.TrimSpace(periods[0].Value) {
+		case "hourly":
+			unit = time.Hour
+		case "daily":
+			unit = 24 * time.Hour
+		case "weekly":
+			unit = 7 * 24 * time.Hour
+		case "monthly":
+			unit = 30 * 24 * time.Hour
+		case "yearly":
+			unit = 365 * 24 * time.Hour
+		default:
+			return 0
+		}
+	} else {
+		// updatePeriod defaults to daily if only frequency is present
+		if len(sy["updateFrequency"]) == 0 {
+			return 0
+		}
+		unit = 24 * time.Hour
+	}
+
+	frequency := 1
+	if frequencies := sy["updateFrequency"]; len(frequencies) > 0 {
+		if f, err := strconv.Atoi(strings.TrimSpace(frequencies[0].Value)); err == nil && f > 0 {
+			frequency = f
+		}
+	}
+	return unit / time.Duration(frequency)
+}
+
+// adaptInterval estimates a polling interval from publishing rate of feed
+// items are expected every (now - oldest sampled item) / item count
+// and the feed is polled twice in that period so new items arrive in time
+// ttl and sy:updatePeriod hints are lower bounds
+// current is returned if feed gives nothing to estimate from
+func adaptInterval(feed *gofeed.Feed, ttl time.Duration, current, min, max time.Duration, now time.Time) time.Duration {
+	var times []time.Time
+	for _, item := range feed.Items {
+		switch {
+		case item.PublishedParsed != nil:
+			times = append(times, *item.PublishedParsed)
+		case item.UpdatedParsed != nil:
+			times = append(times, *item.UpdatedParsed)
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].After(times[j]) })
+	if len(times) > maxSampleItems {
+		times = times[:maxSampleItems]
+	}
+
+	interval := current
+	if len(times) > 0 {
+		if span := now.Sub(times[len(times)-1]); span > 0 {
+			interval = span / time.Duration(len(times)) / 2
+		}
+	}
+
+	if period := updatePeriod(feed); period > interval {
+		interval = period
+	}
+	if ttl > interval {
+		interval = ttl
+	}
+
+	interval = interval.Round(time.Minute)
+	if interval < min {
+		interval = min
+	}
+	if max > 0 && interval > max {
+		interval = max
+	}
+	return interval
+}
@@ -0,0 +1,125 @@
+package feed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+)
+
+func Test_parseFeed(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantTTL time.Duration
+		wantErr bool
+	}{
+		{
+			name:    "RSS with ttl",
+			body:    `<rss version="2.0"><channel><title>T</title><ttl>60</ttl><item><title>A</title></item></channel></rss>`,
+			wantTTL: time.Hour,
+		},
+		{
+			name:    "RSS without ttl",
+			body:    `<rss version="2.0"><channel><title>T</title></channel></rss>`,
+			wantTTL: 0,
+		},
+		{
+			name:    "Atom",
+			body:    `<feed xmlns="http://www.w3.org/2005/Atom"><title>T</title></feed>`,
+			wantTTL: 0,
+		},
+		{
+			name:    "Not a feed",
+			body:    `<html></html>`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feed, ttl, err := parseFeed([]byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFeed() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if feed.Title != "T" {
+				t.Errorf("parseFeed() title = %v, want T", feed.Title)
+			}
+			if ttl != tt.wantTTL {
+				t.Errorf("parseFeed() ttl = %v, want %v", ttl, tt.wantTTL)
+			}
+		})
+	}
+}
+
+func Test_adaptInterval(t *testing.T) {
+	now := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	// itemsEvery returns count items published every gap before now
+	itemsEvery := func(gap time.Duration, count int) []*gofeed.Item {
+		var items []*gofeed.Item
+		for i := 1; i <= count; i++ {
+			published := now.Add(-gap * time.Duration(i))
+			items = append(items, &gofeed.Item{PublishedParsed: &published})
+		}
+		return items
+	}
+	type args struct {
+		feed    *gofeed.Feed
+		ttl     time.Duration
+		current time.Duration
+	}
+	tests := []struct {
+		name string
+		args args
+		want time.Duration
+	}{
+		{
+			name: "Busy feed",
+			args: args{feed: &gofeed.Feed{Items: itemsEvery(20*time.Minute, 10)}, current: time.Hour},
+			want: 10 * time.Minute,
+		},
+		{
+			name: "Clamp to min",
+			args: args{feed: &gofeed.Feed{Items: itemsEvery(time.Minute, 10)}, current: time.Hour},
+			want: 5 * time.Minute,
+		},
+		{
+			name: "Dormant feed clamp to max",
+			args: args{feed: &gofeed.Feed{Items: itemsEvery(90*24*time.Hour, 5)}, current: time.Hour},
+			want: 24 * time.Hour,
+		},
+		{
+			name: "TTL is lower bound",
+			args: args{feed: &gofeed.Feed{Items: itemsEvery(20*time.Minute, 10)}, ttl: 2 * time.Hour, current: time.Hour},
+			want: 2 * time.Hour,
+		},
+		{
+			name: "Update period hint",
+			args: args{
+				feed: &gofeed.Feed{Extensions: ext.Extensions{"sy": {
+					"updatePeriod":    {{Value: "daily"}},
+					"updateFrequency": {{Value: "4"}},
+				}}},
+				current: time.Hour,
+			},
+			want: 6 * time.Hour,
+		},
+		{
+			name: "Nothing to learn",
+			args: args{feed: &gofeed.Feed{}, current: 30 * time.Minute},
+			want: 30 * time.Minute,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := adaptInterval(tt.args.feed, tt.args.ttl, tt.args.current, 5*time.Minute, 24*time.Hour, now)
+			if got != tt.want {
+				t.Errorf("adaptInterval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
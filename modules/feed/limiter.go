@@ -0,0 +1,125 @@
+package feed
+
+import (
+	"sync"
+	"time"
+)
+
+// Telegram rate limits
+// see https://core.telegram.org/bots/faq#my-bot-is-hitting-limits-how-do-i-avoid-this
+const (
+	// no more than 30 messages per second in total
+	globalInterval = time.Second / 30
+
+	// no more than one message per second in a private chat
+	chatInterval = time.Second
+
+	// no more than 20 messages per minute in a group or channel
+	groupInterval = time.Minute / 20
+)
+
+// limiter spaces out messages to follow Telegram rate limits
+// every send reserves a slot, so concurrent senders never exceed the limits
+type limiter struct {
+	lock sync.Mutex
+
+	// sends holds times of reserved messages to any chat in order
+	// messages are spaced by globalInterval at the time they are sent
+	sends []time.Time
+
+	// chats holds the earliest time of next message to each chat
+	chats map[int64]time.Time
+}
+
+func newLimiter() *limiter {
+	return &limiter{
+		chats: make(map[int64]time.Time),
+	}
+}
+
+// reserve reserves a slot to send a message to chat
+// and returns how long to wait before sending
+// nothing is reserved if the wait is longer than max, false is returned then
+// so the caller can do something else instead of blocking
+func (l *limiter) reserve(chatID int64, now time.Time, max time.Duration) (time.Duration, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.expire(now)
+
+	slot := now
+	if next, ok := l.chats[chatID]; ok && next.After(slot) {
+		slot = next
+	}
+
+	// Take the global token at the time of sending
+	// other chats can still use free tokens before it
+	slot, i := l.free(slot)
+	if wait := slot.Sub(now); wait > max {
+		return wait, false
+	}
+	l.sends = append(l.sends, time.Time{})
+	copy(l.sends[i+1:], l.sends[i:])
+	l.sends[i] = slot
+	l.chats[chatID] = slot.Add(intervalOf(chatID))
+	l.prune(now)
+	return slot.Sub(now), true
+}
+
+// free returns the earliest time from t at least globalInterval apart from
+// every reserved message, and where to insert it into sends
+// must hold lock
+func (l *limiter) free(t time.Time) (time.Time, int) {
+	for i, sent := range l.sends {
+		if !sent.Add(globalInterval).After(t) {
+			continue
+		}
+		if !t.Add(globalInterval).After(sent) {
+			return t, i
+		}
+		t = sent.Add(globalInterval)
+	}
+	return t, len(l.sends)
+}
+
+// expire drops messages sent long enough ago to not limit new ones
+// must hold lock
+func (l *limiter) expire(now time.Time) {
+	n := 0
+	for n < len(l.sends) && !l.sends[n].Add(globalInterval).After(now) {
+		n++
+	}
+	l.sends = l.sends[n:]
+}
+
+// pause stops sending to chat until now + d
+// used when Telegram responds 429 with retry_after
+func (l *limiter) pause(chatID int64, d time.Duration, now time.Time) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	until := now.Add(d)
+	if next, ok := l.chats[chatID]; !ok || until.After(next) {
+		l.chats[chatID] = until
+	}
+}
+
+// prune drops chats free to send so the map does not grow forever
+// must hold lock
+func (l *limiter) prune(now time.Time) {
+	if len(l.chats) < 1024 {
+		return
+	}
+	for id, next := range l.chats {
+		if next.Before(now) {
+			delete(l.chats, id)
+		}
+	}
+}
+
+// intervalOf returns the min interval between messages to chat
+// group and channel IDs are negative
+func intervalOf(chatID int64) time.Duration {
+	if chatID < 0 {
+		return groupInterval
+	}
+	return chatInterval
+}
@@ -0,0 +1,97 @@
+package feed
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+func Test_limiter_reserve(t *testing.T) {
+	now := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	type reservation struct {
+		chatID   int64
+		wantWait time.Duration
+		wantOK   bool
+	}
+	tests := []struct {
+		name         string
+		reservations []reservation
+	}{
+		{
+			name: "Private chat",
+			reservations: []reservation{
+				{chatID: 1, wantWait: 0, wantOK: true},
+				{chatID: 1, wantWait: chatInterval, wantOK: true},
+				{chatID: 1, wantWait: 2 * chatInterval, wantOK: false},
+			},
+		},
+		{
+			name: "Group chat",
+			reservations: []reservation{
+				{chatID: -1, wantWait: 0, wantOK: true},
+				{chatID: -1, wantWait: groupInterval, wantOK: false},
+			},
+		},
+		{
+			name: "Global limit",
+			reservations: []reservation{
+				{chatID: 1, wantWait: 0, wantOK: true},
+				{chatID: 2, wantWait: globalInterval, wantOK: true},
+				{chatID: 3, wantWait: 2 * globalInterval, wantOK: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newLimiter()
+			for i, r := range tt.reservations {
+				wait, ok := l.reserve(r.chatID, now, 1500*time.Millisecond)
+				if wait != r.wantWait || ok != r.wantOK {
+					t.Errorf("reservation %d: limiter.reserve() = %v, %v, want %v, %v", i, wait, ok, r.wantWait, r.wantOK)
+				}
+			}
+		})
+	}
+}
+
+func Test_limiter_pause(t *testing.T) {
+	now := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	l := newLimiter()
+	l.pause(1, 5*time.Second, now)
+	if wait, ok := l.reserve(1, now, time.Minute); !ok || wait != 5*time.Second {
+		t.Errorf("limiter.reserve() after pause = %v, %v, want %v, true", wait, ok, 5*time.Second)
+	}
+	if wait, _ := l.reserve(2, now, time.Minute); wait > time.Second {
+		t.Errorf("limiter.pause() blocked other chats for %v", wait)
+	}
+}
+
+func Test_limiter_reserve_busyChats(t *testing.T) {
+	now := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	l := newLimiter()
+
+	// Every chat can send again at the same time, like after a flood wait
+	const chats = 90
+	for id := int64(1); id <= chats; id++ {
+		l.pause(id, 500*time.Millisecond, now)
+	}
+	var sends []time.Time
+	for id := int64(1); id <= chats; id++ {
+		wait, ok := l.reserve(id, now, time.Minute)
+		if !ok {
+			t.Fatalf("limiter.reserve() of chat %d = %v, false", id, wait)
+		}
+		sends = append(sends, now.Add(wait))
+	}
+
+	// No second holds more than 30 messages
+	// it is 30 global intervals as they are rounded down
+	second := 30 * globalInterval
+	sort.Slice(sends, func(i, j int) bool { return sends[i].Before(sends[j]) })
+	for i := range sends {
+		j := sort.Search(len(sends), func(j int) bool { return !sends[j].Before(sends[i].Add(second)) })
+		if j-i > 30 {
+			t.Fatalf("%d messages sent in the second from %v, want at most 30", j-i, sends[i].Sub(now))
+		}
+	}
+}
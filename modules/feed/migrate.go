@@ -0,0 +1,72 @@
+package feed
+
+import (
+	"github.com/TechMinerApps/portier/models"
+	"github.com/tidwall/buntdb"
+	"gorm.io/gorm"
+)
+
+// MigrateChat moves a group upgraded to supergroup to its new chat ID
+// if the supergroup is registered already, subscriptions and templates it does not have
+// are moved onto it and the group is deleted, so items are not sent to it twice
+// pending deliveries and digests in memory db follow the chat
+func MigrateChat(db *gorm.DB, memdb *buntdb.DB, from int64, to int64) error {
+	if err := migrateUser(db, from, to); err != nil {
+		return err
+	}
+	return memdb.Update(func(tx *buntdb.Tx) error {
+		if err := (&outbox{db: memdb}).moveChat(tx, from, to); err != nil {
+			return err
+		}
+		return (&digests{db: memdb}).moveChat(tx, from, to)
+	})
+}
+
+// migrateUser moves or merges the user of chat from into chat to in one transaction
+func migrateUser(db *gorm.DB, from int64, to int64) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var old models.User
+		err := tx.Where("telegram_id = ?", from).First(&old).Error
+		if err == gorm.ErrRecordNotFound {
+			// Moved already
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		var existing models.User
+		err = tx.Where("telegram_id = ?", to).First(&existing).Error
+		if err == gorm.ErrRecordNotFound {
+			return tx.Model(&old).Update("telegram_id", to).Error
+		} else if err != nil {
+			return err
+		}
+
+		// Settings of the supergroup win over the ones of the group
+		if err := mergeRows(tx, func() interface{} { return &models.Subscription{} }, old.ID, existing.ID); err != nil {
+			return err
+		}
+		if err := mergeRows(tx, func() interface{} { return &models.Template{} }, old.ID, existing.ID); err != nil {
+			return err
+		}
+		return tx.Delete(&old).Error
+	})
+}
+
+// mergeRows moves rows of a table keyed by user and source from one user to another
+// rows of sources the other user has already are deleted
+// model returns a new model of the table, gorm fills it in on update
+func mergeRows(tx *gorm.DB, model func() interface{}, from int64, to int64) error {
+	var kept []uint
+	if err := tx.Model(model()).Where("user_id = ?", to).Pluck("source_id", &kept).Error; err != nil {
+		return err
+	}
+	moved := tx.Model(model()).Where("user_id = ?", from)
+	if len(kept) > 0 {
+		moved = moved.Where("source_id NOT IN ?", kept)
+	}
+	if err := moved.Update("user_id", to).Error; err != nil {
+		return err
+	}
+	return tx.Where("user_id = ?", from).Delete(model()).Error
+}
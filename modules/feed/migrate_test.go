@@ -0,0 +1,130 @@
+package feed
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/TechMinerApps/portier/models"
+	"github.com/mmcdole/gofeed"
+	"github.com/tidwall/buntdb"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestMigrateChat(t *testing.T) {
+	tests := []struct {
+		name string
+		// registered is set if the supergroup ran /start before migration
+		registered   bool
+		wantSources  []uint
+		wantTemplate string
+		wantDue      time.Time
+	}{
+		{
+			name:         "New chat ID",
+			wantSources:  []uint{1, 2},
+			wantTemplate: "group",
+			wantDue:      time.Date(2021, 5, 1, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:         "Supergroup already registered",
+			registered:   true,
+			wantSources:  []uint{1, 2, 3},
+			wantTemplate: "supergroup",
+			wantDue:      time.Date(2021, 5, 2, 9, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := db.AutoMigrate(&models.User{}, &models.Subscription{}, &models.Template{}); err != nil {
+				t.Fatal(err)
+			}
+			memdb, err := buntdb.Open(":memory:")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer memdb.Close()
+			o := &outbox{db: memdb}
+			d := &digests{db: memdb}
+
+			// Group subscribes 1 and 2 with a chat template and an hourly digest
+			group := &models.User{TelegramID: -1}
+			db.Create(group)
+			db.Create(&models.Subscription{UserID: int64(group.ID), SourceID: 1})
+			db.Create(&models.Subscription{UserID: int64(group.ID), SourceID: 2})
+			db.Create(&models.Template{UserID: int64(group.ID), Text: "group"})
+			feed := &models.Feed{SourceID: 1, FeedID: "a", Item: &gofeed.Item{Title: "a"}}
+			if err := o.expand(feed, []int64{-1}); err != nil {
+				t.Fatal(err)
+			}
+			if err := d.add(-1, models.DeliveryHourly, time.Date(2021, 5, 1, 9, 0, 0, 0, time.UTC), feed); err != nil {
+				t.Fatal(err)
+			}
+
+			// Supergroup subscribes 2 and 3 with its own template and digest
+			if tt.registered {
+				supergroup := &models.User{TelegramID: -100}
+				db.Create(supergroup)
+				db.Create(&models.Subscription{UserID: int64(supergroup.ID), SourceID: 2, Paused: true})
+				db.Create(&models.Subscription{UserID: int64(supergroup.ID), SourceID: 3})
+				db.Create(&models.Template{UserID: int64(supergroup.ID), Text: "supergroup"})
+				other := &models.Feed{SourceID: 3, FeedID: "b", Item: &gofeed.Item{Title: "b"}}
+				if err := d.add(-100, models.DeliveryHourly, time.Date(2021, 5, 2, 9, 0, 0, 0, time.UTC), other); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := MigrateChat(db, memdb, -1, -100); err != nil {
+				t.Fatalf("MigrateChat() error = %v", err)
+			}
+
+			var users []models.User
+			db.Find(&users)
+			if len(users) != 1 || users[0].TelegramID != -100 {
+				t.Fatalf("users after migration = %v, want one with chat -100", users)
+			}
+			var sources []uint
+			db.Model(&models.Subscription{}).Where("user_id = ?", users[0].ID).Pluck("source_id", &sources)
+			sort.Slice(sources, func(i, j int) bool { return sources[i] < sources[j] })
+			if !reflect.DeepEqual(sources, tt.wantSources) {
+				t.Errorf("subscribed sources = %v, want %v", sources, tt.wantSources)
+			}
+			var count int64
+			db.Model(&models.Subscription{}).Count(&count)
+			if count != int64(len(tt.wantSources)) {
+				t.Errorf("%d subscriptions left, want %d", count, len(tt.wantSources))
+			}
+			var templates []models.Template
+			db.Find(&templates)
+			if len(templates) != 1 || templates[0].Text != tt.wantTemplate {
+				t.Errorf("templates = %v, want only %q", templates, tt.wantTemplate)
+			}
+
+			if o.waiting("a", -1) || !o.waiting("a", -100) {
+				t.Errorf("outbox delivery not moved to supergroup")
+			}
+			batches, _ := d.due(tt.wantDue)
+			if len(batches) != 1 || batches[0].ChatID != -100 {
+				t.Fatalf("due digests at %v = %v, want one of chat -100", tt.wantDue, batches)
+			}
+			if early, _ := d.due(tt.wantDue.Add(-time.Second)); len(early) != 0 {
+				t.Errorf("digest due before %v", tt.wantDue)
+			}
+			// Items of both digests are kept, the due time of the supergroup wins
+			items, _ := d.items(-100, models.DeliveryHourly)
+			moved := false
+			for _, item := range items {
+				moved = moved || item.FeedID == "a"
+			}
+			if !moved {
+				t.Errorf("digest item of group not moved to supergroup")
+			}
+		})
+	}
+}
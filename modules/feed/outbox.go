@@ -0,0 +1,201 @@
+package feed
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/TechMinerApps/portier/models"
+	"github.com/tidwall/buntdb"
+)
+
+// Outbox keys in memory db
+// outbox:feed:<FeedID> holds a feed item waiting to be broadcasted
+// outbox:delivery:<FeedID>:<ChatID> marks the item is not yet accepted by a chat
+const (
+	outboxFeedPrefix     = "outbox:feed:"
+	outboxDeliveryPrefix = "outbox:delivery:"
+)
+
+// outboxEntry is a feed item stored in outbox
+type outboxEntry struct {
+	Feed *models.Feed
+
+	// Expanded is set once deliveries are created for every recipient
+	Expanded bool
+}
+
+// delivery is a feed item to be sent to one chat
+type delivery struct {
+	Feed   *models.Feed
+	ChatID int64
+
+	// failed attempts since start, only kept in memory
+	Attempts uint
+}
+
+// outbox persists feed items until every recipient accepts them
+// so items survive crashes and restarts
+type outbox struct {
+	db *buntdb.DB
+}
+
+func outboxFeedKey(feedID string) string {
+	return outboxFeedPrefix + feedID
+}
+
+func outboxDeliveryKey(feedID string, chatID int64) string {
+	return outboxDeliveryPrefix + feedID + ":" + strconv.FormatInt(chatID, 10)
+}
+
+// add stores a new feed item in outbox within tx
+// poller calls it in the same transaction that marks the item as seen
+func (o *outbox) add(tx *buntdb.Tx, feed *models.Feed) error {
+	data, err := json.Marshal(&outboxEntry{Feed: feed})
+	if err != nil {
+		return err
+	}
+	_, _, err = tx.Set(outboxFeedKey(feed.FeedID), string(data), nil)
+	return err
+}
+
+// expand creates a pending delivery for every chat and marks the item expanded
+// feed is saved again so results like TelegraphURL are kept for replay
+func (o *outbox) expand(feed *models.Feed, chatIDs []int64) error {
+	data, err := json.Marshal(&outboxEntry{Feed: feed, Expanded: true})
+	if err != nil {
+		return err
+	}
+	return o.db.Update(func(tx *buntdb.Tx) error {
+		for _, id := range chatIDs {
+			if _, _, err := tx.Set(outboxDeliveryKey(feed.FeedID, id), "", nil); err != nil {
+				return err
+			}
+		}
+		if len(chatIDs) == 0 {
+			// Nobody to deliver to, item is done
+			_, err := tx.Delete(outboxFeedKey(feed.FeedID))
+			if err == buntdb.ErrNotFound {
+				return nil
+			}
+			return err
+		}
+		_, _, err := tx.Set(outboxFeedKey(feed.FeedID), string(data), nil)
+		return err
+	})
+}
+
+// done marks the delivery of item to chat accepted
+// the item is removed once all its deliveries are done
+func (o *outbox) done(feedID string, chatID int64) error {
+	return o.db.Update(func(tx *buntdb.Tx) error {
+		if _, err := tx.Delete(outboxDeliveryKey(feedID, chatID)); err != nil && err != buntdb.ErrNotFound {
+			return err
+		}
+
+		remaining := false
+		err := tx.AscendKeys(outboxDeliveryPrefix+feedID+":*", func(key, value string) bool {
+			remaining = true
+			return false
+		})
+		if err != nil || remaining {
+			return err
+		}
+		if _, err := tx.Delete(outboxFeedKey(feedID)); err != nil && err != buntdb.ErrNotFound {
+			return err
+		}
+		return nil
+	})
+}
+
+// moveChat redirects deliveries of a chat to another within tx
+// used when a group is migrated to supergroup
+func (o *outbox) moveChat(tx *buntdb.Tx, from int64, to int64) error {
+	suffix := ":" + strconv.FormatInt(from, 10)
+	moves := make(map[string]string)
+	err := tx.AscendKeys(outboxDeliveryPrefix+"*", func(key, value string) bool {
+		if strings.HasSuffix(key, suffix) {
+			feedID := strings.TrimSuffix(strings.TrimPrefix(key, outboxDeliveryPrefix), suffix)
+			moves[key] = outboxDeliveryKey(feedID, to)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return renameKeys(tx, moves)
+}
+
+// waiting reports whether the delivery of item to chat is not done yet
+func (o *outbox) waiting(feedID string, chatID int64) bool {
+	err := o.db.View(func(tx *buntdb.Tx) error {
+		_, err := tx.Get(outboxDeliveryKey(feedID, chatID))
+		return err
+	})
+	return err == nil
+}
+
+// renameKeys moves values of keys to new keys within tx
+// a new key which exists already is kept, the old one is dropped
+func renameKeys(tx *buntdb.Tx, moves map[string]string) error {
+	for from, to := range moves {
+		value, err := tx.Delete(from)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Get(to); err == nil {
+			continue
+		} else if err != buntdb.ErrNotFound {
+			return err
+		}
+		if _, _, err := tx.Set(to, value, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pending returns items not yet expanded and deliveries not yet done
+func (o *outbox) pending() ([]*models.Feed, []*delivery, error) {
+	var feeds []*models.Feed
+	var deliveries []*delivery
+	err := o.db.View(func(tx *buntdb.Tx) error {
+		expanded := make(map[string]*models.Feed)
+		var err error
+		tx.AscendKeys(outboxFeedPrefix+"*", func(key, value string) bool {
+			var entry outboxEntry
+			if err = json.Unmarshal([]byte(value), &entry); err != nil {
+				return false
+			}
+			if entry.Expanded {
+				expanded[entry.Feed.FeedID] = entry.Feed
+			} else {
+				feeds = append(feeds, entry.Feed)
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+
+		tx.AscendKeys(outboxDeliveryPrefix+"*", func(key, value string) bool {
+			// FeedID is base64 so it never contains ":"
+			parts := strings.Split(strings.TrimPrefix(key, outboxDeliveryPrefix), ":")
+			if len(parts) != 2 {
+				return true
+			}
+			feed, ok := expanded[parts[0]]
+			if !ok {
+				return true
+			}
+			chatID, convErr := strconv.ParseInt(parts[1], 10, 64)
+			if convErr != nil {
+				return true
+			}
+			deliveries = append(deliveries, &delivery{Feed: feed, ChatID: chatID})
+			return true
+		})
+		return nil
+	})
+	return feeds, deliveries, err
+}
@@ -0,0 +1,77 @@
+package feed
+
+import (
+	"testing"
+
+	"github.com/TechMinerApps/portier/models"
+	"github.com/mmcdole/gofeed"
+	"github.com/tidwall/buntdb"
+)
+
+func Test_outbox(t *testing.T) {
+	db, err := buntdb.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	o := &outbox{db: db}
+
+	newFeed := func(id string) *models.Feed {
+		return &models.Feed{SourceID: 1, FeedID: id, Item: &gofeed.Item{Title: id}}
+	}
+	add := func(feed *models.Feed) {
+		err := db.Update(func(tx *buntdb.Tx) error {
+			return o.add(tx, feed)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a is never broadcasted, b is expanded and partially delivered
+	add(newFeed("a"))
+	b := newFeed("b")
+	add(b)
+	b.TelegraphURL = "https://telegra.ph/b"
+	if err := o.expand(b, []int64{10, 20}); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.done("b", 10); err != nil {
+		t.Fatal(err)
+	}
+
+	feeds, deliveries, err := o.pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feeds) != 1 || feeds[0].FeedID != "a" {
+		t.Errorf("outbox.pending() feeds = %v, want [a]", feeds)
+	}
+	if len(deliveries) != 1 || deliveries[0].ChatID != 20 || deliveries[0].Feed.FeedID != "b" {
+		t.Fatalf("outbox.pending() deliveries = %v, want [b to 20]", deliveries)
+	}
+	if deliveries[0].Feed.TelegraphURL != b.TelegraphURL {
+		t.Errorf("outbox.pending() lost TelegraphURL")
+	}
+
+	// Item is removed after the last delivery
+	if err := o.done("b", 20); err != nil {
+		t.Fatal(err)
+	}
+	err = db.View(func(tx *buntdb.Tx) error {
+		_, err := tx.Get(outboxFeedKey("b"))
+		return err
+	})
+	if err != buntdb.ErrNotFound {
+		t.Errorf("outbox kept item after all deliveries done, err = %v", err)
+	}
+
+	// Item without recipients is done at once
+	if err := o.expand(newFeed("a"), nil); err != nil {
+		t.Fatal(err)
+	}
+	feeds, deliveries, _ = o.pending()
+	if len(feeds) != 0 || len(deliveries) != 0 {
+		t.Errorf("outbox.pending() = %v, %v, want empty", feeds, deliveries)
+	}
+}
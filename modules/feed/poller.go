@@ -1,14 +1,19 @@
 package feed
 
 import (
+	"bytes"
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/TechMinerApps/portier/models"
+	"github.com/TechMinerApps/portier/modules/extract"
 	"github.com/TechMinerApps/portier/modules/log"
+	"github.com/TechMinerApps/portier/modules/websub"
 	"github.com/TechMinerApps/portier/utils"
 	"github.com/mmcdole/gofeed"
 	"github.com/tidwall/buntdb"
+	"gorm.io/gorm"
 )
 
 // Poller get feed item from source
@@ -18,65 +23,112 @@ type Poller interface {
 	Stop() error
 	AddSource(s *models.Source) error
 	RemoveSource(s *models.Source) error
-	FetchTitle(url string) (string, error)
+	UpdateSource(s *models.Source) error
+
+	// Preview fetches and parses source without polling it
+	// used to check a source before subscribing
+	Preview(s *models.Source) (*gofeed.Feed, error)
+
+	// Discover finds feeds of a website
+	Discover(url string) ([]*DiscoveredFeed, error)
+
+	// Push handles content of source pushed by a WebSub hub
+	Push(sourceID uint, body []byte) error
 }
 
 type poller struct {
-	parser      *gofeed.Parser
-	db          *buntdb.DB
-	sources     sources
-	workers     workers
+	fetcher     Fetcher
+	db          *gorm.DB
+	memdb       *buntdb.DB
+	outbox      *outbox
+	sourcePool  []*models.Source
+	scheduler   *scheduler
 	feedChannel chan<- *models.Feed
 	logger      log.Logger
-}
 
-type sources struct {
-	Pool []*models.Source
-	Lock sync.Mutex
-}
+	defaultInterval time.Duration
+	minInterval     time.Duration
+	maxInterval     time.Duration
 
-type workers struct {
-	Pool map[uint]worker
-	Lock sync.Mutex
-}
+	maxErrorCount uint
+	onDisable     func(s *models.Source)
+
+	websub websub.Subscriber
+
+	// subscribing limits hub subscriptions running beside polls
+	// subscriptions waits for them when stopping
+	subscribing   chan struct{}
+	subscriptions sync.WaitGroup
 
-type worker struct {
-	ticker *time.Ticker
-	source models.Source
+	// handling holds a mutex of each source, see handleItems
+	handling sync.Map
 }
 
 // PollerConfig is the configuration needed to create a Poller
 type PollerConfig struct {
-	SourcePool  []*models.Source
-	DB          *buntdb.DB
+	SourcePool []*models.Source
+
+	// DB is used to persist source states
+	DB *gorm.DB
+
+	// MemDB is used to store hash of sent feed items
+	MemDB *buntdb.DB
+
 	FeedChannel chan<- *models.Feed
-	Logger      log.Logger
+
+	// Fetcher is used to download feeds, a http fetcher is used if nil
+	Fetcher Fetcher
+
+	// WorkerCount is the max number of feeds fetched at the same time
+	WorkerCount int
+
+	// PerHostLimit is the max number of concurrent fetches to one host
+	// 0 means no limit
+	PerHostLimit int
+
+	// DefaultInterval is used for sources without an update interval
+	DefaultInterval time.Duration
+
+	// MinInterval and MaxInterval bound the interval learned from feeds
+	// 0 MaxInterval means no upper bound
+	MinInterval time.Duration
+	MaxInterval time.Duration
+
+	// MaxErrorCount is the number of continuous failures before a source is disabled
+	// 0 means never disable
+	MaxErrorCount uint
+
+	// OnDisable is called after a source is disabled, can be nil
+	OnDisable func(s *models.Source)
+
+	// WebSub subscribes sources with hubs to push, can be nil
+	// sources are not polled while hub pushes them
+	WebSub websub.Subscriber
+
+	Logger log.Logger
 }
 
 func (p *poller) Start() error {
 	// db instance should already have all the info when poller started
 
-	// Protect source Pool
-	p.sources.Lock.Lock()
-	defer p.sources.Lock.Unlock()
-	// Start worker goroutine
-	for _, s := range p.sources.Pool {
-		go p.worker(s)
-		p.logger.Infof("Started poller for %s", s.Title)
+	// Spread first polls over one interval to avoid a burst at start
+	now := time.Now()
+	for _, s := range p.sourcePool {
+		source := *s
+		p.scheduler.add(&source, now.Add(jitter(p.interval(&source))))
+		p.logger.Infof("Scheduled poller for %s", s.Title)
 	}
+	p.sourcePool = nil
+	p.scheduler.start()
 	return nil
 }
 
 func (p *poller) Stop() error {
 	// poller.Stop() does not take care of data persistence
 
-	// Use lock to protect worker pool
-	p.workers.Lock.Lock()
-	defer p.workers.Lock.Unlock()
-	for key, worker := range p.workers.Pool {
-		worker.ticker.Stop()
-		delete(p.workers.Pool, key)
-	}
+	// Wait for running polls so nothing is sent after channel closed
+	p.scheduler.stop()
+	p.subscriptions.Wait()
 
 	// We send feed into this channel
 	// so is responsible for closing it
@@ -85,87 +137,257 @@ func (p *poller) Stop() error {
 }
 
 func (p *poller) AddSource(s *models.Source) error {
-	// Protect source Pool
-	p.sources.Lock.Lock()
-	defer p.sources.Lock.Unlock()
-	p.sources.Pool = append(p.sources.Pool, s)
-	go p.worker(s)
+	// Scheduler owns its copy of source
+	source := *s
+	if !p.scheduler.add(&source, time.Now().Add(p.interval(&source))) {
+		p.logger.Debugf("Source %s already scheduled", s.Title)
+	}
 	return nil
 }
 
 func (p *poller) RemoveSource(s *models.Source) error {
-	p.workers.Pool[s.ID].ticker.Stop()
+	p.scheduler.remove(s.ID)
 	return nil
 }
 
 func (p *poller) UpdateSource(s *models.Source) error {
-	if p.sources.Pool[s.ID].UpdateInterval <= s.UpdateInterval {
-		return nil
+	source := *s
+	if !p.scheduler.update(&source, time.Now().Add(p.interval(&source))) {
+		return fmt.Errorf("source %d is not scheduled", s.ID)
 	}
-
-	// Stop current worker
-	p.workers.Lock.Lock()
-	p.workers.Pool[s.ID].ticker.Stop()
-	delete(p.workers.Pool, s.ID)
-	p.workers.Lock.Unlock()
-
-	// Add new worker
-	p.sources.Lock.Lock()
-	p.sources.Pool[s.ID] = s
-	p.sources.Lock.Unlock()
-	go p.worker(s)
 	return nil
 }
 
-func (p *poller) FetchTitle(url string) (string, error) {
-	feed, err := p.parser.ParseURL(url)
+func (p *poller) Preview(s *models.Source) (*gofeed.Feed, error) {
+	src, err := feedSourceOf(s)
+	if err != nil {
+		return nil, err
+	}
+	result, err := p.fetcher.Fetch(s.URL, "", "")
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	feed, _, err := src.Parse(result.Body)
+	return feed, err
+}
+
+// interval returns the polling interval of source within configured bounds
+func (p *poller) interval(s *models.Source) time.Duration {
+	interval := time.Duration(s.UpdateInterval) * time.Second
+	if s.UpdateInterval == 0 {
+		interval = p.defaultInterval
 	}
-	return feed.Title, nil
+	if interval < p.minInterval {
+		interval = p.minInterval
+	}
+	if p.maxInterval > 0 && interval > p.maxInterval {
+		interval = p.maxInterval
+	}
+	return interval
+}
+
+// adapt learns polling interval of source from feed and saves it if changed
+func (p *poller) adapt(s *models.Source, feed *gofeed.Feed, ttl time.Duration) {
+	if s.FixedInterval {
+		return
+	}
+	current := p.interval(s)
+	interval := adaptInterval(feed, ttl, current, p.minInterval, p.maxInterval, time.Now())
+
+	// Ignore small changes to avoid writing database on every poll
+	diff := interval - current
+	if diff < 0 {
+		diff = -diff
+	}
+	if s.UpdateInterval != 0 && diff*10 < current {
+		return
+	}
+
+	s.UpdateInterval = uint(interval / time.Second)
+	if err := p.db.Model(&models.Source{ID: s.ID}).Update("update_interval", s.UpdateInterval).Error; err != nil {
+		p.logger.Errorf("Database error saving interval of %s: %s", s.Title, err.Error())
+	}
+	p.logger.Debugf("Update interval of %s set to %s", s.Title, interval)
+}
+
+// pollSource is the PollFunc of scheduler
+func (p *poller) pollSource(s *models.Source) (time.Duration, bool) {
+	// Hub pushes new items, check again after one interval
+	if p.websub != nil && p.websub.Active(s.ID) {
+		p.logger.Debugf("Source %s is pushed by hub, skip polling", s.Title)
+		return p.interval(s), true
+	}
+
+	p.logger.Infof("Polling source %s", s.Title)
+	if err := p.poll(s); err != nil {
+		p.logger.Warnf("Polling feed %s error: %s", s.Title, err.Error())
+		if p.fail(s) {
+			return 0, false
+		}
+
+		// Poll less often while source keeps failing
+		return backoff(p.interval(s), s.ErrorCount), true
+	}
+	p.succeed(s)
+	return p.interval(s), true
 }
 
-func (p *poller) worker(s *models.Source) {
-	// worker() is a blocking function
-	// that create a create a worker object in p.workers.Pool
-	// make sure to call it in a new go routine
-	// worker() acquire worker lock, so don't acquire it in upper function
-	ticker := time.NewTicker(time.Duration(s.UpdateInterval * uint(time.Second)))
-	//ticker := time.NewTicker(time.Second)
-	var w worker
-	w.ticker = ticker
+// fail records a failed poll of source
+// returns true if the source is disabled because of too many errors
+func (p *poller) fail(s *models.Source) bool {
+	s.ErrorCount++
+	if p.maxErrorCount == 0 || s.ErrorCount < p.maxErrorCount {
+		if err := p.db.Model(&models.Source{ID: s.ID}).Update("error_count", s.ErrorCount).Error; err != nil {
+			p.logger.Errorf("Database error saving error count of %s: %s", s.Title, err.Error())
+		}
+		return false
+	}
 
-	// Copy source here
-	w.source = *s
-	p.workers.Lock.Lock()
-	p.workers.Pool[s.ID] = w
-	p.workers.Lock.Unlock()
+	s.Disabled = true
+	err := p.db.Model(&models.Source{ID: s.ID}).Updates(map[string]interface{}{
+		"error_count": s.ErrorCount,
+		"disabled":    true,
+	}).Error
+	if err != nil {
+		p.logger.Errorf("Database error disabling %s: %s", s.Title, err.Error())
+	}
+	p.logger.Warnf("Source %s disabled after %d failed polls", s.Title, s.ErrorCount)
 
-	// Stop blocking when ticker stops
-	for range ticker.C {
-		p.logger.Infof("Polling source %s", w.source.Title)
-		go p.poll(&w.source)
+	if p.onDisable != nil {
+		disabled := *s
+		p.onDisable(&disabled)
 	}
+	return true
+}
 
+// succeed records a successful poll of source and resets its error count
+func (p *poller) succeed(s *models.Source) {
+	s.ErrorCount = 0
+	s.LastPolledAt = time.Now()
+	err := p.db.Model(&models.Source{ID: s.ID}).Updates(map[string]interface{}{
+		"error_count":    0,
+		"last_polled_at": s.LastPolledAt,
+	}).Error
+	if err != nil {
+		p.logger.Errorf("Database error saving poll of %s: %s", s.Title, err.Error())
+	}
 }
 
-func (p *poller) poll(s *models.Source) {
-	feed, err := p.parser.ParseURL(s.URL)
+func (p *poller) poll(s *models.Source) error {
+	src, err := feedSourceOf(s)
 	if err != nil {
-		p.logger.Warnf("Polling feed %s error: %s", s.Title, err.Error())
+		return err
+	}
+	result, err := p.fetcher.Fetch(s.URL, s.ETag, s.LastModified)
+	if err != nil {
+		return err
+	}
+
+	// Nothing changed since last fetch, skip parsing
+	if result.NotModified {
+		p.logger.Debugf("Feed %s not modified", s.Title)
+		return nil
+	}
+
+	feed, ttl, err := src.Parse(result.Body)
+	if err != nil {
+		return fmt.Errorf("parsing feed: %w", err)
+	}
+	p.adapt(s, feed, ttl)
+
+	// Only save validators after items are handled
+	// so a crash in between will not skip items
+	defer p.saveValidators(s, result)
+
+	// Ask hub to push the feed if it has one
+	if p.websub != nil {
+		if hub, self := hubLinks(result.Body); hub != "" {
+			topic := self
+			if topic == "" {
+				topic = s.URL
+			}
+			p.subscribe(s, hub, topic)
+		}
+	}
+
+	p.handleItems(s, feed)
+	return nil
+}
+
+// maxSubscribing is the max number of hub subscriptions running at the same time
+const maxSubscribing = 4
+
+// subscribe asks hub to push source without holding the poll worker
+// it is skipped if too many are running, the next poll asks again
+func (p *poller) subscribe(s *models.Source, hub string, topic string) {
+	select {
+	case p.subscribing <- struct{}{}:
+	default:
+		p.logger.Debugf("Too many hub subscriptions running, skip subscribing %s", s.Title)
 		return
 	}
+	source := *s
+	p.subscriptions.Add(1)
+	go func() {
+		defer p.subscriptions.Done()
+		defer func() { <-p.subscribing }()
+		if err := p.websub.Subscribe(&source, hub, topic); err != nil {
+			p.logger.Warnf("Error subscribing %s to hub %s: %s", source.Title, hub, err.Error())
+		}
+	}()
+}
+
+// Push parses content pushed by hub and sends new items like polling does
+func (p *poller) Push(sourceID uint, body []byte) error {
+	var s models.Source
+	if err := p.db.First(&s, sourceID).Error; err != nil {
+		return err
+	}
+	if s.Disabled {
+		return nil
+	}
+	src, err := feedSourceOf(&s)
+	if err != nil {
+		return err
+	}
+	feed, _, err := src.Parse(body)
+	if err != nil {
+		return fmt.Errorf("parsing pushed content: %w", err)
+	}
+	p.logger.Infof("Received %d items of %s from hub", len(feed.Items), s.Title)
+	p.handleItems(&s, feed)
+	if err := p.db.Model(&models.Source{ID: s.ID}).Update("last_polled_at", time.Now()).Error; err != nil {
+		p.logger.Errorf("Database error saving push of %s: %s", s.Title, err.Error())
+	}
+	return nil
+}
+
+// handleItems sends new items of feed to broadcaster
+// feed items are newest first, so it stops at the first item seen before
+// items of scraped pages are all checked since pages are not sorted
+// a push and a poll of one source are handled one after another
+// so an item is not found new by both
+func (p *poller) handleItems(s *models.Source, feed *gofeed.Feed) {
+	lock, _ := p.handling.LoadOrStore(s.ID, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	fetched := 0
 	for _, item := range feed.Items {
 		hash := utils.StringHash(s.URL + "|" + item.GUID)
 
 		// Do a read transaction to check if feed exists
-		err = p.db.View(func(tx *buntdb.Tx) error {
+		err := p.memdb.View(func(tx *buntdb.Tx) error {
 			// Check if item exists in memory
 			_, ok := tx.Get(hash)
 			return ok
 		})
 
 		if err == nil {
+			// Scraped pages are not sorted like feeds, new items can follow seen ones
+			if s.Kind == models.SourceScrape {
+				continue
+			}
 			// End if found without error
 			break
 		} else if err != buntdb.ErrNotFound {
@@ -173,34 +395,106 @@ func (p *poller) poll(s *models.Source) {
 			break
 		}
 
-		// Send item if new
+		// Summary only feeds get article body from the page
+		// fetches are capped since they bypass the per host limit of polls
+		if s.FullText && fetched < maxFullTextPerPoll && p.fullText(item) {
+			fetched++
+		}
+
+		// Store item in outbox and mark it as seen in one transaction
+		// so it is replayed by broadcaster if lost before broadcasting
 		feed := models.Feed{
 			SourceID: s.ID,
 			FeedID:   hash,
 			Item:     item,
 		}
-		p.logger.Infof("Sending feed item from %s to broadcaster", s.Title)
-		p.feedChannel <- &feed
-
-		// Then store it in db
-		err := p.db.Update(func(tx *buntdb.Tx) error {
-			_, _, err := tx.Set(hash, "exists", nil)
-			return err
+		err = p.memdb.Update(func(tx *buntdb.Tx) error {
+			if _, _, err := tx.Set(hash, "exists", nil); err != nil {
+				return err
+			}
+			return p.outbox.add(tx, &feed)
 		})
 		if err != nil {
 			p.logger.Errorf("Memory DB insertion error: %s", err.Error())
+			continue
 		}
+
+		// Send item if new
+		p.logger.Infof("Sending feed item from %s to broadcaster", s.Title)
+		p.feedChannel <- &feed
+	}
+}
+
+// saveValidators stores ETag and Last-Modified of source if changed
+func (p *poller) saveValidators(s *models.Source, result *FetchResult) {
+	if s.ETag == result.ETag && s.LastModified == result.LastModified {
+		return
+	}
+	s.ETag = result.ETag
+	s.LastModified = result.LastModified
+	err := p.db.Model(&models.Source{ID: s.ID}).Updates(map[string]interface{}{
+		"etag":          s.ETag,
+		"last_modified": s.LastModified,
+	}).Error
+	if err != nil {
+		p.logger.Errorf("Database error saving validators of %s: %s", s.Title, err.Error())
 	}
 }
 
 // NewPoller creates a Poller according to the Config
 func NewPoller(c *PollerConfig) (Poller, error) {
 	var p poller
-	p.workers.Pool = make(map[uint]worker)
 	p.db = c.DB
+	p.memdb = c.MemDB
+	p.outbox = &outbox{db: c.MemDB}
 	p.feedChannel = c.FeedChannel
 	p.logger = c.Logger
-	p.sources.Pool = c.SourcePool
-	p.parser = gofeed.NewParser()
+	p.sourcePool = c.SourcePool
+	p.scheduler = newScheduler(c.WorkerCount, c.PerHostLimit, p.pollSource)
+	p.defaultInterval = c.DefaultInterval
+	if p.defaultInterval <= 0 {
+		p.defaultInterval = 5 * time.Minute
+	}
+	p.minInterval = c.MinInterval
+	if p.minInterval <= 0 {
+		p.minInterval = time.Minute
+	}
+	p.maxInterval = c.MaxInterval
+	p.maxErrorCount = c.MaxErrorCount
+	p.onDisable = c.OnDisable
+	p.websub = c.WebSub
+	p.subscribing = make(chan struct{}, maxSubscribing)
+	p.fetcher = c.Fetcher
+	if p.fetcher == nil {
+		p.fetcher = NewHTTPFetcher(nil)
+	}
 	return &p, nil
 }
+
+// teaserLength is the text length under which content is treated as a teaser
+const teaserLength = 500
+
+// maxFullTextPerPoll is the max number of articles fetched in one poll of a source
+// items over it keep their summaries
+const maxFullTextPerPoll = 5
+
+// fullText replaces teaser content of item with article extracted from its link
+// item is kept as is if extraction fails
+// returns true if the page is fetched, even if it fails
+func (p *poller) fullText(item *gofeed.Item) bool {
+	if item.Link == "" || len(extract.Text(item.Content)) >= teaserLength {
+		return false
+	}
+	result, err := p.fetcher.Fetch(item.Link, "", "")
+	if err != nil {
+		p.logger.Warnf("Error fetching full text of %s: %s", item.Link, err.Error())
+		return true
+	}
+	content, err := extract.Extract(bytes.NewReader(result.Body))
+	if err != nil {
+		p.logger.Warnf("Error extracting full text of %s: %s", item.Link, err.Error())
+		return true
+	}
+	item.Content = content
+	return true
+}
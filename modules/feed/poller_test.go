@@ -0,0 +1,316 @@
+package feed
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TechMinerApps/portier/models"
+	"github.com/mmcdole/gofeed"
+	"github.com/tidwall/buntdb"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const testRSS = `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>Example</title>
+<item><title>Three</title><guid>3</guid><link>https://example.com/3</link></item>
+<item><title>Two</title><guid>2</guid><link>https://example.com/2</link></item>
+<item><title>One</title><guid>1</guid><link>https://example.com/1</link></item>
+</channel></rss>`
+
+// fakeFetcher returns result for every url and records validators asked with
+// delay slows down fetches like a real network
+type fakeFetcher struct {
+	lock   sync.Mutex
+	result FetchResult
+	asked  []string
+	delay  time.Duration
+}
+
+func (f *fakeFetcher) Fetch(url string, etag string, lastModified string) (*FetchResult, error) {
+	time.Sleep(f.delay)
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.asked = append(f.asked, etag+"|"+lastModified)
+	result := f.result
+	return &result, nil
+}
+
+// newTestPoller returns a poller of source with items sent into the returned channel
+func newTestPoller(t *testing.T, fetcher Fetcher, source *models.Source) (*poller, *gorm.DB, chan *models.Feed) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.Source{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(source).Error; err != nil {
+		t.Fatal(err)
+	}
+	memdb, err := buntdb.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { memdb.Close() })
+
+	items := make(chan *models.Feed, 100)
+	p, err := NewPoller(&PollerConfig{
+		DB:          db,
+		MemDB:       memdb,
+		FeedChannel: items,
+		Fetcher:     fetcher,
+		Logger:      zap.NewNop().Sugar(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.(*poller), db, items
+}
+
+func Test_poller_PushWhilePolling(t *testing.T) {
+	// Fetching full text widens the gap between checking and marking items seen
+	source := &models.Source{URL: "https://example.com/feed.xml", Title: "Example", FullText: true}
+	fetcher := &fakeFetcher{result: FetchResult{Body: []byte(testRSS)}, delay: 5 * time.Millisecond}
+	p, _, items := newTestPoller(t, fetcher, source)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			s := *source
+			if err := p.poll(&s); err != nil {
+				t.Errorf("poll() error = %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if err := p.Push(source.ID, []byte(testRSS)); err != nil {
+				t.Errorf("Push() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(items)
+
+	seen := make(map[string]int)
+	for item := range items {
+		seen[item.Item.GUID]++
+	}
+	if len(seen) != 3 {
+		t.Errorf("sent items %v, want 3 items", seen)
+	}
+	for guid, n := range seen {
+		if n != 1 {
+			t.Errorf("item %s sent %d times, want once", guid, n)
+		}
+	}
+}
+
+func Test_poller_handleItems(t *testing.T) {
+	newItem := func(guid string) *gofeed.Item {
+		return &gofeed.Item{Title: guid, GUID: guid}
+	}
+	tests := []struct {
+		name string
+		kind string
+		want []string
+	}{
+		{
+			name: "Feed stops at seen item",
+			kind: models.SourceFeed,
+			want: []string{"2", "3"},
+		},
+		{
+			name: "Scrape checks every item",
+			kind: models.SourceScrape,
+			want: []string{"2", "3", "1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &models.Source{URL: "https://example.com/news", Title: "Example", Kind: tt.kind}
+			p, _, items := newTestPoller(t, &fakeFetcher{}, source)
+
+			p.handleItems(source, &gofeed.Feed{Items: []*gofeed.Item{newItem("2")}})
+			// New item 3 on top, then the seen item 2 and a new item 1 below it
+			p.handleItems(source, &gofeed.Feed{Items: []*gofeed.Item{newItem("3"), newItem("2"), newItem("1")}})
+			close(items)
+
+			var got []string
+			for item := range items {
+				got = append(got, item.Item.GUID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sent items %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_poller_poll(t *testing.T) {
+	source := &models.Source{URL: "https://example.com/feed.xml", Title: "Example"}
+	fetcher := &fakeFetcher{}
+	p, db, items := newTestPoller(t, fetcher, source)
+
+	tests := []struct {
+		name             string
+		result           FetchResult
+		wantAsked        string
+		wantItems        int
+		wantETag         string
+		wantLastModified string
+	}{
+		{
+			name:             "First poll",
+			result:           FetchResult{Body: []byte(testRSS), ETag: `"v1"`, LastModified: "Mon, 03 May 2021 10:00:00 GMT"},
+			wantAsked:        "|",
+			wantItems:        3,
+			wantETag:         `"v1"`,
+			wantLastModified: "Mon, 03 May 2021 10:00:00 GMT",
+		},
+		{
+			// Body is not a feed, it must not be parsed
+			name:             "Not modified",
+			result:           FetchResult{NotModified: true, Body: []byte("not a feed")},
+			wantAsked:        `"v1"|Mon, 03 May 2021 10:00:00 GMT`,
+			wantItems:        0,
+			wantETag:         `"v1"`,
+			wantLastModified: "Mon, 03 May 2021 10:00:00 GMT",
+		},
+		{
+			name:             "New validators",
+			result:           FetchResult{Body: []byte(testRSS), ETag: `"v2"`, LastModified: "Tue, 04 May 2021 10:00:00 GMT"},
+			wantAsked:        `"v1"|Mon, 03 May 2021 10:00:00 GMT`,
+			wantItems:        0,
+			wantETag:         `"v2"`,
+			wantLastModified: "Tue, 04 May 2021 10:00:00 GMT",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetcher.result = tt.result
+			fetcher.asked = nil
+			if err := p.poll(source); err != nil {
+				t.Fatalf("poll() error = %v", err)
+			}
+			if len(fetcher.asked) != 1 || fetcher.asked[0] != tt.wantAsked {
+				t.Errorf("fetched with validators %v, want %q", fetcher.asked, tt.wantAsked)
+			}
+			if len(items) != tt.wantItems {
+				t.Errorf("sent %d items, want %d", len(items), tt.wantItems)
+			}
+			for len(items) > 0 {
+				<-items
+			}
+
+			var saved models.Source
+			if err := db.First(&saved, source.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if saved.ETag != tt.wantETag || saved.LastModified != tt.wantLastModified {
+				t.Errorf("saved validators %q %q, want %q %q", saved.ETag, saved.LastModified, tt.wantETag, tt.wantLastModified)
+			}
+		})
+	}
+}
+
+// fakeSubscriber blocks Subscribe until release is closed
+type fakeSubscriber struct {
+	calls   chan string
+	release chan struct{}
+}
+
+func (f *fakeSubscriber) Start() error { return nil }
+func (f *fakeSubscriber) Stop() error  { return nil }
+
+func (f *fakeSubscriber) Subscribe(s *models.Source, hub string, topic string) error {
+	f.calls <- hub + "|" + topic
+	<-f.release
+	return nil
+}
+
+func (f *fakeSubscriber) Active(sourceID uint) bool { return false }
+
+func (f *fakeSubscriber) ServeHTTP(w http.ResponseWriter, r *http.Request) {}
+
+func Test_poller_subscribe(t *testing.T) {
+	const hubRSS = `<?xml version="1.0"?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom"><channel><title>Example</title>
+<atom:link rel="hub" href="https://hub.example.com/"/>
+<item><title>One</title><guid>1</guid><link>https://example.com/1</link></item>
+</channel></rss>`
+	source := &models.Source{URL: "https://example.com/feed.xml", Title: "Example"}
+	fetcher := &fakeFetcher{result: FetchResult{Body: []byte(hubRSS)}}
+	p, _, _ := newTestPoller(t, fetcher, source)
+	subscriber := &fakeSubscriber{calls: make(chan string, maxSubscribing+1), release: make(chan struct{})}
+	p.websub = subscriber
+
+	// Polls return while hubs are slow, subscriptions over the limit are skipped
+	for i := 0; i < maxSubscribing+1; i++ {
+		done := make(chan error)
+		go func() { done <- p.poll(source) }()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("poll() error = %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("poll() waits for hub subscription")
+		}
+	}
+	for i := 0; i < maxSubscribing; i++ {
+		select {
+		case got := <-subscriber.calls:
+			if want := "https://hub.example.com/|" + source.URL; got != want {
+				t.Errorf("subscribed %q, want %q", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("subscribed %d times, want %d", i, maxSubscribing)
+		}
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		p.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		t.Fatal("Stop() returned before subscriptions finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(subscriber.release)
+	<-stopped
+	if len(subscriber.calls) != 0 {
+		t.Errorf("subscribed %d times over the limit", len(subscriber.calls))
+	}
+}
+
+func Test_poller_fullTextLimit(t *testing.T) {
+	source := &models.Source{URL: "https://example.com/feed.xml", Title: "Example", FullText: true}
+	fetcher := &fakeFetcher{result: FetchResult{Body: []byte("<html><body><article><p>Article</p></article></body></html>")}}
+	p, _, items := newTestPoller(t, fetcher, source)
+
+	feed := &gofeed.Feed{}
+	for i := 0; i < maxFullTextPerPoll+3; i++ {
+		id := strconv.Itoa(i)
+		feed.Items = append(feed.Items, &gofeed.Item{GUID: id, Link: "https://example.com/" + id, Content: "Teaser"})
+	}
+	p.handleItems(source, feed)
+
+	if len(fetcher.asked) != maxFullTextPerPoll {
+		t.Errorf("fetched %d articles, want %d", len(fetcher.asked), maxFullTextPerPoll)
+	}
+	if len(items) != len(feed.Items) {
+		t.Errorf("sent %d items, want %d", len(items), len(feed.Items))
+	}
+}
@@ -0,0 +1,191 @@
+package feed
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TechMinerApps/portier/models"
+	"github.com/tidwall/buntdb"
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+// Telegraph retry keys in memory db
+// telegraph:retry:<FeedID> holds an item sent without Telegraph page
+// telegraph:message:<FeedID>:<ChatID> holds ID of the message sent to a chat
+const (
+	retryFeedPrefix    = "telegraph:retry:"
+	retryMessagePrefix = "telegraph:message:"
+)
+
+const (
+	// telegraphRetryInterval is the period between publishing retries
+	telegraphRetryInterval = 10 * time.Minute
+
+	// telegraphRetryTTL is how long an item is retried before giving up
+	telegraphRetryTTL = 24 * time.Hour
+)
+
+// telegraphRetries remembers messages sent without Telegraph page
+// so they can be edited once the page is published
+type telegraphRetries struct {
+	db *buntdb.DB
+}
+
+func retryFeedKey(feedID string) string {
+	return retryFeedPrefix + feedID
+}
+
+func retryMessageKey(feedID string, chatID int64) string {
+	return retryMessagePrefix + feedID + ":" + strconv.FormatInt(chatID, 10)
+}
+
+// add records message sent to chat for item
+func (r *telegraphRetries) add(feed *models.Feed, chatID int64, messageID int) error {
+	data, err := json.Marshal(feed)
+	if err != nil {
+		return err
+	}
+	opts := &buntdb.SetOptions{Expires: true, TTL: telegraphRetryTTL}
+	return r.db.Update(func(tx *buntdb.Tx) error {
+		if _, _, err := tx.Set(retryFeedKey(feed.FeedID), string(data), opts); err != nil {
+			return err
+		}
+		_, _, err := tx.Set(retryMessageKey(feed.FeedID, chatID), strconv.Itoa(messageID), opts)
+		return err
+	})
+}
+
+// pending returns items to retry
+// items still being delivered are left for next time
+func (r *telegraphRetries) pending() ([]*models.Feed, error) {
+	var feeds []*models.Feed
+	err := r.db.View(func(tx *buntdb.Tx) error {
+		var err error
+		tx.AscendKeys(retryFeedPrefix+"*", func(key, value string) bool {
+			var feed models.Feed
+			if err = json.Unmarshal([]byte(value), &feed); err != nil {
+				return false
+			}
+			delivering := false
+			tx.AscendKeys(outboxDeliveryPrefix+feed.FeedID+":*", func(key, value string) bool {
+				delivering = true
+				return false
+			})
+			if !delivering {
+				feeds = append(feeds, &feed)
+			}
+			return true
+		})
+		return err
+	})
+	return feeds, err
+}
+
+// messages returns IDs of messages sent for item by chat ID
+func (r *telegraphRetries) messages(feedID string) (map[int64]int, error) {
+	messages := make(map[int64]int)
+	err := r.db.View(func(tx *buntdb.Tx) error {
+		return tx.AscendKeys(retryMessagePrefix+feedID+":*", func(key, value string) bool {
+			chatID, err := strconv.ParseInt(strings.TrimPrefix(key, retryMessagePrefix+feedID+":"), 10, 64)
+			if err != nil {
+				return true
+			}
+			messageID, err := strconv.Atoi(value)
+			if err != nil {
+				return true
+			}
+			messages[chatID] = messageID
+			return true
+		})
+	})
+	return messages, err
+}
+
+// remove forgets item and its messages
+func (r *telegraphRetries) remove(feedID string) error {
+	return r.db.Update(func(tx *buntdb.Tx) error {
+		var keys []string
+		tx.AscendKeys(retryMessagePrefix+feedID+":*", func(key, value string) bool {
+			keys = append(keys, key)
+			return true
+		})
+		keys = append(keys, retryFeedKey(feedID))
+		for _, key := range keys {
+			if _, err := tx.Delete(key); err != nil && err != buntdb.ErrNotFound {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// retryTelegraph publishes items sent without Telegraph page periodically
+func (b *broadcaster) retryTelegraph() {
+	ticker := time.NewTicker(telegraphRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-b.ctx.Done():
+			return
+		}
+		feeds, err := b.retries.pending()
+		if err != nil {
+			b.Logger.Errorf("Memory DB error: %s", err.Error())
+			continue
+		}
+		for _, feed := range feeds {
+			if b.stopped() {
+				return
+			}
+			b.retryItem(feed)
+		}
+	}
+}
+
+// retryItem publishes item and edits messages sent for it
+func (b *broadcaster) retryItem(feed *models.Feed) {
+	ctx, cancel := context.WithTimeout(b.ctx, publishTimeout)
+	defer cancel()
+	url, err := b.tgph.Publish(ctx, feed)
+	if err != nil {
+		b.Logger.Debugf("Retrying Telegraph of \"%s\" failed: %s", feed.Item.Title, err.Error())
+		return
+	}
+	feed.TelegraphURL = url
+	feed.TelegraphStatus = models.TelegraphPublished
+
+	messages, err := b.retries.messages(feed.FeedID)
+	if err != nil {
+		b.Logger.Errorf("Memory DB error: %s", err.Error())
+		return
+	}
+	for chatID, messageID := range messages {
+		// Chats can have their own templates and time zones
+		message, err := b.render(b.chatSettings(chatID), feed)
+		if err != nil {
+			b.Logger.Errorf("Error rendering message: %s", err.Error())
+			continue
+		}
+
+		// Edits count towards rate limits as well
+		for {
+			wait, ok := b.limiter.reserve(chatID, time.Now(), maxSenderWait)
+			time.Sleep(wait)
+			if ok {
+				break
+			}
+		}
+		msg := &telebot.StoredMessage{MessageID: strconv.Itoa(messageID), ChatID: chatID}
+		// Buttons are sent again or the edit removes them
+		if _, err := b.Bot.Edit(msg, message, b.sendOptions(feed, chatID, true)); err != nil {
+			b.Logger.Warnf("Error adding Telegraph to message %d in chat %d: %s", messageID, chatID, err.Error())
+		}
+	}
+	if err := b.retries.remove(feed.FeedID); err != nil {
+		b.Logger.Errorf("Memory DB error: %s", err.Error())
+	}
+}
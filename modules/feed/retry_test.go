@@ -0,0 +1,70 @@
+package feed
+
+import (
+	"testing"
+
+	"github.com/TechMinerApps/portier/models"
+	"github.com/mmcdole/gofeed"
+	"github.com/tidwall/buntdb"
+)
+
+func Test_telegraphRetries(t *testing.T) {
+	db, err := buntdb.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	r := &telegraphRetries{db: db}
+	o := &outbox{db: db}
+
+	feed := &models.Feed{SourceID: 1, FeedID: "a", TelegraphStatus: models.TelegraphFailed, Item: &gofeed.Item{Title: "a"}}
+	if err := o.expand(feed, []int64{10, 20}); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.done("a", 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.add(feed, 10, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	// Chat 20 is still waiting for the item
+	feeds, err := r.pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feeds) != 0 {
+		t.Fatalf("pending() = %d items while delivering, want 0", len(feeds))
+	}
+
+	if err := o.done("a", 20); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.add(feed, 20, 200); err != nil {
+		t.Fatal(err)
+	}
+	feeds, err = r.pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feeds) != 1 || feeds[0].FeedID != "a" || feeds[0].TelegraphStatus != models.TelegraphFailed {
+		t.Fatalf("pending() = %+v, want item a", feeds)
+	}
+
+	messages, err := r.messages("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || messages[10] != 100 || messages[20] != 200 {
+		t.Errorf("messages() = %v, want map[10:100 20:200]", messages)
+	}
+
+	if err := r.remove("a"); err != nil {
+		t.Fatal(err)
+	}
+	feeds, _ = r.pending()
+	messages, _ = r.messages("a")
+	if len(feeds) != 0 || len(messages) != 0 {
+		t.Errorf("after remove() pending = %d, messages = %d, want 0", len(feeds), len(messages))
+	}
+}
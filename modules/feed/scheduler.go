@@ -0,0 +1,317 @@
+package feed
+
+import (
+	"container/heap"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/TechMinerApps/portier/models"
+)
+
+// PollFunc polls a source and returns the delay before next poll
+// returning false removes the source from scheduler
+type PollFunc func(s *models.Source) (time.Duration, bool)
+
+// job is a source managed by scheduler
+type job struct {
+	source *models.Source
+	host   string
+	next   time.Time
+
+	// index in queue, -1 when job is running or waiting
+	index int
+
+	// waiting is set when job is due but its host is at the limit
+	waiting bool
+
+	// removed is set when source is removed while job is running
+	removed bool
+
+	// update is set when source is updated while job is running
+	update *models.Source
+}
+
+// jobQueue implements heap.Interface ordered by next poll time
+type jobQueue []*job
+
+func (q jobQueue) Len() int { return len(q) }
+
+func (q jobQueue) Less(i, j int) bool { return q[i].next.Before(q[j].next) }
+
+func (q jobQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *jobQueue) Push(x interface{}) {
+	j := x.(*job)
+	j.index = len(*q)
+	*q = append(*q, j)
+}
+
+func (q *jobQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	j := old[n-1]
+	old[n-1] = nil
+	j.index = -1
+	*q = old[:n-1]
+	return j
+}
+
+// scheduler keeps every source in a priority queue of next poll time
+// and feeds due sources into a bounded pool of workers
+type scheduler struct {
+	lock  sync.Mutex
+	queue jobQueue
+	jobs  map[uint]*job
+
+	// hosts counts running jobs per host
+	// waiting holds due jobs of hosts at the limit in FIFO order
+	hosts   map[string]int
+	waiting map[string][]*job
+	perHost int
+
+	workerCount int
+	poll        PollFunc
+
+	dispatch chan *job
+	wake     chan struct{}
+	quit     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// newScheduler creates a scheduler running poll with at most workerCount workers
+// and at most perHost concurrent polls of one host, 0 means no host limit
+func newScheduler(workerCount int, perHost int, poll PollFunc) *scheduler {
+	if workerCount < 1 {
+		workerCount = 1
+	}
+	return &scheduler{
+		queue:       jobQueue{},
+		jobs:        make(map[uint]*job),
+		hosts:       make(map[string]int),
+		waiting:     make(map[string][]*job),
+		perHost:     perHost,
+		workerCount: workerCount,
+		poll:        poll,
+		dispatch:    make(chan *job),
+		wake:        make(chan struct{}, 1),
+		quit:        make(chan struct{}),
+	}
+}
+
+func (s *scheduler) start() {
+	for i := 0; i < s.workerCount; i++ {
+		s.wg.Add(1)
+		go s.worker()
+	}
+	go s.run()
+}
+
+// stop blocks until every running poll returns
+func (s *scheduler) stop() {
+	close(s.quit)
+	s.wg.Wait()
+}
+
+// add schedules source to be polled at next
+// returns false if source is already scheduled
+func (s *scheduler) add(src *models.Source, next time.Time) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.jobs[src.ID]; ok {
+		return false
+	}
+	j := &job{
+		source: src,
+		host:   hostOf(src.URL),
+		next:   next,
+	}
+	s.jobs[src.ID] = j
+	heap.Push(&s.queue, j)
+	s.notify()
+	return true
+}
+
+// remove drops source from scheduler, a running poll is allowed to finish
+func (s *scheduler) remove(id uint) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	j, ok := s.jobs[id]
+	if !ok {
+		return false
+	}
+	delete(s.jobs, id)
+	switch {
+	case j.index >= 0:
+		heap.Remove(&s.queue, j.index)
+	case j.waiting:
+		s.unwait(j)
+	default:
+		j.removed = true
+	}
+	s.notify()
+	return true
+}
+
+// update replaces the scheduled source and moves its next poll to next
+// returns false if source is not scheduled
+func (s *scheduler) update(src *models.Source, next time.Time) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	j, ok := s.jobs[src.ID]
+	if !ok {
+		return false
+	}
+	if j.waiting {
+		s.unwait(j)
+		heap.Push(&s.queue, j)
+	} else if j.index < 0 {
+		// Apply after the running poll finishes
+		j.update = src
+		return true
+	}
+	j.source = src
+	j.host = hostOf(src.URL)
+	j.next = next
+	heap.Fix(&s.queue, j.index)
+	s.notify()
+	return true
+}
+
+// unwait removes job from waiting list, must hold lock
+func (s *scheduler) unwait(j *job) {
+	list := s.waiting[j.host]
+	for i := range list {
+		if list[i] == j {
+			list = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+	if len(list) == 0 {
+		delete(s.waiting, j.host)
+	} else {
+		s.waiting[j.host] = list
+	}
+	j.waiting = false
+}
+
+// notify wakes up run loop, must hold lock
+func (s *scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *scheduler) run() {
+	defer close(s.dispatch)
+	timer := time.NewTimer(time.Hour)
+	for {
+		due, wait := s.due(time.Now())
+		for _, j := range due {
+			select {
+			case s.dispatch <- j:
+			case <-s.quit:
+				return
+			}
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-s.wake:
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// due pops every job due at now whose host is below the limit
+// and returns how long to wait for the next one
+func (s *scheduler) due(now time.Time) ([]*job, time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var due []*job
+	for s.queue.Len() > 0 && !s.queue[0].next.After(now) {
+		j := heap.Pop(&s.queue).(*job)
+		if s.perHost > 0 && s.hosts[j.host] >= s.perHost {
+			// Released by done() when host is free
+			j.waiting = true
+			s.waiting[j.host] = append(s.waiting[j.host], j)
+			continue
+		}
+		s.hosts[j.host]++
+		due = append(due, j)
+	}
+
+	wait := time.Hour
+	if s.queue.Len() > 0 {
+		wait = s.queue[0].next.Sub(now)
+	}
+	return due, wait
+}
+
+func (s *scheduler) worker() {
+	defer s.wg.Done()
+	for j := range s.dispatch {
+		s.lock.Lock()
+		src, removed := j.source, j.removed
+		s.lock.Unlock()
+
+		delay, keep := time.Duration(0), false
+		if !removed {
+			delay, keep = s.poll(src)
+		}
+		s.done(j, delay, keep)
+	}
+}
+
+// done puts job back into queue after it is polled
+func (s *scheduler) done(j *job, delay time.Duration, keep bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.hosts[j.host]--
+	if s.hosts[j.host] <= 0 {
+		delete(s.hosts, j.host)
+	}
+
+	// Let the longest waiting job of this host run next
+	if list := s.waiting[j.host]; len(list) > 0 {
+		next := list[0]
+		s.unwait(next)
+		heap.Push(&s.queue, next)
+	}
+	if j.removed || !keep {
+		if s.jobs[j.source.ID] == j {
+			delete(s.jobs, j.source.ID)
+		}
+		s.notify()
+		return
+	}
+	if j.update != nil {
+		j.source = j.update
+		j.host = hostOf(j.update.URL)
+		j.update = nil
+	}
+	j.next = time.Now().Add(delay)
+	heap.Push(&s.queue, j)
+	s.notify()
+}
+
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
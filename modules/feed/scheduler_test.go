@@ -0,0 +1,162 @@
+package feed
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TechMinerApps/portier/models"
+)
+
+// gate is a PollFunc blocking every poll until the test releases it
+type gate struct {
+	started chan *models.Source
+	release chan time.Duration
+
+	lock       sync.Mutex
+	running    int
+	maxRunning int
+}
+
+func newGate() *gate {
+	return &gate{
+		started: make(chan *models.Source, 10),
+		release: make(chan time.Duration, 10),
+	}
+}
+
+// poll reports the source as started and returns the delay it is released with
+func (g *gate) poll(s *models.Source) (time.Duration, bool) {
+	g.lock.Lock()
+	g.running++
+	if g.running > g.maxRunning {
+		g.maxRunning = g.running
+	}
+	g.lock.Unlock()
+
+	g.started <- s
+	delay := <-g.release
+
+	g.lock.Lock()
+	g.running--
+	g.lock.Unlock()
+	return delay, true
+}
+
+// next returns the next source started
+func (g *gate) next(t *testing.T) *models.Source {
+	select {
+	case s := <-g.started:
+		return s
+	case <-time.After(5 * time.Second):
+		t.Fatal("no poll started")
+	}
+	return nil
+}
+
+func Test_scheduler_due(t *testing.T) {
+	now := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	s := newScheduler(4, 1, nil)
+	s.add(&models.Source{ID: 1, URL: "https://a.example/1"}, now)
+	s.add(&models.Source{ID: 2, URL: "https://a.example/2"}, now.Add(time.Second))
+	s.add(&models.Source{ID: 3, URL: "https://b.example/3"}, now)
+	s.add(&models.Source{ID: 4, URL: "https://c.example/4"}, now.Add(time.Hour))
+
+	// One poll per host, later sources are not due
+	due, wait := s.due(now.Add(time.Second))
+	if len(due) != 2 || due[0].source.ID == 2 || due[1].source.ID == 2 {
+		t.Fatalf("scheduler.due() = %d jobs, want sources 1 and 3", len(due))
+	}
+	if wait != time.Hour-time.Second {
+		t.Errorf("scheduler.due() wait = %v, want %v", wait, time.Hour-time.Second)
+	}
+
+	// Source 2 waits for its host
+	if due, _ := s.due(now.Add(time.Second)); len(due) != 0 {
+		t.Fatalf("scheduler.due() = %d jobs while host is busy, want 0", len(due))
+	}
+	for _, j := range due {
+		if j.host == "a.example" {
+			s.done(j, time.Hour, true)
+		}
+	}
+	due, _ = s.due(now.Add(time.Second))
+	if len(due) != 1 || due[0].source.ID != 2 {
+		t.Fatalf("scheduler.due() after host is free = %d jobs, want source 2", len(due))
+	}
+}
+
+func Test_scheduler_workers(t *testing.T) {
+	g := newGate()
+	s := newScheduler(2, 0, g.poll)
+	now := time.Now()
+	for i, u := range []string{"https://a.example/1", "https://b.example/2", "https://c.example/3"} {
+		s.add(&models.Source{ID: uint(i + 1), URL: u}, now)
+	}
+	s.start()
+
+	// Third source starts only after a worker is free
+	polled := map[uint]bool{g.next(t).ID: true, g.next(t).ID: true}
+	g.release <- time.Hour
+	polled[g.next(t).ID] = true
+	g.release <- time.Hour
+	g.release <- time.Hour
+	s.stop()
+
+	if len(polled) != 3 {
+		t.Errorf("polled sources %v, want 3", polled)
+	}
+	if g.maxRunning > 2 {
+		t.Errorf("scheduler ran %d polls at once, want at most 2", g.maxRunning)
+	}
+}
+
+func Test_scheduler_updateRunning(t *testing.T) {
+	g := newGate()
+	s := newScheduler(1, 0, g.poll)
+	s.add(&models.Source{ID: 1, URL: "https://a.example/feed", Title: "old"}, time.Now())
+	s.start()
+	defer s.stop()
+
+	g.next(t)
+	if !s.update(&models.Source{ID: 1, URL: "https://b.example/feed", Title: "new"}, time.Now()) {
+		t.Fatal("scheduler.update() of running source = false")
+	}
+
+	// Next poll uses the updated source
+	g.release <- 0
+	if src := g.next(t); src.Title != "new" {
+		t.Errorf("polled %q after update, want new", src.Title)
+	}
+	s.lock.Lock()
+	host := s.jobs[1].host
+	s.lock.Unlock()
+	if host != "b.example" {
+		t.Errorf("host after update = %q, want b.example", host)
+	}
+	g.release <- time.Hour
+}
+
+func Test_scheduler_removeRunning(t *testing.T) {
+	g := newGate()
+	s := newScheduler(1, 0, g.poll)
+	s.add(&models.Source{ID: 1, URL: "https://a.example/feed"}, time.Now())
+	s.start()
+
+	g.next(t)
+	if !s.remove(1) {
+		t.Fatal("scheduler.remove() of running source = false")
+	}
+
+	// Running poll asks to poll again at once, but source is gone
+	g.release <- 0
+	g.release <- 0
+	s.stop()
+
+	if len(s.jobs) != 0 || s.queue.Len() != 0 || len(s.hosts) != 0 {
+		t.Errorf("scheduler kept %d jobs, %d queued, %d busy hosts after remove", len(s.jobs), s.queue.Len(), len(s.hosts))
+	}
+	if len(g.started) != 0 {
+		t.Errorf("removed source polled again")
+	}
+}
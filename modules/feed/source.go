@@ -0,0 +1,52 @@
+package feed
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/TechMinerApps/portier/models"
+	"github.com/TechMinerApps/portier/modules/scrape"
+	"github.com/mmcdole/gofeed"
+)
+
+// FeedSource turns a fetched page into a feed
+// poller picks one by Kind of the source
+type FeedSource interface {
+	// Parse parses body fetched from URL of the source
+	// ttl is the caching hint declared by the feed, 0 if not set
+	Parse(body []byte) (feed *gofeed.Feed, ttl time.Duration, err error)
+}
+
+// syndicationSource parses RSS, Atom and JSON feeds
+type syndicationSource struct{}
+
+func (syndicationSource) Parse(body []byte) (*gofeed.Feed, time.Duration, error) {
+	return parseFeed(body)
+}
+
+// scrapeSource finds items in a HTML page with CSS selectors
+type scrapeSource struct {
+	url  string
+	spec *scrape.Spec
+}
+
+func (s *scrapeSource) Parse(body []byte) (*gofeed.Feed, time.Duration, error) {
+	feed, err := scrape.Parse(body, s.url, s.spec)
+	return feed, 0, err
+}
+
+// feedSourceOf returns the FeedSource of s by its Kind
+func feedSourceOf(s *models.Source) (FeedSource, error) {
+	switch s.Kind {
+	case models.SourceFeed, "":
+		return syndicationSource{}, nil
+	case models.SourceScrape:
+		spec, err := scrape.ParseSpec(s.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("scrape spec: %w", err)
+		}
+		return &scrapeSource{url: s.URL, spec: spec}, nil
+	default:
+		return nil, fmt.Errorf("unknown source kind \"%s\"", s.Kind)
+	}
+}
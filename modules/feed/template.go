@@ -0,0 +1,50 @@
+package feed
+
+import (
+	"github.com/TechMinerApps/portier/models"
+	"github.com/TechMinerApps/portier/modules/render"
+)
+
+// templateCacheSize is the number of parsed templates kept by broadcaster
+const templateCacheSize = 256
+
+// render renders item for chat with the most specific template in time zone of chat
+// items a custom template fails on are rendered with the global one
+func (b *broadcaster) render(chat *models.User, item *models.Feed) (string, error) {
+	local := *item
+	local.Location = chat.Location()
+	r := b.rendererFor(chat, item.SourceID)
+	message, err := r.Render(&local)
+	if err != nil && r != b.renderer {
+		b.Logger.Warnf("Error rendering template of chat %d for feed %d, using the global one: %s", chat.TelegramID, item.SourceID, err.Error())
+		return b.renderer.Render(&local)
+	}
+	return message, err
+}
+
+// rendererFor returns renderer of the most specific template of source for chat
+// the global template is used if there is none or it can not be loaded
+func (b *broadcaster) rendererFor(chat *models.User, sourceID uint) render.Renderer {
+	var templates []*models.Template
+	err := b.DB.Where("(user_id = ? AND source_id IN ?) OR (user_id = 0 AND source_id = ?)", chat.ID, []uint{0, sourceID}, sourceID).
+		Find(&templates).Error
+	if err != nil {
+		b.Logger.Errorf("Database error: %s", err.Error())
+		return b.renderer
+	}
+	var best *models.Template
+	for _, t := range templates {
+		if best == nil || t.Specificity() > best.Specificity() {
+			best = t
+		}
+	}
+	if best == nil {
+		return b.renderer
+	}
+	r, err := b.templates.Get(best.Text)
+	if err != nil {
+		b.Logger.Errorf("Error parsing template %d: %s", best.ID, err.Error())
+		return b.renderer
+	}
+	return r
+}
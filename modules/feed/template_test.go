@@ -0,0 +1,94 @@
+package feed
+
+import (
+	"testing"
+
+	"github.com/TechMinerApps/portier/models"
+	"github.com/TechMinerApps/portier/modules/render"
+	"github.com/mmcdole/gofeed"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func Test_broadcaster_render(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Template{}); err != nil {
+		t.Fatal(err)
+	}
+	templates := []*models.Template{
+		{UserID: 1, Text: "chat {{ .Item.Title }}"},
+		{SourceID: 2, Text: "source {{ .Item.Title }}"},
+		{UserID: 1, SourceID: 3, Text: "subscription {{ .Item.Title }}"},
+		{SourceID: 3, Text: "other source {{ .Item.Title }}"},
+		{UserID: 5, Text: "broken {{ .Item.Author.Name }}"},
+	}
+	if err := db.Create(&templates).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	global, _ := render.NewRenderer(render.Config{Template: "global {{ .Item.Title }}"})
+	b := &broadcaster{
+		renderer:        global,
+		templates:       render.NewCache(templateCacheSize),
+		BroadCastConfig: BroadCastConfig{DB: db, Logger: zap.NewNop().Sugar()},
+	}
+	tests := []struct {
+		name     string
+		userID   int64
+		sourceID uint
+		want     string
+	}{
+		{
+			name:     "Global",
+			userID:   9,
+			sourceID: 4,
+			want:     "global Item",
+		},
+		{
+			name:     "Chat",
+			userID:   1,
+			sourceID: 4,
+			want:     "chat Item",
+		},
+		{
+			name:     "Source over chat",
+			userID:   1,
+			sourceID: 2,
+			want:     "source Item",
+		},
+		{
+			name:     "Subscription over source",
+			userID:   1,
+			sourceID: 3,
+			want:     "subscription Item",
+		},
+		{
+			name:     "Source of other chat",
+			userID:   9,
+			sourceID: 3,
+			want:     "other source Item",
+		},
+		{
+			name:     "Failing template falls back",
+			userID:   5,
+			sourceID: 4,
+			want:     "global Item",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := &models.Feed{SourceID: tt.sourceID, Item: &gofeed.Item{Title: "Item"}}
+			got, err := b.render(&models.User{ID: tt.userID}, item)
+			if err != nil {
+				t.Fatalf("broadcaster.render() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("broadcaster.render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
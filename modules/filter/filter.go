@@ -0,0 +1,169 @@
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// Fields a rule can be limited to
+const (
+	FieldTitle       = "title"
+	FieldDescription = "description"
+	FieldCategories  = "categories"
+	FieldAuthor      = "author"
+)
+
+var fields = []string{FieldTitle, FieldDescription, FieldCategories, FieldAuthor}
+
+// Rule is a single include or exclude rule
+// written as +keyword, -keyword, +/regexp/ or -/regexp/
+// a field prefix limits the rule to one field, like +title:golang or -author:/bot$/
+// keywords and regexps are case insensitive and may not contain spaces, use \s in regexps
+type Rule struct {
+	Include bool
+
+	// Field is one of the Field constants, empty means all fields
+	Field string
+
+	Keyword string
+	Regexp  *regexp.Regexp
+}
+
+// Filter decides whether a feed item should be sent
+// an item is dropped if any exclude rule matches
+// if there are include rules, at least one of them must match
+type Filter struct {
+	Rules []Rule
+}
+
+// Parse parses whitespace separated rules
+// an empty text returns a filter that matches everything
+func Parse(text string) (*Filter, error) {
+	var f Filter
+	for _, token := range strings.Fields(text) {
+		rule, err := parseRule(token)
+		if err != nil {
+			return nil, err
+		}
+		f.Rules = append(f.Rules, rule)
+	}
+	return &f, nil
+}
+
+func parseRule(token string) (Rule, error) {
+	var rule Rule
+	switch token[0] {
+	case '+':
+		rule.Include = true
+	case '-':
+		rule.Include = false
+	default:
+		return rule, fmt.Errorf("rule \"%s\" must start with + or -", token)
+	}
+	body := token[1:]
+
+	for _, field := range fields {
+		if strings.HasPrefix(body, field+":") {
+			rule.Field = field
+			body = strings.TrimPrefix(body, field+":")
+			break
+		}
+	}
+
+	if len(body) >= 2 && strings.HasPrefix(body, "/") && strings.HasSuffix(body, "/") {
+		re, err := regexp.Compile("(?i)" + body[1:len(body)-1])
+		if err != nil {
+			return rule, fmt.Errorf("rule \"%s\" has illegal regexp: %v", token, err)
+		}
+		rule.Regexp = re
+		return rule, nil
+	}
+	if body == "" {
+		return rule, errors.New("empty rule")
+	}
+	rule.Keyword = strings.ToLower(body)
+	return rule, nil
+}
+
+// String returns the rules in the syntax accepted by Parse
+func (f *Filter) String() string {
+	var rules []string
+	for _, r := range f.Rules {
+		rules = append(rules, r.String())
+	}
+	return strings.Join(rules, " ")
+}
+
+// String returns the rule in the syntax accepted by Parse
+func (r *Rule) String() string {
+	s := "-"
+	if r.Include {
+		s = "+"
+	}
+	if r.Field != "" {
+		s += r.Field + ":"
+	}
+	if r.Regexp != nil {
+		return s + "/" + strings.TrimPrefix(r.Regexp.String(), "(?i)") + "/"
+	}
+	return s + r.Keyword
+}
+
+// Empty reports whether the filter has no rules
+func (f *Filter) Empty() bool {
+	return len(f.Rules) == 0
+}
+
+// Match reports whether item passes the filter
+func (f *Filter) Match(item *gofeed.Item) bool {
+	hasInclude, included := false, false
+	for i := range f.Rules {
+		rule := &f.Rules[i]
+		matched := rule.match(item)
+		if !rule.Include && matched {
+			return false
+		}
+		if rule.Include {
+			hasInclude = true
+			included = included || matched
+		}
+	}
+	return !hasInclude || included
+}
+
+func (r *Rule) match(item *gofeed.Item) bool {
+	for _, text := range fieldValues(item, r.Field) {
+		if r.Regexp != nil {
+			if r.Regexp.MatchString(text) {
+				return true
+			}
+		} else if strings.Contains(strings.ToLower(text), r.Keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldValues returns texts of field in item, all fields if field is empty
+func fieldValues(item *gofeed.Item, field string) []string {
+	var values []string
+	if field == "" || field == FieldTitle {
+		values = append(values, item.Title)
+	}
+	if field == "" || field == FieldDescription {
+		values = append(values, item.Description)
+	}
+	if field == "" || field == FieldCategories {
+		values = append(values, item.Categories...)
+	}
+	if field == "" || field == FieldAuthor {
+		if item.Author != nil {
+			values = append(values, item.Author.Name, item.Author.Email)
+		}
+	}
+	return values
+}
@@ -0,0 +1,91 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "Keywords",
+			text: "+golang  -Sponsored",
+			want: "+golang -sponsored",
+		},
+		{
+			name: "Field and regexp",
+			text: "+title:/^go\\d+/ -author:bot",
+			want: "+title:/^go\\d+/ -author:bot",
+		},
+		{
+			name: "Empty",
+			text: "",
+			want: "",
+		},
+		{
+			name:    "Missing sign",
+			text:    "golang",
+			wantErr: true,
+		},
+		{
+			name:    "Illegal regexp",
+			text:    "+/(/",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := Parse(tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := f.String(); got != tt.want {
+				t.Errorf("Filter.String() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilter_Match(t *testing.T) {
+	item := &gofeed.Item{
+		Title:       "Go 1.16 is released",
+		Description: "Sponsored by someone",
+		Categories:  []string{"Programming"},
+		Author:      &gofeed.Person{Name: "Gopher"},
+	}
+	tests := []struct {
+		name  string
+		rules string
+		want  bool
+	}{
+		{name: "No rules", rules: "", want: true},
+		{name: "Include match", rules: "+go", want: true},
+		{name: "Include miss", rules: "+rust", want: false},
+		{name: "One include matches", rules: "+rust +programming", want: true},
+		{name: "Exclude wins", rules: "+go -sponsored", want: false},
+		{name: "Exclude other field", rules: "-title:sponsored", want: true},
+		{name: "Author field", rules: "+author:gopher", want: true},
+		{name: "Regexp", rules: "+title:/go\\s\\d+\\.\\d+/", want: true},
+		{name: "Regexp miss", rules: "+/^released/", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := Parse(tt.rules)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := f.Match(item); got != tt.want {
+				t.Errorf("Filter.Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
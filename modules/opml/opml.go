@@ -0,0 +1,100 @@
+package opml
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+// OPML is an OPML 2.0 document used to exchange subscription lists
+type OPML struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    Head     `xml:"head"`
+	Body    Body     `xml:"body"`
+}
+
+// Head is the head of an OPML document
+type Head struct {
+	Title       string `xml:"title"`
+	DateCreated string `xml:"dateCreated,omitempty"`
+}
+
+// Body holds the outlines of an OPML document
+type Body struct {
+	Outlines []Outline `xml:"outline"`
+}
+
+// Outline is a feed, or a folder of feeds if XMLURL is empty
+type Outline struct {
+	Text     string    `xml:"text,attr"`
+	Title    string    `xml:"title,attr,omitempty"`
+	Type     string    `xml:"type,attr,omitempty"`
+	XMLURL   string    `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string    `xml:"htmlUrl,attr,omitempty"`
+	Outlines []Outline `xml:"outline"`
+}
+
+// Feed is a single feed to put into OPML
+type Feed struct {
+	Title string
+	URL   string
+}
+
+// New creates an OPML document of feeds
+func New(title string, feeds []Feed) *OPML {
+	o := &OPML{
+		Version: "2.0",
+		Head: Head{
+			Title:       title,
+			DateCreated: time.Now().UTC().Format(time.RFC1123Z),
+		},
+	}
+	for _, f := range feeds {
+		o.Body.Outlines = append(o.Body.Outlines, Outline{
+			Text:   f.Title,
+			Title:  f.Title,
+			Type:   "rss",
+			XMLURL: f.URL,
+		})
+	}
+	return o
+}
+
+// Parse reads an OPML document
+func Parse(r io.Reader) (*OPML, error) {
+	var o OPML
+	if err := xml.NewDecoder(r).Decode(&o); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// Marshal returns the OPML document with xml header
+func (o *OPML) Marshal() ([]byte, error) {
+	data, err := xml.MarshalIndent(o, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// Feeds returns every feed in document, folders are flattened
+func (o *OPML) Feeds() []Feed {
+	var feeds []Feed
+	var walk func(outlines []Outline)
+	walk = func(outlines []Outline) {
+		for _, outline := range outlines {
+			if outline.XMLURL != "" {
+				title := outline.Title
+				if title == "" {
+					title = outline.Text
+				}
+				feeds = append(feeds, Feed{Title: title, URL: outline.XMLURL})
+			}
+			walk(outline.Outlines)
+		}
+	}
+	walk(o.Body.Outlines)
+	return feeds
+}
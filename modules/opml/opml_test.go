@@ -0,0 +1,74 @@
+package opml
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []Feed
+		wantErr bool
+	}{
+		{
+			name: "Nested",
+			input: `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="1.0">
+  <head><title>Subscriptions</title></head>
+  <body>
+    <outline text="Go Blog" type="rss" xmlUrl="https://blog.golang.org/feed.atom"/>
+    <outline text="Tech">
+      <outline text="HN" title="Hacker News" type="rss" xmlUrl="https://news.ycombinator.com/rss" htmlUrl="https://news.ycombinator.com"/>
+    </outline>
+  </body>
+</opml>`,
+			want: []Feed{
+				{Title: "Go Blog", URL: "https://blog.golang.org/feed.atom"},
+				{Title: "Hacker News", URL: "https://news.ycombinator.com/rss"},
+			},
+			wantErr: false,
+		},
+		{
+			name:    "Not OPML",
+			input:   "not xml at all",
+			want:    nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, err := Parse(strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := o.Feeds(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("OPML.Feeds() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOPML_Marshal(t *testing.T) {
+	feeds := []Feed{
+		{Title: "Go Blog", URL: "https://blog.golang.org/feed.atom"},
+		{Title: "A & B", URL: "https://example.com/rss?a=1&b=2"},
+	}
+	data, err := New("Portier", feeds).Marshal()
+	if err != nil {
+		t.Fatalf("OPML.Marshal() error = %v", err)
+	}
+	o, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got := o.Feeds(); !reflect.DeepEqual(got, feeds) {
+		t.Errorf("round trip = %v, want %v", got, feeds)
+	}
+}
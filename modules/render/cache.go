@@ -0,0 +1,71 @@
+package render
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Cache keeps renderers of templates so each is parsed once
+// the least recently used renderer is dropped when full
+type Cache struct {
+	lock      sync.Mutex
+	size      int
+	order     *list.List
+	renderers map[string]*list.Element
+}
+
+type cacheEntry struct {
+	template string
+	renderer Renderer
+}
+
+// NewCache returns a cache holding up to size renderers
+func NewCache(size int) *Cache {
+	if size < 1 {
+		size = 1
+	}
+	return &Cache{
+		size:      size,
+		order:     list.New(),
+		renderers: make(map[string]*list.Element),
+	}
+}
+
+// Get returns renderer of template, parsing it if not cached
+// digests of the renderer use DefaultDigestTemplate
+func (c *Cache) Get(template string) (Renderer, error) {
+	c.lock.Lock()
+	if e, ok := c.renderers[template]; ok {
+		c.order.MoveToFront(e)
+		c.lock.Unlock()
+		return e.Value.(*cacheEntry).renderer, nil
+	}
+	c.lock.Unlock()
+
+	// Parse without lock, a template parsed twice at once is harmless
+	r, err := NewRenderer(Config{Template: template})
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if e, ok := c.renderers[template]; ok {
+		c.order.MoveToFront(e)
+		return e.Value.(*cacheEntry).renderer, nil
+	}
+	c.renderers[template] = c.order.PushFront(&cacheEntry{template: template, renderer: r})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.renderers, oldest.Value.(*cacheEntry).template)
+	}
+	return r, nil
+}
+
+// Len returns the number of cached renderers
+func (c *Cache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.order.Len()
+}
@@ -0,0 +1,39 @@
+package render
+
+import (
+	"testing"
+
+	"github.com/TechMinerApps/portier/models"
+	"github.com/mmcdole/gofeed"
+)
+
+func TestCache(t *testing.T) {
+	c := NewCache(2)
+	feed := &models.Feed{Item: &gofeed.Item{Title: "Title"}}
+
+	first, err := c.Get("a {{ .Item.Title }}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := first.Render(feed); got != "a Title" {
+		t.Errorf("Cache.Get() renders %q, want %q", got, "a Title")
+	}
+	if again, _ := c.Get("a {{ .Item.Title }}"); again != first {
+		t.Errorf("Cache.Get() parsed a cached template again")
+	}
+
+	// b is dropped as the least recently used
+	c.Get("b")
+	c.Get("a {{ .Item.Title }}")
+	c.Get("c")
+	if c.Len() != 2 {
+		t.Errorf("Cache.Len() = %d, want 2", c.Len())
+	}
+	if again, _ := c.Get("a {{ .Item.Title }}"); again != first {
+		t.Errorf("Cache dropped the recently used template")
+	}
+
+	if _, err := c.Get("{{ .Item.Title"); err == nil {
+		t.Errorf("Cache.Get() error = nil for illegal template")
+	}
+}
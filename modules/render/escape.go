@@ -0,0 +1,39 @@
+package render
+
+import (
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// markdownEscaper escapes characters reserved in MarkdownV2 text
+// see https://core.telegram.org/bots/api#markdownv2-style
+var markdownEscaper = strings.NewReplacer(
+	"\\", "\\\\", "_", "\\_", "*", "\\*", "[", "\\[", "]", "\\]",
+	"(", "\\(", ")", "\\)", "~", "\\~", "`", "\\`", ">", "\\>",
+	"#", "\\#", "+", "\\+", "-", "\\-", "=", "\\=", "|", "\\|",
+	"{", "\\{", "}", "\\}", ".", "\\.", "!", "\\!",
+)
+
+// urlEscaper escapes characters reserved in (...) of MarkdownV2 links
+var urlEscaper = strings.NewReplacer("\\", "\\\\", ")", "\\)")
+
+// digestFuncs are functions of digest templates
+var digestFuncs = template.FuncMap{
+	"escape":    EscapeMarkdown,
+	"escapeURL": urlEscaper.Replace,
+}
+
+// EscapeMarkdown escapes s to be shown as is in MarkdownV2
+func EscapeMarkdown(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
+// escaped matches a character escaped by backslash
+var escaped = regexp.MustCompile(`\\(.)`)
+
+// UnescapeMarkdown removes backslashes of escaped characters
+// used to send a message as plain text when its MarkdownV2 is rejected
+func UnescapeMarkdown(s string) string {
+	return escaped.ReplaceAllString(s, "$1")
+}
@@ -0,0 +1,38 @@
+package render
+
+import "testing"
+
+func TestEscapeMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "Plain",
+			text: "Unit Test is Great",
+			want: "Unit Test is Great",
+		},
+		{
+			name: "Reserved",
+			text: "Go 1.16 - released (finally)!",
+			want: "Go 1\\.16 \\- released \\(finally\\)\\!",
+		},
+		{
+			name: "Every reserved character",
+			text: "_*[]()~`>#+-=|{}.!\\",
+			want: "\\_\\*\\[\\]\\(\\)\\~\\`\\>\\#\\+\\-\\=\\|\\{\\}\\.\\!\\\\",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := EscapeMarkdown(tt.text)
+			if got != tt.want {
+				t.Errorf("EscapeMarkdown() = %q, want %q", got, tt.want)
+			}
+			if back := UnescapeMarkdown(got); back != tt.text {
+				t.Errorf("UnescapeMarkdown() = %q, want %q", back, tt.text)
+			}
+		})
+	}
+}
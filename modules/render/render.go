@@ -8,18 +8,50 @@ import (
 	"github.com/TechMinerApps/portier/models"
 )
 
+// DefaultDigestTemplate is used if DigestTemplate is not set
+// digest templates are MarkdownV2, values are escaped with escape and escapeURL
+const DefaultDigestTemplate = `*Portier {{ .Mode }} digest*{{ if gt .Part 1 }} \(continued\){{ end }}
+{{ range .Items }}
+• {{ $link := .Item.Link }}{{ if .HasTelegraph }}{{ $link = .TelegraphURL }}{{ end -}}
+{{ if $link }}[{{ escape .Item.Title }}]({{ escapeURL $link }}){{ else }}{{ escape .Item.Title }}{{ end }}
+{{- end }}`
+
 // Config is a renderer config
 type Config struct {
 	Template string
+
+	// DigestTemplate renders a Digest, DefaultDigestTemplate if empty
+	DigestTemplate string
+}
+
+// Digest is the data of digest template
+type Digest struct {
+	// Mode is the delivery mode like hourly
+	Mode  string
+	Items []*models.Feed
+
+	// Part is the number of message from 1, long digests are sent in several
+	Part int
+}
+
+// DigestPart is a message of a digest and the items in it
+type DigestPart struct {
+	Text  string
+	Items []*models.Feed
 }
 
 // Renderer is a interface that provide render to text
 type Renderer interface {
 	Render(feed *models.Feed) (string, error)
+
+	// RenderDigest renders digest in messages no longer than limit
+	// items are not split across messages unless one is longer than limit alone
+	RenderDigest(digest *Digest, limit int) ([]*DigestPart, error)
 }
 
 type renderer struct {
 	template *template.Template
+	digest   *template.Template
 }
 
 // NewRenderer return a renderer according to config
@@ -30,12 +62,72 @@ func NewRenderer(c Config) (Renderer, error) {
 	if err != nil {
 		return nil, err
 	}
+	if c.DigestTemplate == "" {
+		c.DigestTemplate = DefaultDigestTemplate
+	}
+	r.digest, err = template.New("digest").Funcs(digestFuncs).Parse(c.DigestTemplate)
+	if err != nil {
+		return nil, err
+	}
 	return &r, nil
 }
 
 func (r *renderer) Render(feed *models.Feed) (string, error) {
+	return execute(r.template, feed)
+}
+
+func (r *renderer) RenderDigest(digest *Digest, limit int) ([]*DigestPart, error) {
+	var parts []*DigestPart
+	var chunk []*models.Feed
+	var text string
+
+	// Items are added to a message until it gets too long
+	for _, item := range digest.Items {
+		next, err := r.renderDigestPart(digest, append(chunk, item), len(parts)+1)
+		if err != nil {
+			return nil, err
+		}
+		if utf16Len([]rune(next)) <= limit || len(chunk) == 0 {
+			chunk, text = append(chunk, item), next
+			continue
+		}
+		parts = appendDigestPart(parts, text, chunk, limit)
+		chunk = []*models.Feed{item}
+		if text, err = r.renderDigestPart(digest, chunk, len(parts)+1); err != nil {
+			return nil, err
+		}
+	}
+	if len(chunk) > 0 {
+		parts = appendDigestPart(parts, text, chunk, limit)
+	}
+	return parts, nil
+}
+
+func (r *renderer) renderDigestPart(digest *Digest, items []*models.Feed, part int) (string, error) {
+	var buffer bytes.Buffer
+	err := r.digest.Execute(&buffer, &Digest{Mode: digest.Mode, Items: items, Part: part})
+	return buffer.String(), err
+}
+
+// appendDigestPart adds text of items to parts
+// a single item too long for a message is cut at line breaks
+// its items go with the last piece, so they count as sent when all are
+func appendDigestPart(parts []*DigestPart, text string, items []*models.Feed, limit int) []*DigestPart {
+	pieces := Split(text, limit)
+	for i, piece := range pieces {
+		part := &DigestPart{Text: piece}
+		if i == len(pieces)-1 {
+			part.Items = items
+		}
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// execute renders data and escapes the result for MarkdownV2
+func execute(t *template.Template, data interface{}) (string, error) {
 	var buffer bytes.Buffer
-	if err := r.template.Execute(&buffer, feed); err != nil {
+	if err := t.Execute(&buffer, data); err != nil {
 		return "", err
 	}
 	var message string
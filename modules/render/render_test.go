@@ -1,6 +1,7 @@
 package render
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/TechMinerApps/portier/models"
@@ -50,6 +51,23 @@ func Test_renderer_Render(t *testing.T) {
 			want:    "Unit Test is Great!",
 			wantErr: false,
 		},
+		{
+			name: "Without Telegraph",
+			fields: fields{
+				Config: Config{
+					Template: "{{ if .HasTelegraph }}{{ .TelegraphURL }}{{ else }}{{ .Item.Link }}{{ end }}",
+				},
+			},
+			args: args{
+				feed: &models.Feed{
+					TelegraphURL:    "https://telegra.ph/page",
+					TelegraphStatus: models.TelegraphFailed,
+					Item:            &gofeed.Item{Link: "https://example/post"},
+				},
+			},
+			want:    "https://example/post",
+			wantErr: false,
+		},
 		{
 			name: "Error",
 			fields: fields{
@@ -78,3 +96,99 @@ func Test_renderer_Render(t *testing.T) {
 		})
 	}
 }
+
+func Test_renderer_RenderDigest(t *testing.T) {
+	items := []*models.Feed{
+		{Item: &gofeed.Item{Title: "Go 1.16 - released (finally)!", Link: "https://example.com/a_(b)"}},
+		{
+			Item:            &gofeed.Item{Title: "Second", Link: "https://example.com/2"},
+			TelegraphURL:    "https://telegra.ph/2",
+			TelegraphStatus: models.TelegraphPublished,
+		},
+		{Item: &gofeed.Item{Title: "No link"}},
+	}
+	tests := []struct {
+		name      string
+		template  string
+		limit     int
+		want      []string
+		wantItems []int
+		wantErr   bool
+	}{
+		{
+			name:     "Default",
+			template: "",
+			limit:    MaxMessageLength,
+			want: []string{
+				"*Portier daily digest*\n\n" +
+					"• [Go 1\\.16 \\- released \\(finally\\)\\!](https://example.com/a_(b\\))\n" +
+					"• [Second](https://telegra.ph/2)\n" +
+					"• No link",
+			},
+			wantItems: []int{3},
+			wantErr:   false,
+		},
+		{
+			name:     "Split between items",
+			template: "",
+			limit:    100,
+			want: []string{
+				"*Portier daily digest*\n\n" +
+					"• [Go 1\\.16 \\- released \\(finally\\)\\!](https://example.com/a_(b\\))",
+				"*Portier daily digest* \\(continued\\)\n\n" +
+					"• [Second](https://telegra.ph/2)\n" +
+					"• No link",
+			},
+			wantItems: []int{1, 2},
+			wantErr:   false,
+		},
+		{
+			name:      "Item longer than limit",
+			template:  "{{ range .Items }}{{ escape .Item.Title }}\n{{ end }}",
+			limit:     12,
+			want:      []string{"Go 1\\.16 \\- ", "released \\(f", "inally\\)\\!", "Second", "No link"},
+			wantItems: []int{0, 0, 1, 1, 1},
+			wantErr:   false,
+		},
+		{
+			name:      "Custom",
+			template:  "{{ len .Items }} new",
+			limit:     MaxMessageLength,
+			want:      []string{"3 new"},
+			wantItems: []int{3},
+			wantErr:   false,
+		},
+		{
+			name:     "Error",
+			template: "{{ .NotExists }}",
+			limit:    MaxMessageLength,
+			want:     nil,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRenderer(Config{DigestTemplate: tt.template})
+			if err != nil {
+				t.Fatal(err)
+			}
+			parts, err := r.RenderDigest(&Digest{Mode: "daily", Items: items}, tt.limit)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("renderer.RenderDigest() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			var got []string
+			var gotItems []int
+			for _, part := range parts {
+				got = append(got, part.Text)
+				gotItems = append(gotItems, len(part.Items))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("renderer.RenderDigest() = %q, want %q", got, tt.want)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(gotItems, tt.wantItems) {
+				t.Errorf("renderer.RenderDigest() items per part = %v, want %v", gotItems, tt.wantItems)
+			}
+		})
+	}
+}
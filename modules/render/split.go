@@ -0,0 +1,75 @@
+package render
+
+import "strings"
+
+// MaxMessageLength is the longest text of a Telegram message
+const MaxMessageLength = 4096
+
+// Split breaks message into parts no longer than limit
+// it cuts at line breaks so entities on a line are kept whole
+// lines longer than limit are cut without breaking an escape
+// length is counted in UTF-16 code units as Telegram does
+func Split(message string, limit int) []string {
+	var parts []string
+	var part []rune
+	length := 0
+	flush := func() {
+		if s := strings.TrimRight(string(part), "\n"); s != "" {
+			parts = append(parts, s)
+		}
+		part = nil
+		length = 0
+	}
+
+	for _, line := range strings.SplitAfter(message, "\n") {
+		runes := []rune(line)
+		if length+utf16Len(runes) > limit {
+			flush()
+		}
+		for utf16Len(runes) > limit {
+			cut := cutAt(runes, limit)
+			part = runes[:cut]
+			flush()
+			runes = runes[cut:]
+		}
+		part = append(part, runes...)
+		length += utf16Len(runes)
+	}
+	flush()
+	return parts
+}
+
+// cutAt returns how many runes fit in limit
+// a backslash escaping the next rune is not left at the end
+func cutAt(runes []rune, limit int) int {
+	cut, length := 0, 0
+	for cut < len(runes) && length+utf16Len(runes[cut:cut+1]) <= limit {
+		length += utf16Len(runes[cut : cut+1])
+		cut++
+	}
+	backslashes := 0
+	for i := cut - 1; i >= 0 && runes[i] == '\\'; i-- {
+		backslashes++
+	}
+	if backslashes%2 == 1 && cut > 1 {
+		cut--
+	}
+	if cut == 0 {
+		// limit is shorter than a single rune
+		cut = 1
+	}
+	return cut
+}
+
+// utf16Len returns length of runes in UTF-16 code units
+func utf16Len(runes []rune) int {
+	n := 0
+	for _, r := range runes {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,75 @@
+package render
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		limit   int
+		want    []string
+	}{
+		{
+			name:    "Short",
+			message: "line 1\nline 2",
+			limit:   20,
+			want:    []string{"line 1\nline 2"},
+		},
+		{
+			name:    "At line breaks",
+			message: "line 1\nline 2\nline 3",
+			limit:   14,
+			want:    []string{"line 1\nline 2", "line 3"},
+		},
+		{
+			name:    "Long line",
+			message: "abcdefghij\nxy",
+			limit:   4,
+			want:    []string{"abcd", "efgh", "ij", "xy"},
+		},
+		{
+			name:    "Escape kept whole",
+			message: "abc\\.def",
+			limit:   4,
+			want:    []string{"abc", "\\.de", "f"},
+		},
+		{
+			name:    "Escaped backslash",
+			message: "ab\\\\cd",
+			limit:   4,
+			want:    []string{"ab\\\\", "cd"},
+		},
+		{
+			name:    "Emoji counted in UTF-16",
+			message: "😀😀😀",
+			limit:   4,
+			want:    []string{"😀😀", "😀"},
+		},
+		{
+			name:    "Blank lines dropped at cuts",
+			message: "line 1\n\n\nline 2",
+			limit:   7,
+			want:    []string{"line 1", "line 2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Split(tt.message, tt.limit)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Split() = %q, want %q", got, tt.want)
+			}
+			for _, part := range got {
+				if utf16Len([]rune(part)) > tt.limit {
+					t.Errorf("Split() part %q longer than %d", part, tt.limit)
+				}
+			}
+			if joined := strings.Join(got, ""); strings.Count(joined, "\\") != strings.Count(tt.message, "\\") {
+				t.Errorf("Split() lost escapes")
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/TechMinerApps/portier/models"
+	"github.com/mmcdole/gofeed"
+)
+
+// samples are items templates are checked against before saved
+// the sparse one catches templates failing on missing fields
+func samples() []*models.Feed {
+	published := time.Date(2021, 6, 2, 14, 30, 0, 0, time.UTC)
+	return []*models.Feed{
+		{
+			SourceID:        1,
+			FeedID:          "sample",
+			TelegraphURL:    "https://telegra.ph/Sample-06-02",
+			TelegraphStatus: models.TelegraphPublished,
+			Item: &gofeed.Item{
+				Title:           "Sample item",
+				Description:     "Summary of the sample item",
+				Content:         "<p>Content of the sample item</p>",
+				Link:            "https://example.com/sample",
+				Published:       published.Format(time.RFC1123Z),
+				PublishedParsed: &published,
+				Author:          &gofeed.Person{Name: "Portier", Email: "portier@example.com"},
+				GUID:            "https://example.com/sample",
+				Image:           &gofeed.Image{URL: "https://example.com/sample.png"},
+				Categories:      []string{"sample"},
+			},
+		},
+		{
+			FeedID:          "sparse",
+			TelegraphStatus: models.TelegraphFailed,
+			Item:            &gofeed.Item{Title: "Sparse item"},
+		},
+	}
+}
+
+// Validate checks template by rendering sample items with it
+func Validate(template string) error {
+	r, err := NewRenderer(Config{Template: template})
+	if err != nil {
+		return err
+	}
+	for _, sample := range samples() {
+		message, err := r.Render(sample)
+		if err != nil {
+			return fmt.Errorf("rendering %s: %w", sample.Item.Title, err)
+		}
+		if strings.TrimSpace(message) == "" {
+			return fmt.Errorf("%s is rendered empty", sample.Item.Title)
+		}
+		if utf16Len([]rune(message)) > MaxMessageLength {
+			return fmt.Errorf("%s is rendered longer than a message", sample.Item.Title)
+		}
+	}
+	return nil
+}
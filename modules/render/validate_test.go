@@ -0,0 +1,54 @@
+package render
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		wantErr  bool
+	}{
+		{
+			name:     "Normal",
+			template: "*{{ .Item.Title }}*\n{{ if .HasTelegraph }}{{ .TelegraphURL }}{{ else }}{{ .Item.Link }}{{ end }}",
+			wantErr:  false,
+		},
+		{
+			name:     "Guarded optional field",
+			template: "{{ .Item.Title }}{{ with .Item.Author }} by {{ .Name }}{{ end }}",
+			wantErr:  false,
+		},
+		{
+			name:     "Timestamp",
+			template: "{{ .Item.Title }} {{ .Published.Format \"Jan 2 15:04\" }}",
+			wantErr:  false,
+		},
+		{
+			name:     "Syntax error",
+			template: "{{ .Item.Title",
+			wantErr:  true,
+		},
+		{
+			name:     "Unknown field",
+			template: "{{ .Item.Headline }}",
+			wantErr:  true,
+		},
+		{
+			name:     "Missing optional field",
+			template: "{{ .Item.Author.Name }}",
+			wantErr:  true,
+		},
+		{
+			name:     "Empty",
+			template: "{{ if false }}x{{ end }}",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(tt.template); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package scrape
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"github.com/mmcdole/gofeed"
+)
+
+// Spec tells how to find items in a page with CSS selectors
+// Title, Link, Date and Content are matched within each Item
+type Spec struct {
+	Item    string `json:"item"`
+	Title   string `json:"title"`
+	Link    string `json:"link,omitempty"`
+	Date    string `json:"date,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// dateLayouts are tried in order to parse dates in pages
+var dateLayouts = []string{
+	time.RFC3339,
+	time.RFC1123Z,
+	time.RFC1123,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02",
+	"Jan 2, 2006",
+	"January 2, 2006",
+	"2 Jan 2006",
+	"2 January 2006",
+	"Mon, Jan 2, 2006",
+}
+
+// ParseSpec decodes a spec stored in a source
+func ParseSpec(data string) (*Spec, error) {
+	var spec Spec
+	if err := json.Unmarshal([]byte(data), &spec); err != nil {
+		return nil, err
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// String encodes spec to be stored in a source
+func (s *Spec) String() string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+// Validate checks that required selectors are given and all selectors compile
+func (s *Spec) Validate() error {
+	if s.Item == "" || s.Title == "" {
+		return errors.New("item and title selectors are required")
+	}
+	for _, selector := range []string{s.Item, s.Title, s.Link, s.Date, s.Content} {
+		if selector == "" {
+			continue
+		}
+		if _, err := cascadia.Compile(selector); err != nil {
+			return fmt.Errorf("illegal selector \"%s\": %w", selector, err)
+		}
+	}
+	return nil
+}
+
+// Parse turns matches of spec in body into a feed
+// links are resolved against pageURL, items without title or link are skipped
+func Parse(body []byte, pageURL string, spec *Spec) (*gofeed.Feed, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	feed := &gofeed.Feed{
+		Title:    strings.TrimSpace(doc.Find("title").First().Text()),
+		Link:     pageURL,
+		FeedType: "scrape",
+	}
+	doc.Find(spec.Item).Each(func(_ int, s *goquery.Selection) {
+		item := &gofeed.Item{
+			Title: text(s.Find(spec.Title).First()),
+			Link:  link(s, spec.Link, base),
+		}
+		if item.Title == "" || item.Link == "" {
+			return
+		}
+		item.GUID = item.Link
+		if spec.Content != "" {
+			item.Content, _ = s.Find(spec.Content).First().Html()
+			item.Content = strings.TrimSpace(item.Content)
+		}
+		if spec.Date != "" {
+			item.Published, item.PublishedParsed = date(s.Find(spec.Date).First())
+		}
+		feed.Items = append(feed.Items, item)
+	})
+	return feed, nil
+}
+
+// text returns text of s with spaces collapsed
+func text(s *goquery.Selection) string {
+	return strings.Join(strings.Fields(s.Text()), " ")
+}
+
+// link returns the absolute link of an item
+// the first link in item is used if selector is empty
+func link(s *goquery.Selection, selector string, base *url.URL) string {
+	var a *goquery.Selection
+	switch {
+	case selector != "":
+		a = s.Find(selector).First()
+	case goquery.NodeName(s) == "a":
+		a = s
+	default:
+		a = s.Find("a[href]").First()
+	}
+	href, ok := a.Attr("href")
+	if !ok {
+		return ""
+	}
+	ref, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return ""
+	}
+	return base.ResolveReference(ref).String()
+}
+
+// date parses the datetime attribute or text of s
+func date(s *goquery.Selection) (string, *time.Time) {
+	value, ok := s.Attr("datetime")
+	if !ok {
+		value = text(s)
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return value, &t
+		}
+	}
+	return value, nil
+}
@@ -0,0 +1,89 @@
+package scrape
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	body, err := ioutil.ReadFile(filepath.Join("testdata", "blog-index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := &Spec{
+		Item:    "article.news-card",
+		Title:   ".news-card__title",
+		Link:    ".news-card__title a",
+		Date:    "time",
+		Content: ".news-card__summary",
+	}
+	feed, err := Parse(body, "https://www.example.com/news/", spec)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if feed.Title != "Example Studio News" {
+		t.Errorf("Parse() title = %q", feed.Title)
+	}
+
+	published := time.Date(2021, 5, 14, 9, 30, 0, 0, time.UTC)
+	april := time.Date(2021, 4, 30, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		title     string
+		link      string
+		content   string
+		published *time.Time
+	}{
+		{
+			title:     "Launch week recap",
+			link:      "https://www.example.com/news/2021/05/launch-week",
+			content:   "<p>Five launches in five days, here is everything we shipped.</p>",
+			published: &published,
+		},
+		{
+			title:     "We are hiring designers",
+			link:      "https://blog.example.org/hiring",
+			content:   "<p>Join our design team.</p>",
+			published: &april,
+		},
+		{
+			title: "Archive of 2020",
+			link:  "https://www.example.com/archive/2020",
+		},
+	}
+	if len(feed.Items) != len(tests) {
+		t.Fatalf("Parse() got %d items, want %d", len(feed.Items), len(tests))
+	}
+	for i, tt := range tests {
+		item := feed.Items[i]
+		if item.Title != tt.title || item.Link != tt.link || item.GUID != tt.link || item.Content != tt.content {
+			t.Errorf("item %d = %q %q %q, want %q %q %q", i, item.Title, item.Link, item.Content, tt.title, tt.link, tt.content)
+		}
+		switch {
+		case tt.published == nil && item.PublishedParsed != nil:
+			t.Errorf("item %d published = %v, want nil", i, item.PublishedParsed)
+		case tt.published != nil && (item.PublishedParsed == nil || !item.PublishedParsed.Equal(*tt.published)):
+			t.Errorf("item %d published = %v, want %v", i, item.PublishedParsed, tt.published)
+		}
+	}
+}
+
+func TestSpec_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    Spec
+		wantErr bool
+	}{
+		{name: "Valid", spec: Spec{Item: "li.post", Title: "h2", Date: "time[datetime]"}},
+		{name: "Missing title", spec: Spec{Item: "li.post"}, wantErr: true},
+		{name: "Illegal selector", spec: Spec{Item: "li..post", Title: "h2"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.spec.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Spec.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,361 @@
+package telegraph
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	tgraph "github.com/TechMinerApps/telegraph"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Tags and attributes allowed by Telegraph
+// see https://telegra.ph/api#NodeElement
+var allowedTags = map[string]bool{
+	"a": true, "aside": true, "b": true, "blockquote": true, "br": true, "code": true,
+	"em": true, "figcaption": true, "figure": true, "h3": true, "h4": true, "hr": true,
+	"i": true, "iframe": true, "img": true, "li": true, "ol": true, "p": true,
+	"pre": true, "s": true, "strong": true, "u": true, "ul": true, "video": true,
+}
+
+// blockTags are tags that start a new block, whitespace around them is dropped
+var blockTags = map[string]bool{
+	"aside": true, "blockquote": true, "figcaption": true, "figure": true, "h3": true, "h4": true,
+	"hr": true, "li": true, "ol": true, "p": true, "pre": true, "ul": true,
+}
+
+// voidTags are kept without children
+var voidTags = map[string]bool{
+	"br": true, "hr": true, "img": true, "iframe": true, "video": true,
+}
+
+// renamedTags maps HTML tags to the closest Telegraph tag
+var renamedTags = map[string]string{
+	"h1": "h3", "h2": "h3", "h5": "h4", "h6": "h4",
+	"del": "s", "strike": "s", "ins": "u", "cite": "i", "var": "i", "dfn": "i",
+	"tt": "code", "kbd": "code", "samp": "code",
+	"dt": "p", "dd": "p", "caption": "p",
+}
+
+// containerTags become a paragraph if they only hold inline content
+// and are unwrapped otherwise
+var containerTags = map[string]bool{
+	"div": true, "section": true, "article": true, "header": true, "footer": true,
+	"main": true, "nav": true, "details": true, "summary": true, "center": true,
+	"address": true, "dl": true,
+}
+
+// droppedTags are removed with their content
+var droppedTags = map[string]bool{
+	"script": true, "style": true, "noscript": true, "head": true, "title": true,
+	"meta": true, "link": true, "form": true, "input": true, "button": true,
+	"select": true, "textarea": true, "svg": true, "object": true, "embed": true,
+	"template": true, "canvas": true, "map": true,
+}
+
+var spaces = regexp.MustCompile(`\s+`)
+
+// sanitizer converts HTML to nodes accepted by Telegraph
+type sanitizer struct {
+	base *url.URL
+}
+
+// state is passed down while converting
+type state struct {
+	pre     bool
+	heading bool
+}
+
+// sanitize converts HTML content of a feed item to Telegraph nodes
+// links and images are resolved against link of the item
+// unsupported elements are converted to the closest allowed ones or unwrapped
+func sanitize(content string, link string) ([]tgraph.Node, error) {
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	doc, err := html.ParseFragment(strings.NewReader(content), body)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &sanitizer{}
+	if u, err := url.Parse(link); err == nil && u.IsAbs() {
+		s.base = u
+	}
+
+	for _, n := range doc {
+		body.AppendChild(n)
+	}
+	return trim(s.children(body, state{})), nil
+}
+
+// convert returns nodes converted from n, empty if n is dropped
+func (s *sanitizer) convert(n *html.Node, st state) []tgraph.Node {
+	switch n.Type {
+	case html.TextNode:
+		if st.pre {
+			return []tgraph.Node{n.Data}
+		}
+		text := spaces.ReplaceAllString(n.Data, " ")
+		if text == "" {
+			return nil
+		}
+		return []tgraph.Node{text}
+	case html.ElementNode:
+	default:
+		return nil
+	}
+
+	tag := n.Data
+	if renamed, ok := renamedTags[tag]; ok {
+		tag = renamed
+	}
+	switch {
+	case droppedTags[tag]:
+		return nil
+	case tag == "h3" || tag == "h4":
+		// Telegraph does not allow nested headings
+		if st.heading {
+			return s.children(n, st)
+		}
+		st.heading = true
+		return element(tag, nil, s.children(n, st))
+	case tag == "pre":
+		st.pre = true
+		return element(tag, nil, s.children(n, st))
+	case tag == "a":
+		href := s.resolve(attr(n, "href"))
+		if href == "" {
+			return s.children(n, st)
+		}
+		return element(tag, map[string]string{"href": href}, s.children(n, st))
+	case tag == "img":
+		// Lazy loaded images keep the real source in data-src
+		src := s.resolve(attr(n, "src"))
+		if src == "" {
+			src = s.resolve(attr(n, "data-src"))
+		}
+		// Tracking pixels show nothing
+		if src == "" || attr(n, "width") == "1" || attr(n, "height") == "1" {
+			return nil
+		}
+		return element(tag, map[string]string{"src": src}, nil)
+	case tag == "iframe" || tag == "audio":
+		// Telegraph only embeds its own iframes, link to the source instead
+		src := s.resolve(attr(n, "src"))
+		if src == "" {
+			src = s.resolve(sourceOf(n))
+		}
+		if src == "" {
+			return nil
+		}
+		return element("a", map[string]string{"href": src}, []tgraph.Node{src})
+	case tag == "video":
+		src := s.resolve(attr(n, "src"))
+		if src == "" {
+			src = s.resolve(sourceOf(n))
+		}
+		if src == "" {
+			return nil
+		}
+		return element(tag, map[string]string{"src": src}, nil)
+	case tag == "li" && (n.Parent == nil || (n.Parent.Data != "ul" && n.Parent.Data != "ol")):
+		return element("p", nil, s.children(n, st))
+	case tag == "table":
+		return s.table(n, st)
+	case containerTags[tag]:
+		children := s.children(n, st)
+		if hasBlock(children) {
+			return trim(children)
+		}
+		return element("p", nil, children)
+	case allowedTags[tag]:
+		return element(tag, nil, s.children(n, st))
+	default:
+		// Unknown inline tags like span and font
+		return s.children(n, st)
+	}
+}
+
+// children converts children of n
+func (s *sanitizer) children(n *html.Node, st state) []tgraph.Node {
+	var nodes []tgraph.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		for _, node := range s.convert(c, st) {
+			// Join text split by dropped elements
+			if text, ok := node.(string); ok && len(nodes) > 0 {
+				if last, ok := nodes[len(nodes)-1].(string); ok {
+					text = last + text
+					if !st.pre {
+						text = spaces.ReplaceAllString(text, " ")
+					}
+					nodes[len(nodes)-1] = text
+					continue
+				}
+			}
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// table degrades a data table to one paragraph per row, cells separated by " | "
+// header cells are bold
+// layout tables, whose cells hold blocks, are unwrapped
+func (s *sanitizer) table(n *html.Node, st state) []tgraph.Node {
+	var rows [][][]tgraph.Node
+	var headers [][]bool
+	var captions []tgraph.Node
+	layout := false
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			switch c.Data {
+			case "caption":
+				captions = append(captions, element("p", nil, element("b", nil, s.children(c, st)))...)
+			case "tr":
+				var cells [][]tgraph.Node
+				var header []bool
+				for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.Type != html.ElementNode || (cell.Data != "td" && cell.Data != "th") {
+						continue
+					}
+					children := trim(s.children(cell, st))
+					layout = layout || hasBlock(children)
+					cells = append(cells, children)
+					header = append(header, cell.Data == "th")
+				}
+				rows = append(rows, cells)
+				headers = append(headers, header)
+			case "thead", "tbody", "tfoot":
+				walk(c)
+			}
+		}
+	}
+	walk(n)
+
+	nodes := captions
+	for i, cells := range rows {
+		if layout {
+			for _, cell := range cells {
+				nodes = append(nodes, cell...)
+			}
+			continue
+		}
+		var row []tgraph.Node
+		for j, cell := range cells {
+			if headers[i][j] {
+				cell = element("b", nil, cell)
+			}
+			if len(cell) == 0 {
+				continue
+			}
+			if len(row) > 0 {
+				row = append(row, " | ")
+			}
+			row = append(row, cell...)
+		}
+		nodes = append(nodes, element("p", nil, row)...)
+	}
+	return trim(nodes)
+}
+
+// resolve returns an absolute URL of ref, empty if it is not safe to link
+// relative URLs are dropped without base, Telegraph rejects them
+func (s *sanitizer) resolve(ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	if s.base != nil {
+		u = s.base.ResolveReference(u)
+	}
+	switch u.Scheme {
+	case "http", "https", "mailto", "tg":
+		return u.String()
+	case "":
+		// Relative URL without base, only protocol relative ones can be kept
+		if u.Host == "" {
+			return ""
+		}
+		u.Scheme = "https"
+		return u.String()
+	default:
+		// javascript:, data: and others
+		return ""
+	}
+}
+
+// element returns a node of tag, empty if it has nothing to show
+func element(tag string, attrs map[string]string, children []tgraph.Node) []tgraph.Node {
+	if blockTags[tag] {
+		children = trim(children)
+	}
+	if !voidTags[tag] && len(children) == 0 {
+		return nil
+	}
+	return []tgraph.Node{tgraph.NodeElement{Tag: tag, Attrs: attrs, Children: children}}
+}
+
+// trim drops whitespace next to block elements and at both ends
+func trim(nodes []tgraph.Node) []tgraph.Node {
+	var result []tgraph.Node
+	for i, n := range nodes {
+		text, ok := n.(string)
+		if !ok {
+			result = append(result, n)
+			continue
+		}
+		if i == 0 || isBlock(nodes[i-1]) {
+			text = strings.TrimLeft(text, " ")
+		}
+		if i == len(nodes)-1 || isBlock(nodes[i+1]) {
+			text = strings.TrimRight(text, " ")
+		}
+		if text != "" {
+			result = append(result, text)
+		}
+	}
+	return result
+}
+
+func hasBlock(nodes []tgraph.Node) bool {
+	for _, n := range nodes {
+		if isBlock(n) {
+			return true
+		}
+	}
+	return false
+}
+
+func isBlock(n tgraph.Node) bool {
+	e, ok := n.(tgraph.NodeElement)
+	return ok && blockTags[e.Tag]
+}
+
+// attr returns value of attribute key of n
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// sourceOf returns src of the first <source> in a media element
+func sourceOf(n *html.Node) string {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.Data == "source" {
+			return attr(c, "src")
+		}
+	}
+	return ""
+}
@@ -0,0 +1,109 @@
+package telegraph
+
+import (
+	"flag"
+	"html"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	tgraph "github.com/TechMinerApps/telegraph"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func Test_sanitize(t *testing.T) {
+	tests := []struct {
+		name string
+		link string
+	}{
+		{name: "wordpress", link: "https://example.com/blog/release-2-0/"},
+		{name: "github-release", link: "https://github.com/example/project/releases/tag/v1.4.0"},
+		{name: "newsletter", link: "https://news.example.org/issues/42"},
+		{name: "media", link: "https://podcast.example.net/episodes/12"},
+		{name: "relative", link: "/posts/7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := ioutil.ReadFile(filepath.Join("testdata", tt.name+".html"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			nodes, err := sanitize(string(content), tt.link)
+			if err != nil {
+				t.Fatalf("sanitize() error = %v", err)
+			}
+			checkNodes(t, nodes)
+			got := renderNodes(nodes)
+
+			golden := filepath.Join("testdata", tt.name+".golden")
+			if *update {
+				if err := ioutil.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("sanitize() =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+// checkNodes fails if nodes use anything Telegraph rejects
+func checkNodes(t *testing.T, nodes []tgraph.Node) {
+	for _, n := range nodes {
+		e, ok := n.(tgraph.NodeElement)
+		if !ok {
+			continue
+		}
+		if !allowedTags[e.Tag] {
+			t.Errorf("tag %s is not allowed", e.Tag)
+		}
+		for key, value := range e.Attrs {
+			if key != "href" && key != "src" {
+				t.Errorf("attribute %s of %s is not allowed", key, e.Tag)
+			}
+			if u, err := url.Parse(value); err != nil || !u.IsAbs() {
+				t.Errorf("%s %q of %s is not absolute", key, value, e.Tag)
+			}
+		}
+		checkNodes(t, e.Children)
+	}
+}
+
+// renderNodes prints nodes as HTML, one block element per line
+func renderNodes(nodes []tgraph.Node) string {
+	var b strings.Builder
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case string:
+			b.WriteString(html.EscapeString(n))
+		case tgraph.NodeElement:
+			b.WriteString("<" + n.Tag)
+			var keys []string
+			for key := range n.Attrs {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				b.WriteString(" " + key + "=\"" + html.EscapeString(n.Attrs[key]) + "\"")
+			}
+			b.WriteString(">")
+			if !voidTags[n.Tag] {
+				b.WriteString(renderNodes(n.Children))
+				b.WriteString("</" + n.Tag + ">")
+			}
+			if blockTags[n.Tag] {
+				b.WriteString("\n")
+			}
+		}
+	}
+	return b.String()
+}
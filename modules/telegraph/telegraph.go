@@ -1,19 +1,22 @@
 package telegraph
 
 import (
+	"context"
 	"errors"
-	"sync"
 	"time"
 
 	"github.com/TechMinerApps/portier/models"
 	"github.com/TechMinerApps/portier/modules/log"
+	"github.com/TechMinerApps/portier/utils"
 	tgraph "github.com/TechMinerApps/telegraph"
+	"gorm.io/gorm"
 )
 
 type Telegraph interface {
 
 	// Publish is a blocking function that insert the provided feed into queue and wait for process
-	Publish(item *models.Feed) (string, error)
+	// it returns ctx.Err() if ctx is done before the page is published
+	Publish(ctx context.Context, item *models.Feed) (string, error)
 
 	// Start is used to start a instance
 	// telegraph do not needs to stop, just close the input channel
@@ -26,44 +29,67 @@ type Config struct {
 	AuthorName    string
 	AuthorURL     string
 
+	// AccessToken holds tokens of existing accounts
+	// accounts are created until there are AccountNumber of them
 	AccessToken []string
 	Logger      log.Logger
+
+	// DB caches published pages so an item is not published twice
+	DB *gorm.DB
+
+	// OnAccountCreated is called with the token of every new account
+	// so it can be saved and loaded on next start
+	OnAccountCreated func(token string)
 }
 
+// floodCooldown is how long a client rests after a flood wait
+// Telegraph asks for 7s, wait a longer 10 seconds to ensure success
+const floodCooldown = 10 * time.Second
+
+// Item is a page waiting to be published
 type Item struct {
-	ResultChan chan<- string
+	Context    context.Context
+	ResultChan chan<- Result
 	Feed       *models.Feed
+
+	page tgraph.Page
+	hash string
+
+	// cached is the page published before, nil if there is none
+	cached *models.Content
+}
+
+// Result is the outcome of publishing an Item
+type Result struct {
+	URL string
+	Err error
+}
+
+// worker publishes with one client
+// workers share a queue, so idle ones pick up work while others cool down
+type worker struct {
+	client tgraph.Client
+	token  string
+
+	// own holds edits of pages owned by this client
+	own chan *Item
 }
 
 type telegraph struct {
-	logger        log.Logger
-	config        *Config
-	clientPool    []tgraph.Client
-	currentClient int
-	lock          sync.Mutex
-	queue         chan *Item
+	logger  log.Logger
+	config  *Config
+	workers []*worker
+	queue   chan *Item
 }
 
 func NewTelegraph(c *Config) (Telegraph, error) {
+	if c.DB == nil {
+		return nil, errors.New("telegraph config error")
+	}
 	t := &telegraph{
 		logger: c.Logger,
 		config: c,
-
-		// Load balance with round-robin
-		clientPool:    []tgraph.Client{},
-		currentClient: 0,
-
-		// Mutex lock to protect currentClient
-		lock:  sync.Mutex{},
-		queue: make(chan *Item),
-	}
-
-	// If newly created instance
-	if len(c.AccessToken) == 0 {
-		if err := t.createAccount(); err != nil {
-			return nil, err
-		}
-		return t, nil
+		queue:  make(chan *Item),
 	}
 
 	// Spawn clients from access token
@@ -72,13 +98,30 @@ func NewTelegraph(c *Config) (Telegraph, error) {
 		if err != nil {
 			return nil, err
 		}
-		t.clientPool = append(t.clientPool, client)
+		t.addWorker(client, token)
+	}
+
+	// Create accounts missing
+	if err := t.createAccount(); err != nil {
+		return nil, err
+	}
+	if len(t.workers) == 0 {
+		return nil, errors.New("no telegraph account")
 	}
 	return t, nil
 }
 
+func (t *telegraph) addWorker(client tgraph.Client, token string) {
+	t.workers = append(t.workers, &worker{
+		client: client,
+		token:  token,
+		own:    make(chan *Item),
+	})
+}
+
+// createAccount creates accounts until there are AccountNumber of them
 func (t *telegraph) createAccount() error {
-	for i := 0; i < t.config.AccountNumber; i++ {
+	for i := len(t.workers); i < t.config.AccountNumber; i++ {
 		AccountInfo := tgraph.Account{
 			AccessToken: "",
 			AuthURL:     "",
@@ -92,8 +135,12 @@ func (t *telegraph) createAccount() error {
 		if err != nil {
 			return err
 		}
-		t.clientPool = append(t.clientPool, client)
-		t.config.AccessToken = append(t.config.AccessToken, client.Account().AccessToken)
+		token := client.Account().AccessToken
+		t.addWorker(client, token)
+		t.config.AccessToken = append(t.config.AccessToken, token)
+		if t.config.OnAccountCreated != nil {
+			t.config.OnAccountCreated(token)
+		}
 		t.logger.Infof("Created Telegraph account %d success", i)
 
 		// Avoid flood wait
@@ -104,86 +151,197 @@ func (t *telegraph) createAccount() error {
 }
 
 func (t *telegraph) Start() {
-	go func() {
-		for item := range t.queue {
-			for {
-				url, err := t.publish(item)
-				if err == nil {
-					item.ResultChan <- url
-					break
-				} else if err == tgraph.ErrFloodWait {
-					t.logger.Warnf("Recieve Telegraph flood wait: %s", err.Error())
-
-					// Flood wait 7s, but wait a longer 10 seconds to ensure success
-					time.Sleep(10 * time.Second)
-				} else {
-					t.logger.Errorf("Error publishing to telegraph: %s", err.Error())
-					item.ResultChan <- ""
-					break
-				}
-			}
+	for _, w := range t.workers {
+		go t.work(w)
+	}
+}
+
+// work publishes items from own and shared queue
+func (t *telegraph) work(w *worker) {
+	for {
+		var item *Item
+		select {
+		case item = <-w.own:
+		case item = <-t.queue:
+		}
+
+		// Caller stopped waiting
+		if err := item.Context.Err(); err != nil {
+			item.ResultChan <- Result{Err: err}
+			continue
+		}
+
+		url, err := t.publish(w, item)
+		if err == tgraph.ErrFloodWait {
+			t.logger.Warnf("Recieve Telegraph flood wait: %s", err.Error())
 
+			// Let others take the item while this client cools down
+			// edits can only be done by the owner, so they wait
+			queue := t.queue
+			if item.cached != nil && item.cached.AccessToken == w.token {
+				queue = w.own
+			}
+			go t.enqueue(queue, item)
+			time.Sleep(floodCooldown)
+			continue
+		}
+		if err != nil {
+			t.logger.Errorf("Error publishing to telegraph: %s", err.Error())
 		}
-	}()
+		item.ResultChan <- Result{URL: url, Err: err}
+	}
+}
+
+// enqueue puts item into queue unless caller stopped waiting
+func (t *telegraph) enqueue(queue chan<- *Item, item *Item) {
+	select {
+	case queue <- item:
+	case <-item.Context.Done():
+		item.ResultChan <- Result{Err: item.Context.Err()}
+	}
 }
 
 // Publish is a blocking function that wait for the page to return or return a error
-func (t *telegraph) Publish(feed *models.Feed) (string, error) {
-	resultCh := make(chan string)
-	defer close(resultCh)
+func (t *telegraph) Publish(ctx context.Context, feed *models.Feed) (string, error) {
+
+	// content directly from feed, many feeds only have description
+	htmlContent := feed.Item.Content
+	if htmlContent == "" {
+		htmlContent = feed.Item.Description
+	}
+	page, err := t.page(feed, htmlContent)
+	if err != nil {
+		return "", err
+	}
+
+	// Result is buffered so workers never block on callers gone
+	resultCh := make(chan Result, 1)
 	item := &Item{
+		Context:    ctx,
 		ResultChan: resultCh,
 		Feed:       feed,
+		page:       page,
+		hash:       contentHash(&page, htmlContent),
+	}
+
+	// Reuse page published before
+	var cached models.Content
+	result := t.config.DB.Where("hash_id = ?", feed.FeedID).Limit(1).Find(&cached)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	queue := t.queue
+	if result.RowsAffected > 0 {
+		if cached.ContentHash == item.hash {
+			return cached.TelegraphURL, nil
+		}
+		item.cached = &cached
+
+		// Content changed, edit page by its owner
+		if w := t.owner(cached.AccessToken); w != nil {
+			queue = w.own
+		}
 	}
 
 	// Send item into queue
-	t.queue <- item
+	select {
+	case queue <- item:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
 
 	// Wait for result
-	url := <-resultCh
-	if url == "" {
-		return "", errors.New("receiving empty url, may be error")
+	select {
+	case r := <-resultCh:
+		if r.Err != nil {
+			return "", r.Err
+		}
+		if r.URL == "" {
+			return "", errors.New("receiving empty url, may be error")
+		}
+		return r.URL, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
 	}
-
-	return url, nil
 }
 
-func (t *telegraph) publish(item *Item) (string, error) {
+// publish creates page of item or edits it if owned by w
+func (t *telegraph) publish(w *worker, item *Item) (string, error) {
 
 	// publish should not mess with channel
 
-	// content directly from feed
-	htmlContent := item.Feed.Item.Content
-	if htmlContent == "" {
-		// Must have content
-		htmlContent = "Empty Content"
+	cached := item.cached
+	if cached != nil && cached.AccessToken == w.token {
+		return t.edit(w.client, cached, item.page, item.hash)
 	}
 
-	// use mutex lock to avoid concurrent use of same client
-	t.lock.Lock()
-	defer t.lock.Unlock()
-	defer func() {
-		t.currentClient++
-		if t.currentClient == len(t.clientPool) {
-			t.currentClient = 0
-		}
-	}()
-
-	// Create a new page
-	content, err := t.clientPool[t.currentClient].ContentFormat(htmlContent)
+	created, err := w.client.CreatePage(item.page, false)
 	if err != nil {
 		return "", err
 	}
-	page := tgraph.Page{
-		Title:       item.Feed.Item.Title,
-		Description: item.Feed.Item.Description,
-		AuthorName:  item.Feed.Item.Author.Name,
-		AuthorURL:   item.Feed.Item.Link,
-		Content:     content,
+
+	// Owner of the page is gone, page is published again
+	if cached == nil {
+		cached = &models.Content{}
 	}
-	if page, err := t.clientPool[t.currentClient].CreatePage(page, false); err != nil {
+	cached.HashID = item.Feed.FeedID
+	cached.SourceURL = item.Feed.Item.Link
+	cached.Title = item.Feed.Item.Title
+	cached.TelegraphURL = created.URL
+	cached.TelegraphPath = created.Path
+	cached.ContentHash = item.hash
+	cached.AccessToken = w.token
+	if err := t.config.DB.Save(cached).Error; err != nil {
+		t.logger.Errorf("Error caching Telegraph page: %s", err.Error())
+	}
+	return created.URL, nil
+}
+
+// edit updates a cached page with new content
+func (t *telegraph) edit(client tgraph.Client, cached *models.Content, page tgraph.Page, hash string) (string, error) {
+	page.Path = cached.TelegraphPath
+	if _, err := client.EditPage(page, false); err != nil {
 		return "", err
-	} else {
-		return page.URL, nil
 	}
+	if err := t.config.DB.Model(cached).Update("content_hash", hash).Error; err != nil {
+		t.logger.Errorf("Error caching Telegraph page: %s", err.Error())
+	}
+	return cached.TelegraphURL, nil
+}
+
+// page returns Telegraph page of feed with htmlContent converted to Telegraph nodes
+func (t *telegraph) page(feed *models.Feed, htmlContent string) (tgraph.Page, error) {
+	page := tgraph.Page{
+		Title:       feed.Item.Title,
+		Description: feed.Item.Description,
+		AuthorURL:   feed.Item.Link,
+	}
+	if feed.Item.Author != nil {
+		page.AuthorName = feed.Item.Author.Name
+	}
+	content, err := sanitize(htmlContent, feed.Item.Link)
+	if err != nil {
+		return page, err
+	}
+	if len(content) == 0 {
+		// Must have content
+		content = []tgraph.Node{"Empty Content"}
+	}
+	page.Content = content
+	return page, nil
+}
+
+// contentHash identifies what is shown on a page
+func contentHash(page *tgraph.Page, htmlContent string) string {
+	return utils.StringHash(page.Title + "\n" + page.AuthorName + "\n" + page.AuthorURL + "\n" + htmlContent)
+}
+
+// owner returns the worker of token, nil if the account is not used anymore
+func (t *telegraph) owner(token string) *worker {
+	for _, w := range t.workers {
+		if w.token == token {
+			return w
+		}
+	}
+	return nil
 }
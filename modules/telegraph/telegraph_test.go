@@ -0,0 +1,198 @@
+package telegraph
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TechMinerApps/portier/models"
+	tgraph "github.com/TechMinerApps/telegraph"
+	"github.com/mmcdole/gofeed"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// client is embedded by fakeClient, the interface has a Client method
+type client = tgraph.Client
+
+// fakeClient publishes pages without network
+// it answers flood wait to the first floods calls
+type fakeClient struct {
+	client
+	name string
+
+	lock    sync.Mutex
+	floods  int
+	created int
+	edited  int
+}
+
+func (c *fakeClient) CreatePage(page tgraph.Page, returnContent bool) (*tgraph.Page, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.floods > 0 {
+		c.floods--
+		return nil, tgraph.ErrFloodWait
+	}
+	c.created++
+	path := c.name + "-" + page.Title
+	return &tgraph.Page{Path: path, URL: "https://telegra.ph/" + path}, nil
+}
+
+func (c *fakeClient) EditPage(page tgraph.Page, returnContent bool) (*tgraph.Page, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.edited++
+	return &page, nil
+}
+
+func newTestTelegraph(t *testing.T, clients ...*fakeClient) *telegraph {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Content{}); err != nil {
+		t.Fatal(err)
+	}
+	tg := &telegraph{
+		logger: zap.NewNop().Sugar(),
+		config: &Config{DB: db},
+		queue:  make(chan *Item),
+	}
+	for _, c := range clients {
+		tg.addWorker(c, c.name)
+	}
+	tg.Start()
+	return tg
+}
+
+func newTestFeed(id string, content string) *models.Feed {
+	return &models.Feed{FeedID: id, Item: &gofeed.Item{Title: id, Content: content, Link: "https://example.com/" + id}}
+}
+
+func Test_telegraph_Publish(t *testing.T) {
+	flooded := &fakeClient{name: "a", floods: 1}
+	idle := &fakeClient{name: "b"}
+	tg := newTestTelegraph(t, flooded, idle)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Whoever gets the item first, it is published by a client not cooling down
+	url, err := tg.Publish(ctx, newTestFeed("one", "<p>hello</p>"))
+	if err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	// Same content reuses the page without calling Telegraph
+	again, err := tg.Publish(ctx, newTestFeed("one", "<p>hello</p>"))
+	if err != nil || again != url {
+		t.Fatalf("Publish() again = %v, %v, want %v", again, err, url)
+	}
+	if created := flooded.created + idle.created; created != 1 {
+		t.Errorf("created %d pages, want 1", created)
+	}
+
+	// Changed content is edited by the owner of the page
+	var owner *fakeClient
+	for _, c := range []*fakeClient{flooded, idle} {
+		if url == "https://telegra.ph/"+c.name+"-one" {
+			owner = c
+		}
+	}
+	if owner == nil {
+		t.Fatalf("Publish() = %v, owner unknown", url)
+	}
+	edited, err := tg.Publish(ctx, newTestFeed("one", "<p>hello again</p>"))
+	if err != nil || edited != url {
+		t.Fatalf("Publish() edited = %v, %v, want %v", edited, err, url)
+	}
+	if owner.edited != 1 {
+		t.Errorf("owner edited %d pages, want 1", owner.edited)
+	}
+}
+
+func Test_telegraph_Publish_canceled(t *testing.T) {
+	// Every client cools down, caller gives up waiting
+	tg := newTestTelegraph(t, &fakeClient{name: "a", floods: 100})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := tg.Publish(ctx, newTestFeed("one", "<p>hello</p>")); err != context.DeadlineExceeded {
+		t.Errorf("Publish() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func Test_telegraph_Publish_cache(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		owner       string
+		wantURL     string
+		wantCreated int
+		wantEdited  int
+	}{
+		{
+			name:    "Unchanged content",
+			content: "<p>hello</p>",
+			owner:   "a",
+			wantURL: "https://telegra.ph/a-one",
+		},
+		{
+			name:       "Changed content",
+			content:    "<p>hello again</p>",
+			owner:      "a",
+			wantURL:    "https://telegra.ph/a-one",
+			wantEdited: 1,
+		},
+		{
+			name:        "Owner of page gone",
+			content:     "<p>hello again</p>",
+			owner:       "gone",
+			wantURL:     "https://telegra.ph/a-one",
+			wantCreated: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &fakeClient{name: "a"}
+			tg := newTestTelegraph(t, c)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			// Page published before with <p>hello</p>
+			feed := newTestFeed("one", "<p>hello</p>")
+			page, err := tg.page(feed, feed.Item.Content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tg.config.DB.Create(&models.Content{
+				HashID:        "one",
+				TelegraphURL:  "https://telegra.ph/a-one",
+				TelegraphPath: "a-one",
+				ContentHash:   contentHash(&page, feed.Item.Content),
+				AccessToken:   tt.owner,
+			})
+
+			feed = newTestFeed("one", tt.content)
+			url, err := tg.Publish(ctx, feed)
+			if err != nil || url != tt.wantURL {
+				t.Fatalf("Publish() = %v, %v, want %v", url, err, tt.wantURL)
+			}
+			if c.created != tt.wantCreated || c.edited != tt.wantEdited {
+				t.Errorf("created %d and edited %d pages, want %d and %d", c.created, c.edited, tt.wantCreated, tt.wantEdited)
+			}
+
+			// Cache follows the published content
+			var cached models.Content
+			tg.config.DB.Where("hash_id = ?", "one").First(&cached)
+			page, _ = tg.page(feed, tt.content)
+			if cached.ContentHash != contentHash(&page, tt.content) {
+				t.Errorf("cached content hash not updated")
+			}
+			if tt.wantCreated > 0 && cached.AccessToken != "a" {
+				t.Errorf("cached page owned by %q, want a", cached.AccessToken)
+			}
+		})
+	}
+}
@@ -0,0 +1,383 @@
+package websub
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TechMinerApps/portier/models"
+	"github.com/TechMinerApps/portier/modules/log"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultLease is the lease asked from hubs if not configured
+	DefaultLease = 10 * 24 * time.Hour
+
+	// renewBefore is how long before expiry a lease is renewed
+	renewBefore = 24 * time.Hour
+
+	// renewInterval is the period of checking leases to renew
+	renewInterval = time.Hour
+
+	// retryAfter is how long to wait for a hub to verify before asking again
+	// verifications of requests older than it are refused
+	retryAfter = time.Hour
+
+	// maxPushSize is the largest content accepted from hubs
+	maxPushSize = 4 << 20
+)
+
+// Subscriber subscribes sources to WebSub hubs and receives their pushes
+// see https://www.w3.org/TR/websub/
+type Subscriber interface {
+	// Start starts the callback server and lease renewal
+	Start() error
+
+	// Stop stops the callback server and lease renewal
+	Stop() error
+
+	// Subscribe asks hub to push topic of source
+	// nothing is done if the subscription is active or waiting for verification
+	Subscribe(s *models.Source, hub string, topic string) error
+
+	// Active reports whether hub pushes content of source
+	Active(sourceID uint) bool
+
+	// ServeHTTP handles verification and content from hubs
+	http.Handler
+}
+
+// Config is used to create a Subscriber
+type Config struct {
+	// DB stores push subscriptions
+	DB *gorm.DB
+
+	// Listen is the address of the callback server
+	Listen string
+
+	// CallbackURL is the public URL routed to the callback server
+	// source ID is appended to it as the callback of each subscription
+	// with a nonce of each request in query
+	CallbackURL string
+
+	// Lease is the lease asked from hubs, DefaultLease if 0
+	Lease time.Duration
+
+	// Client is used to send requests to hubs, a client with timeout is used if nil
+	Client *http.Client
+
+	// OnContent is called with content pushed for a source
+	OnContent func(sourceID uint, body []byte)
+
+	Logger log.Logger
+}
+
+type subscriber struct {
+	Config
+	callback *url.URL
+	server   *http.Server
+	quit     chan struct{}
+}
+
+// NewSubscriber creates a Subscriber from config
+func NewSubscriber(c *Config) (Subscriber, error) {
+	if c.DB == nil || c.OnContent == nil {
+		return nil, errors.New("websub config error")
+	}
+	callback, err := url.Parse(c.CallbackURL)
+	if err != nil || !callback.IsAbs() {
+		return nil, errors.New("websub callback URL must be absolute")
+	}
+	s := &subscriber{
+		Config:   *c,
+		callback: callback,
+		quit:     make(chan struct{}),
+	}
+	if s.Lease <= 0 {
+		s.Lease = DefaultLease
+	}
+	if s.Client == nil {
+		s.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return s, nil
+}
+
+func (s *subscriber) Start() error {
+	if s.Listen != "" {
+		s.server = &http.Server{Addr: s.Listen, Handler: s}
+		go func() {
+			if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				s.Logger.Errorf("WebSub callback server error: %s", err.Error())
+			}
+		}()
+		s.Logger.Infof("WebSub callback server listening on %s", s.Listen)
+	}
+	go s.renew()
+	return nil
+}
+
+func (s *subscriber) Stop() error {
+	close(s.quit)
+	if s.server == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
+
+func (s *subscriber) Subscribe(source *models.Source, hub string, topic string) error {
+	var sub models.PushSubscription
+	result := s.DB.Where("source_id = ?", source.ID).Limit(1).Find(&sub)
+	if result.Error != nil {
+		return result.Error
+	}
+	now := time.Now()
+	if result.RowsAffected > 0 && sub.Hub == hub && sub.Topic == topic {
+		if sub.ExpiresAt.After(now) || now.Sub(sub.RequestedAt) < retryAfter {
+			return nil
+		}
+	} else {
+		secret, err := newSecret()
+		if err != nil {
+			return err
+		}
+		sub.SourceID = source.ID
+		sub.Hub = hub
+		sub.Topic = topic
+		sub.Secret = secret
+		sub.ExpiresAt = time.Time{}
+	}
+	return s.request(&sub)
+}
+
+// request sends a subscription request of sub to its hub
+// hub verifies it later by calling back with the nonce of request
+func (s *subscriber) request(sub *models.PushSubscription) error {
+	nonce, err := newSecret()
+	if err != nil {
+		return err
+	}
+	sub.Nonce = nonce
+	sub.RequestedAt = time.Now()
+	if err := s.DB.Save(sub).Error; err != nil {
+		return err
+	}
+	form := url.Values{
+		"hub.mode":          {"subscribe"},
+		"hub.topic":         {sub.Topic},
+		"hub.callback":      {s.callbackOf(sub.SourceID, sub.Nonce)},
+		"hub.secret":        {sub.Secret},
+		"hub.lease_seconds": {strconv.Itoa(int(s.Lease / time.Second))},
+	}
+	resp, err := s.Client.PostForm(sub.Hub, form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("hub %s responded %s", sub.Hub, resp.Status)
+	}
+	s.Logger.Infof("Requested WebSub subscription of %s from %s", sub.Topic, sub.Hub)
+	return nil
+}
+
+func (s *subscriber) Active(sourceID uint) bool {
+	var count int64
+	err := s.DB.Model(&models.PushSubscription{}).
+		Where("source_id = ? AND expires_at > ?", sourceID, time.Now()).
+		Count(&count).Error
+	if err != nil {
+		s.Logger.Errorf("Database error: %s", err.Error())
+		return false
+	}
+	return count > 0
+}
+
+// renew asks hubs again for leases about to expire
+// subscriptions of disabled sources are left to expire
+func (s *subscriber) renew() {
+	ticker := time.NewTicker(renewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		var subs []*models.PushSubscription
+		err := s.DB.Joins("JOIN sources ON sources.id = push_subscriptions.source_id").
+			Where("push_subscriptions.expires_at > ? AND push_subscriptions.expires_at < ?", now, now.Add(renewBefore)).
+			Where("push_subscriptions.requested_at < ? AND sources.disabled = ?", now.Add(-retryAfter), false).
+			Find(&subs).Error
+		if err != nil {
+			s.Logger.Errorf("Database error: %s", err.Error())
+			continue
+		}
+		for _, sub := range subs {
+			if err := s.request(sub); err != nil {
+				s.Logger.Warnf("Error renewing WebSub subscription of %s: %s", sub.Topic, err.Error())
+			}
+		}
+	}
+}
+
+func (s *subscriber) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sourceID, err := strconv.ParseUint(path.Base(r.URL.Path), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	var sub models.PushSubscription
+	result := s.DB.Where("source_id = ?", sourceID).Limit(1).Find(&sub)
+	if result.Error != nil {
+		s.Logger.Errorf("Database error: %s", result.Error.Error())
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.verify(w, r, &sub)
+	case http.MethodPost:
+		s.receive(w, r, &sub)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// verify answers the verification of hub
+// only a pending request can be verified, by the nonce in its callback
+// so nobody else can stop polling of a source with a forged lease
+func (s *subscriber) verify(w http.ResponseWriter, r *http.Request, sub *models.PushSubscription) {
+	query := r.URL.Query()
+	if query.Get("hub.topic") != sub.Topic || !s.pending(sub, query.Get("nonce")) {
+		http.NotFound(w, r)
+		return
+	}
+	switch query.Get("hub.mode") {
+	case "subscribe":
+		// Hubs may shorten the lease asked, but never extend it
+		lease := s.Lease
+		if seconds, err := strconv.Atoi(query.Get("hub.lease_seconds")); err == nil && seconds > 0 && time.Duration(seconds)*time.Second < lease {
+			lease = time.Duration(seconds) * time.Second
+		}
+		sub.ExpiresAt = time.Now().Add(lease)
+		sub.Nonce = ""
+		err := s.DB.Model(sub).Updates(map[string]interface{}{"expires_at": sub.ExpiresAt, "nonce": ""}).Error
+		if err != nil {
+			s.Logger.Errorf("Database error: %s", err.Error())
+			http.Error(w, "database error", http.StatusInternalServerError)
+			return
+		}
+		s.Logger.Infof("WebSub subscription of %s verified, lease expires at %s", sub.Topic, sub.ExpiresAt)
+		w.Write([]byte(query.Get("hub.challenge")))
+	case "denied":
+		s.Logger.Warnf("WebSub subscription of %s denied by %s: %s", sub.Topic, sub.Hub, query.Get("hub.reason"))
+		err := s.DB.Model(sub).Updates(map[string]interface{}{"expires_at": time.Time{}, "nonce": ""}).Error
+		if err != nil {
+			s.Logger.Errorf("Database error: %s", err.Error())
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		// Portier never unsubscribes, leases just expire
+		http.NotFound(w, r)
+	}
+}
+
+// pending reports whether nonce is of a request of sub waiting for verification
+func (s *subscriber) pending(sub *models.PushSubscription, nonce string) bool {
+	if sub.Nonce == "" || time.Since(sub.RequestedAt) > retryAfter {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(nonce), []byte(sub.Nonce)) == 1
+}
+
+// receive passes content pushed by hub to OnContent if its signature is valid
+func (s *subscriber) receive(w http.ResponseWriter, r *http.Request, sub *models.PushSubscription) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxPushSize))
+	if err != nil {
+		http.Error(w, "error reading body", http.StatusBadRequest)
+		return
+	}
+
+	// Hubs must get 2xx even if signature is wrong, content is just dropped
+	w.WriteHeader(http.StatusAccepted)
+	if !validSignature(r.Header.Get("X-Hub-Signature"), body, sub.Secret) {
+		s.Logger.Warnf("Dropped WebSub content of %s with invalid signature", sub.Topic)
+		return
+	}
+	s.OnContent(sub.SourceID, body)
+}
+
+// callbackOf returns the callback URL of a request of source
+func (s *subscriber) callbackOf(sourceID uint, nonce string) string {
+	u := *s.callback
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + strconv.Itoa(int(sourceID))
+	query := u.Query()
+	query.Set("nonce", nonce)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// validSignature checks X-Hub-Signature header of body
+// the header looks like sha256=<hex of HMAC>
+func validSignature(header string, body []byte, secret string) bool {
+	parts := strings.SplitN(header, "=", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	var h func() hash.Hash
+	switch parts[0] {
+	case "sha1":
+		h = sha1.New
+	case "sha256":
+		h = sha256.New
+	case "sha384":
+		h = sha512.New384
+	case "sha512":
+		h = sha512.New
+	default:
+		return false
+	}
+	signature, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(h, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(signature, mac.Sum(nil))
+}
+
+// newSecret returns a random secret for hub to sign content with
+func newSecret() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
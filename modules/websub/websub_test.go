@@ -0,0 +1,275 @@
+package websub
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TechMinerApps/portier/models"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every connection opens its own memory database
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.Source{}, &models.PushSubscription{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func sign(body, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func Test_subscriber(t *testing.T) {
+	const topic = "https://example.com/feed.xml"
+	db := newTestDB(t)
+	source := &models.Source{URL: topic, Title: "Example"}
+	db.Create(source)
+
+	pushed := make(map[uint]string)
+	var sub *subscriber
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sub.ServeHTTP(w, r)
+	}))
+	defer callback.Close()
+
+	// Hub verifies every subscription right away
+	// query of callback is kept as hubs must do
+	var secret string
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		secret = r.PostForm.Get("hub.secret")
+		verify, _ := url.Parse(r.PostForm.Get("hub.callback"))
+		query := verify.Query()
+		query.Set("hub.mode", "subscribe")
+		query.Set("hub.topic", r.PostForm.Get("hub.topic"))
+		query.Set("hub.challenge", "challenge")
+		query.Set("hub.lease_seconds", "3600")
+		verify.RawQuery = query.Encode()
+		resp, err := http.Get(verify.String())
+		if err != nil {
+			t.Errorf("verifying subscription: %v", err)
+			return
+		}
+		defer resp.Body.Close()
+		if body, _ := ioutil.ReadAll(resp.Body); string(body) != "challenge" {
+			t.Errorf("verification echoed %q, want challenge", body)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer hub.Close()
+
+	s, err := NewSubscriber(&Config{
+		DB:          db,
+		CallbackURL: callback.URL + "/websub",
+		OnContent:   func(id uint, body []byte) { pushed[id] = string(body) },
+		Logger:      zap.NewNop().Sugar(),
+	})
+	if err != nil {
+		t.Fatalf("NewSubscriber() error = %v", err)
+	}
+	sub = s.(*subscriber)
+
+	if s.Active(source.ID) {
+		t.Fatalf("Active() = true before subscribing")
+	}
+	if err := s.Subscribe(source, hub.URL, topic); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if !s.Active(source.ID) {
+		t.Fatalf("Active() = false after verification")
+	}
+
+	tests := []struct {
+		name      string
+		body      string
+		signature string
+		want      bool
+	}{
+		{
+			name:      "Valid signature",
+			body:      "<rss>valid</rss>",
+			signature: sign("<rss>valid</rss>", secret),
+			want:      true,
+		},
+		{
+			name:      "Wrong secret",
+			body:      "<rss>forged</rss>",
+			signature: sign("<rss>forged</rss>", "guess"),
+			want:      false,
+		},
+		{
+			name:      "Tampered body",
+			body:      "<rss>tampered</rss>",
+			signature: sign("<rss>valid</rss>", secret),
+			want:      false,
+		},
+		{
+			name:      "Unknown algorithm",
+			body:      "<rss>md5</rss>",
+			signature: "md5=00",
+			want:      false,
+		},
+		{
+			name:      "No signature",
+			body:      "<rss>unsigned</rss>",
+			signature: "",
+			want:      false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delete(pushed, source.ID)
+			req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/websub/%d", callback.URL, source.ID), strings.NewReader(tt.body))
+			if tt.signature != "" {
+				req.Header.Set("X-Hub-Signature", tt.signature)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("pushing content: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusAccepted {
+				t.Errorf("push responded %d, want %d", resp.StatusCode, http.StatusAccepted)
+			}
+			got, ok := pushed[source.ID]
+			if ok != tt.want {
+				t.Errorf("content delivered = %v, want %v", ok, tt.want)
+			}
+			if ok && got != tt.body {
+				t.Errorf("content = %q, want %q", got, tt.body)
+			}
+		})
+	}
+}
+
+func Test_subscriber_verify(t *testing.T) {
+	const topic = "https://example.com/feed.xml"
+	db := newTestDB(t)
+	source := &models.Source{URL: topic, Title: "Example"}
+	db.Create(source)
+
+	// Hub accepts requests and verifies later
+	var callbackURL string
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		callbackURL = r.PostForm.Get("hub.callback")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer hub.Close()
+
+	s, err := NewSubscriber(&Config{
+		DB:          db,
+		CallbackURL: "https://portier.example.com/websub",
+		Lease:       time.Hour,
+		OnContent:   func(uint, []byte) {},
+		Logger:      zap.NewNop().Sugar(),
+	})
+	if err != nil {
+		t.Fatalf("NewSubscriber() error = %v", err)
+	}
+	sub := s.(*subscriber)
+
+	// verify calls back to callback with query of hub and returns the response code
+	verify := func(callback string, lease string) int {
+		u, _ := url.Parse(callback)
+		query := u.Query()
+		query.Set("hub.mode", "subscribe")
+		query.Set("hub.topic", topic)
+		query.Set("hub.challenge", "challenge")
+		query.Set("hub.lease_seconds", lease)
+		u.RawQuery = query.Encode()
+		w := httptest.NewRecorder()
+		sub.ServeHTTP(w, httptest.NewRequest(http.MethodGet, u.String(), nil))
+		return w.Code
+	}
+	forged := fmt.Sprintf("https://portier.example.com/websub/%d", source.ID)
+
+	if err := s.Subscribe(source, hub.URL, topic); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	tests := []struct {
+		name       string
+		callback   func() string
+		lease      string
+		wantStatus int
+		wantActive bool
+	}{
+		{
+			name:       "Without nonce",
+			callback:   func() string { return forged },
+			lease:      "3600",
+			wantStatus: http.StatusNotFound,
+			wantActive: false,
+		},
+		{
+			name:       "Wrong nonce",
+			callback:   func() string { return forged + "?nonce=guess" },
+			lease:      "3600",
+			wantStatus: http.StatusNotFound,
+			wantActive: false,
+		},
+		{
+			name:       "Oversized lease",
+			callback:   func() string { return callbackURL },
+			lease:      "315360000",
+			wantStatus: http.StatusOK,
+			wantActive: true,
+		},
+		{
+			name:       "Replayed after verified",
+			callback:   func() string { return callbackURL },
+			lease:      "315360000",
+			wantStatus: http.StatusNotFound,
+			wantActive: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verify(tt.callback(), tt.lease); got != tt.wantStatus {
+				t.Errorf("verification responded %d, want %d", got, tt.wantStatus)
+			}
+			if got := s.Active(source.ID); got != tt.wantActive {
+				t.Errorf("Active() = %v, want %v", got, tt.wantActive)
+			}
+			var ps models.PushSubscription
+			db.Where("source_id = ?", source.ID).First(&ps)
+			if ps.ExpiresAt.After(time.Now().Add(time.Hour)) {
+				t.Errorf("lease expires at %s, longer than the lease asked", ps.ExpiresAt)
+			}
+		})
+	}
+
+	// Requests hubs never verified are refused after a while
+	if err := db.Model(&models.PushSubscription{}).Where("source_id = ?", source.ID).
+		Updates(map[string]interface{}{"expires_at": time.Time{}, "requested_at": time.Now().Add(-2 * retryAfter)}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Subscribe(source, hub.URL, topic); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	db.Model(&models.PushSubscription{}).Where("source_id = ?", source.ID).Update("requested_at", time.Now().Add(-2*retryAfter))
+	if got := verify(callbackURL, "3600"); got != http.StatusNotFound {
+		t.Errorf("stale verification responded %d, want %d", got, http.StatusNotFound)
+	}
+}